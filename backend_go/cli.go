@@ -0,0 +1,528 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/evanespen/vanespen.art_2025/internal/albums"
+	"github.com/evanespen/vanespen.art_2025/internal/catalog"
+	"github.com/evanespen/vanespen.art_2025/internal/pictures"
+	"github.com/evanespen/vanespen.art_2025/internal/security"
+	"github.com/evanespen/vanespen.art_2025/internal/species"
+	"golang.org/x/term"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// catalogDump is the JSON document written by export and read by import.
+type catalogDump struct {
+	Pictures []pictures.Picture `json:"pictures"`
+	Albums   []albums.Album     `json:"albums"`
+	Species  []species.Species  `json:"species"`
+}
+
+// confirm asks before a destructive operation, without a terminal to ask on only
+// -yes allows it.
+func confirm(question string, yes bool) bool {
+	if yes {
+		return true
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintf(os.Stderr, "%s refused, run with -yes to confirm without a terminal\n", question)
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// collectImages expands the directories of paths to the supported images they contain,
+// files given explicitly are kept as they are.
+func collectImages(paths []string) ([]string, error) {
+	var files []string
+	for _, root := range paths {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, root)
+			continue
+		}
+
+		err = filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(entry.Name(), ".") && file != root {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if entry.Type().IsRegular() && pictures.IsSupportedImage(file) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func ingestFiles(args []string) {
+	flags := flag.NewFlagSet("ingest", flag.ExitOnError)
+	album := flags.String("album", "", "add the pictures to the album with this title, created when missing")
+	_ = flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		log.Fatal("ingest needs at least one file or directory")
+	}
+	files, err := collectImages(flags.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	closeCatalog := openCatalog()
+	defer closeCatalog()
+
+	failed := 0
+	for _, file := range files {
+		result := pictures.Ingest(file, filepath.Base(file))
+
+		if *album != "" && result.UUID != "" {
+			if err := albums.AddPictureByTitle(*album, result.UUID); err != nil {
+				log.Printf("cannot add %s to album %s: %v\n", file, *album, err)
+			}
+		}
+
+		detail := result.UUID
+		if result.Reason != "" {
+			detail = result.Reason
+		}
+		for _, similar := range result.SimilarTo {
+			detail += fmt.Sprintf(", similar to %s (distance %d)", similar.UUID, similar.Distance)
+		}
+		fmt.Printf("%s\t%s\t%s\n", result.Status, file, detail)
+		if result.Status != pictures.UploadCreated && result.Status != pictures.UploadDuplicate {
+			failed++
+		}
+	}
+
+	fmt.Printf("%d files, %d failed\n", len(files), failed)
+	if failed > 0 {
+		closeCatalog()
+		os.Exit(1)
+	}
+}
+
+func reindex(args []string) {
+	flags := flag.NewFlagSet("reindex", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "show the pictures which would change without updating them")
+	_ = flags.Parse(args)
+
+	closeCatalog := openCatalog()
+	defer closeCatalog()
+
+	report, err := pictures.Reindex(*dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, picture := range report.Changed {
+		fmt.Printf("%s\t%dx%d\n", picture.UUID, picture.Width, picture.Height)
+	}
+	for uuid, reason := range report.Unreadable {
+		fmt.Printf("%s\tunreadable rendition: %s\n", uuid, reason)
+	}
+
+	fmt.Printf("%d pictures changed, %d unreadable\n", len(report.Changed), len(report.Unreadable))
+	if *dryRun && len(report.Changed) > 0 {
+		fmt.Println("dry run, catalog left untouched")
+	}
+}
+
+func rebuildRenditions(args []string) {
+	flags := flag.NewFlagSet("renditions", flag.ExitOnError)
+	only := flags.String("only", "", "comma separated renditions to rebuild, every one by default")
+	force := flags.Bool("force", false, "rebuild the renditions even when they are up to date")
+	filter := flags.String("filter", "", "pictures to rebuild as a query string, camera=X&from=2024-01-01")
+	workers := flags.Int("workers", configs.RenditionWorkers, "pictures processed in parallel")
+	_ = flags.Parse(args)
+
+	options := pictures.ReprocessOptions{Force: *force, Workers: *workers}
+	if *only != "" {
+		options.Renditions = strings.Split(*only, ",")
+	}
+
+	values, err := url.ParseQuery(*filter)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if options.Filter, err = pictures.ParseFilterValues(values); err != nil {
+		log.Fatal(err)
+	}
+
+	closeCatalog := openCatalog()
+	defer closeCatalog()
+
+	var mutex sync.Mutex
+	progress, err := pictures.Reprocess(options, func(progress pictures.ReprocessProgress) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		fmt.Fprintf(os.Stderr, "\r%d/%d", progress.Rebuilt+progress.UpToDate+len(progress.Failures), progress.Total)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintln(os.Stderr)
+
+	for _, failure := range progress.Failures {
+		fmt.Printf("%s\t%s\n", failure.UUID, failure.Reason)
+	}
+	fmt.Printf("%d pictures, %d rebuilt, %d up to date, %d failed\n", progress.Total, progress.Rebuilt, progress.UpToDate, len(progress.Failures))
+	if len(progress.Failures) > 0 {
+		closeCatalog()
+		os.Exit(1)
+	}
+}
+
+// danglingAlbumPictures lists by album the pictures it refers to which are not in the catalog.
+func danglingAlbumPictures() (map[string][]string, error) {
+	allPictures, err := pictures.GetRepository().List()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(allPictures))
+	for _, picture := range allPictures {
+		known[picture.UUID] = true
+	}
+
+	allAlbums, err := albums.GetRepository().List()
+	if err != nil {
+		return nil, err
+	}
+	dangling := make(map[string][]string)
+	for _, album := range allAlbums {
+		for _, pictureUUID := range album.Pictures {
+			if !known[pictureUUID] {
+				dangling[album.Title] = append(dangling[album.Title], pictureUUID)
+			}
+		}
+	}
+	return dangling, nil
+}
+
+func verify(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	fix := flags.Bool("fix", false, "remove the orphan renditions, the album entries of missing pictures and the sensitive metadata of renditions")
+	yes := flags.Bool("yes", false, "do not ask for confirmation")
+	_ = flags.Parse(args)
+
+	closeCatalog := openCatalog()
+	defer closeCatalog()
+
+	report, err := pictures.Verify()
+	if err != nil {
+		log.Fatal(err)
+	}
+	dangling, err := danglingAlbumPictures()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for uuid, files := range report.MissingRenditions {
+		fmt.Printf("missing renditions of %s: %s\n", uuid, strings.Join(files, ", "))
+	}
+	for checksum, uuids := range report.DuplicateChecksums {
+		fmt.Printf("pictures sharing checksum %s: %s\n", checksum, strings.Join(uuids, ", "))
+	}
+	for _, file := range report.OrphanRenditions {
+		fmt.Printf("orphan rendition: %s\n", file)
+	}
+	for _, leak := range report.MetadataLeaks {
+		fmt.Printf("sensitive metadata in the %s rendition of %s: %s\n", leak.Rendition, leak.UUID, strings.Join(leak.Fields, ", "))
+	}
+	for title, uuids := range dangling {
+		fmt.Printf("album %q refers to missing pictures: %s\n", title, strings.Join(uuids, ", "))
+	}
+
+	if report.OK() && len(dangling) == 0 {
+		fmt.Printf("%d pictures, catalog and storage are consistent\n", report.Pictures)
+		return
+	}
+	if !*fix {
+		closeCatalog()
+		os.Exit(1)
+	}
+
+	if len(report.OrphanRenditions) > 0 && confirm(fmt.Sprintf("remove %d orphan rendition files?", len(report.OrphanRenditions)), *yes) {
+		for _, file := range report.OrphanRenditions {
+			if err := os.RemoveAll(file); err != nil {
+				log.Println(err)
+			}
+		}
+		report.OrphanRenditions = nil
+	}
+
+	if len(report.MetadataLeaks) > 0 && confirm(fmt.Sprintf("rewrite the metadata of %d renditions?", len(report.MetadataLeaks)), *yes) {
+		if err := pictures.FixMetadataLeaks(report.MetadataLeaks); err != nil {
+			log.Fatal(err)
+		}
+		report.MetadataLeaks = nil
+	}
+
+	if len(dangling) > 0 && confirm(fmt.Sprintf("remove the missing pictures from %d albums?", len(dangling)), *yes) {
+		for _, uuids := range dangling {
+			for _, pictureUUID := range uuids {
+				if err := albums.RemovePicture(pictureUUID); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+		dangling = nil
+	}
+
+	if !report.OK() || len(dangling) > 0 {
+		fmt.Println("some issues remain, missing renditions and duplicates are not fixed automatically")
+		closeCatalog()
+		os.Exit(1)
+	}
+}
+
+func readPassword(prompt string) string {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			log.Fatal(err)
+		}
+		return strings.TrimRight(line, "\r\n")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return string(password)
+}
+
+func hashPassword() {
+	password := readPassword("password: ")
+	if password == "" {
+		log.Fatal("empty password")
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) && readPassword("again: ") != password {
+		log.Fatal("passwords do not match")
+	}
+
+	hash, err := security.HashPassword(password)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(hash)
+}
+
+func exportCatalog(args []string) {
+	closeCatalog := openCatalog()
+	defer closeCatalog()
+
+	var dump catalogDump
+	var err error
+	if dump.Pictures, err = pictures.GetRepository().List(); err != nil {
+		log.Fatal(err)
+	}
+	if dump.Albums, err = albums.GetRepository().List(); err != nil {
+		log.Fatal(err)
+	}
+	if dump.Species, err = species.GetRepository().List(); err != nil {
+		log.Fatal(err)
+	}
+
+	output := os.Stdout
+	if len(args) > 0 && args[0] != "-" {
+		output, err = os.Create(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer output.Close()
+	}
+
+	encoder := json.NewEncoder(output)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(dump); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "exported %d pictures, %d albums and %d species\n", len(dump.Pictures), len(dump.Albums), len(dump.Species))
+}
+
+// importRecords inserts records into repository, the records already present are
+// overwritten with replace and skipped otherwise.
+func importRecords[T catalog.Record](repository catalog.Repository[T], records []T, replace bool) (int, error) {
+	imported := 0
+	err := repository.Transaction(func(tx catalog.Repository[T]) error {
+		for _, record := range records {
+			_, err := tx.Get(record.GetUUID())
+			switch {
+			case errors.Is(err, catalog.ErrNotFound):
+				err = tx.Insert(record)
+			case err == nil && replace:
+				err = tx.Update(record)
+			case err == nil:
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			imported++
+		}
+		return nil
+	})
+	return imported, err
+}
+
+func countExisting[T catalog.Record](repository catalog.Repository[T], records []T) int {
+	existing := 0
+	for _, record := range records {
+		if _, err := repository.Get(record.GetUUID()); err == nil {
+			existing++
+		}
+	}
+	return existing
+}
+
+func importCatalog(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	replace := flags.Bool("replace", false, "overwrite the pictures, albums and species already in the catalog")
+	yes := flags.Bool("yes", false, "do not ask for confirmation")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatal("import needs the file to import")
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	var dump catalogDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		log.Fatalf("invalid catalog export: %v", err)
+	}
+
+	closeCatalog := openCatalog()
+	defer closeCatalog()
+
+	existingPictures := countExisting(pictures.GetRepository(), dump.Pictures)
+	existingAlbums := countExisting(albums.GetRepository(), dump.Albums)
+	existingSpecies := countExisting(species.GetRepository(), dump.Species)
+	if *replace && existingPictures+existingAlbums+existingSpecies > 0 {
+		if !confirm(fmt.Sprintf("overwrite %d pictures, %d albums and %d species already in the catalog?", existingPictures, existingAlbums, existingSpecies), *yes) {
+			closeCatalog()
+			os.Exit(1)
+		}
+	}
+
+	importedPictures, err := importRecords(pictures.GetRepository(), dump.Pictures, *replace)
+	if err != nil {
+		log.Fatal(err)
+	}
+	importedAlbums, err := importRecords(albums.GetRepository(), dump.Albums, *replace)
+	if err != nil {
+		log.Fatal(err)
+	}
+	importedSpecies, err := importRecords(species.GetRepository(), dump.Species, *replace)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("imported %d pictures, %d albums and %d species", importedPictures, importedAlbums, importedSpecies)
+	if !*replace {
+		fmt.Printf(", skipped %d pictures, %d albums and %d species already in the catalog", existingPictures, existingAlbums, existingSpecies)
+	}
+	fmt.Println()
+}
+
+func manageAlbums(args []string) {
+	if len(args) == 0 {
+		log.Fatal("usage: albums list | create [-description d] <title> | add <album> <pictures...>")
+	}
+
+	closeCatalog := openCatalog()
+	defer closeCatalog()
+
+	switch args[0] {
+	case "list":
+		allAlbums, err := albums.GetRepository().List()
+		if err != nil {
+			log.Fatal(err)
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, album := range allAlbums {
+			fmt.Fprintf(writer, "%s\t%s\t%d pictures\n", album.UUID, album.Title, len(album.Pictures))
+		}
+		_ = writer.Flush()
+
+	case "create":
+		flags := flag.NewFlagSet("albums create", flag.ExitOnError)
+		description := flags.String("description", "", "description of the album")
+		_ = flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			log.Fatal("albums create needs the title of the album")
+		}
+
+		album := albums.NewAlbum()
+		album.Title = flags.Arg(0)
+		album.Description = *description
+		if err := albums.GetRepository().Insert(*album); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(album.UUID)
+
+	case "add":
+		if len(args) < 3 {
+			log.Fatal("albums add needs an album and at least one picture")
+		}
+
+		album, err := albums.Find(args[1])
+		if errors.Is(err, catalog.ErrNotFound) {
+			log.Fatalf("album not found: %s", args[1])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, pictureUUID := range args[2:] {
+			if _, err := pictures.GetRepository().Get(pictureUUID); err != nil {
+				log.Fatalf("picture %s: %v", pictureUUID, err)
+			}
+			if !slices.Contains(album.Pictures, pictureUUID) {
+				album.Pictures = append(album.Pictures, pictureUUID)
+			}
+		}
+		if err := albums.GetRepository().Update(album); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s now has %d pictures\n", album.Title, len(album.Pictures))
+
+	default:
+		log.Fatalf("unknown albums command: %s", args[0])
+	}
+}
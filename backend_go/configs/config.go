@@ -1,10 +1,90 @@
 package configs
 
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
 const StashDir = "/tmp/stash"
 const FullResDir = "STORAGE/full"
 const HalfResDir = "STORAGE/half"
 const ThumbResDir = "STORAGE/thumb"
 const TinyResDir = "STORAGE/tiny"
+const TilesDir = "STORAGE/tiles"
+const TileSize = 256
+const TilesMaxAge = 365 * 24 * time.Hour
+const RenditionQuality = 95
+const RenditionWorkers = 4
+const MaxImagePixels = 1 << 29
+
+// DecodedPixelsBudget bounds the pixels of the images held decoded at once by ingest,
+// reprocess and reindex together, a panorama of MaxImagePixels is decoded alone.
+const DecodedPixelsBudget = MaxImagePixels
+const PlaceholderSize = 32
+const PlaceholderQuality = 50
+const NearDuplicateThreshold = 10
+const LocationGridSize = 0.1
 const PicturesDatabaseFile = "DATABASES/pictures.parquet"
 const AlbumsDatabaseFile = "DATABASES/albums.parquet"
+const SpeciesDatabaseFile = "DATABASES/species.parquet"
+const SQLiteDatabaseFile = "DATABASES/catalog.sqlite"
+
+// CatalogLockFile is locked by the process using the parquet catalog, a second one
+// refuses to start.
+const CatalogLockFile = "DATABASES/.lock"
+const DatabaseGenerations = 3
+const CompactionThreshold = 100
+const CompactionInterval = 5 * time.Minute
+const JobsStateFile = "DATABASES/jobs.json"
+const IngestWorkers = 2
+const IngestQueueSize = 10000
+const JobRetention = 24 * time.Hour
+const MaxUploadSize = 4 << 30
+const UploadExpiry = 24 * time.Hour
+const UploadJanitorInterval = time.Hour
+const MaxArchiveEntries = 10000
+const MaxArchiveEntrySize = 1 << 30
+const MaxArchiveRatio = 100
+const WatchStableDuration = 5 * time.Second
+const WatchPollInterval = 10 * time.Second
+const WatchProcessedDir = "processed"
+const WatchFailedDir = "failed"
+const WatchLogFile = "ingest.log"
 const APIHost = ":8080"
+const ShutdownTimeout = 30 * time.Second
+
+// CatalogBackend selects the catalog storage at startup: parquet, sqlite or memory.
+var CatalogBackend = getEnv("CATALOG_BACKEND", "parquet")
+
+// NearDuplicatePolicy is what ingest does with the pictures whose perceptual hash is
+// within NearDuplicateThreshold bits of an existing one: flag, reject or off.
+var NearDuplicatePolicy = getEnv("NEAR_DUPLICATE_POLICY", "flag")
+
+// LocationPrivacy is how precisely the public responses give the GPS position of the
+// pictures without a privacy level of their own: exact, coarse (to a cell of
+// LocationGridSize degrees) or hidden. The level of their species can only make it more
+// private.
+var LocationPrivacy = getEnv("LOCATION_PRIVACY", "coarse")
+
+// Creator, Copyright and LicenceURL are written as XMP in the renditions whose metadata
+// policy includes the licence, the empty ones are left out.
+var Creator = getEnv("CREATOR", "")
+var Copyright = getEnv("COPYRIGHT", "")
+var LicenceURL = getEnv("LICENCE_URL", "")
+
+// WatchFolders are the drop folders ingested while the server runs, separated like PATH.
+var WatchFolders = filepath.SplitList(getEnv("WATCH_FOLDERS", ""))
+
+// WatchAlbums adds the pictures dropped in a subfolder to the album titled like it.
+var WatchAlbums = getEnv("WATCH_ALBUMS", "false") == "true"
+
+// WatchPolling disables inotify, for drop folders on network shares which do not report events.
+var WatchPolling = getEnv("WATCH_POLLING", "false") == "true"
+
+func getEnv(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
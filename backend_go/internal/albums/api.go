@@ -1,7 +1,9 @@
 package albums
 
 import (
+	"errors"
 	"fmt"
+	"github.com/evanespen/vanespen.art_2025/internal/catalog"
 	"github.com/gin-gonic/gin"
 	"net/http"
 )
@@ -13,13 +15,17 @@ func PostAlbum(c *gin.Context) {
 		return
 	}
 
-	Append(*newAlbum)
+	if err := repository.Insert(*newAlbum); err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
 
 	c.Status(201)
 }
 
 func GetAllAlbums(c *gin.Context) {
-	allAlbums, err := Read()
+	allAlbums, err := repository.List()
 	if err != nil {
 		fmt.Println(err)
 		c.Status(500)
@@ -31,9 +37,14 @@ func GetAllAlbums(c *gin.Context) {
 func GetOneAlbum(c *gin.Context) {
 	uuid := c.Param("uuid")
 
-	album, err := GetOne(uuid)
+	album, err := repository.Get(uuid)
+	if errors.Is(err, catalog.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "album not found"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, err)
+		fmt.Println(err)
+		c.Status(500)
 		return
 	}
 
@@ -50,36 +61,26 @@ func UpdateAlbumPictures(c *gin.Context) {
 		return
 	}
 
-	albums, err := Read()
+	album, err := repository.Get(c.Param("uuid"))
+	if errors.Is(err, catalog.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "album not found"})
+		return
+	}
 	if err != nil {
 		fmt.Println(err)
-		c.JSON(http.StatusInternalServerError, err)
-	}
-
-	fmt.Println(payload)
-
-	var selectedAlbum Album
-	var selectedAlbumIndex int
-
-	for index, album := range albums {
-		if album.UUID == c.Param("uuid") {
-			selectedAlbum = album
-			selectedAlbumIndex = index
-			break
-		}
+		c.Status(http.StatusInternalServerError)
+		return
 	}
 
-	if selectedAlbum.Title != "" {
-		fmt.Println("album found")
-		selectedAlbum.Pictures = payload.Pictures
-		albums[selectedAlbumIndex] = selectedAlbum
+	album.Pictures = payload.Pictures
 
-		Write(albums)
-		c.Status(200)
+	if err := repository.Update(album); err != nil {
+		fmt.Println(err)
+		c.Status(http.StatusInternalServerError)
 		return
 	}
 
-	c.JSON(http.StatusNotFound, gin.H{"error": "album not found"})
+	c.Status(200)
 }
 
 func BindRoutes(engine *gin.Engine, adminGroup *gin.RouterGroup) {
@@ -2,114 +2,103 @@ package albums
 
 import (
 	"errors"
-	"fmt"
 	"github.com/evanespen/vanespen.art_2025/configs"
-	"github.com/xitongsys/parquet-go-source/local"
-	"github.com/xitongsys/parquet-go/parquet"
-	"github.com/xitongsys/parquet-go/reader"
-	"github.com/xitongsys/parquet-go/writer"
-	"log"
-	"os"
+	"github.com/evanespen/vanespen.art_2025/internal/catalog"
+	"slices"
 )
 
-func Append(album Album) {
-	if _, err := os.Stat(configs.AlbumsDatabaseFile); err == nil {
-		albums, err := Read()
-		if err != nil {
-			log.Println(err, err)
-		}
-		albums = append(albums, album)
-		Write(albums)
-	} else {
-		Write([]Album{album})
-	}
-}
+const catalogName = "albums"
 
-func Write(albums []Album) {
-	fw, err := local.NewLocalFileWriter(configs.AlbumsDatabaseFile)
-	if err != nil {
-		log.Println("Can't create local file", err)
-		return
-	}
-
-	pw, err := writer.NewParquetWriter(fw, new(Album), 4)
-	if err != nil {
-		log.Println("Can't create parquet writer", err)
-		return
-	}
+type Repository = catalog.Repository[Album]
 
-	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+var repository Repository
 
-	for _, album := range albums {
-		if err = pw.Write(album); err != nil {
-			log.Fatalf("error while writing parquet file: %v", err)
-		}
-	}
+func OpenRepository() (Repository, error) {
+	return catalog.Open[Album](catalogName, configs.AlbumsDatabaseFile)
+}
 
-	if err = pw.WriteStop(); err != nil {
-		log.Fatalf("error while closing parquet file: %v", err)
-	}
+func Migrate(dryRun bool) (catalog.MigrationReport, error) {
+	return catalog.MigrateParquet[Album](catalogName, configs.AlbumsDatabaseFile, dryRun)
+}
 
-	fmt.Printf("write completed to %s\n", configs.AlbumsDatabaseFile)
+func SetRepository(r Repository) {
+	repository = r
 }
 
-func Read() ([]Album, error) {
-	fr, err := local.NewLocalFileReader(configs.AlbumsDatabaseFile)
-	if err != nil {
-		return nil, fmt.Errorf("cannot open database file: %s", configs.AlbumsDatabaseFile)
-	}
-	defer fr.Close()
+func GetRepository() Repository {
+	return repository
+}
 
-	pr, err := reader.NewParquetReader(fr, new(Album), 4)
-	if err != nil {
-		return nil, errors.New("cannot create parquet reader")
-	}
-	defer pr.ReadStop()
+func (a Album) GetUUID() string {
+	return a.UUID
+}
 
-	var albums []Album
+// RemovePicture drops pictureUUID from every album referencing it.
+func RemovePicture(pictureUUID string) error {
+	return repository.Transaction(func(tx Repository) error {
+		allAlbums, err := tx.List()
+		if err != nil {
+			return err
+		}
 
-	batchSize := 10
-	num := int(pr.GetNumRows())
+		for _, album := range allAlbums {
+			if !slices.Contains(album.Pictures, pictureUUID) {
+				continue
+			}
+			album.Pictures = slices.DeleteFunc(slices.Clone(album.Pictures), func(uuid string) bool {
+				return uuid == pictureUUID
+			})
+			if err := tx.Update(album); err != nil {
+				return err
+			}
+		}
 
-	if num < batchSize {
-		batchSize = num
-	}
+		return nil
+	})
+}
 
-	for {
-		rows, err := pr.ReadByNumber(batchSize)
+// AddPictureByTitle adds pictureUUID to the album titled title, the album is created
+// when there is none.
+func AddPictureByTitle(title string, pictureUUID string) error {
+	return repository.Transaction(func(tx Repository) error {
+		allAlbums, err := tx.List()
 		if err != nil {
-			fmt.Println(err)
-			break // End of the file
+			return err
 		}
 
-		for _, row := range rows {
-			album, ok := row.(Album)
-			if !ok {
-				log.Printf("unable to convert: wanted Album, got %T\n", row)
+		for _, album := range allAlbums {
+			if album.Title != title {
 				continue
 			}
-			albums = append(albums, album)
-		}
-
-		if len(rows) < batchSize {
-			break // End of the file
+			if slices.Contains(album.Pictures, pictureUUID) {
+				return nil
+			}
+			album.Pictures = append(slices.Clone(album.Pictures), pictureUUID)
+			return tx.Update(album)
 		}
-	}
 
-	return albums, nil
+		album := NewAlbum()
+		album.Title = title
+		album.Pictures = append(album.Pictures, pictureUUID)
+		return tx.Insert(*album)
+	})
 }
 
-func GetOne(uuid string) (Album, error) {
-	albums, err := Read()
+// Find returns the album with the given uuid or, failing that, the given title.
+func Find(key string) (Album, error) {
+	album, err := repository.Get(key)
+	if !errors.Is(err, catalog.ErrNotFound) {
+		return album, err
+	}
+
+	allAlbums, err := repository.List()
 	if err != nil {
 		return Album{}, err
 	}
-
-	for _, album := range albums {
-		if album.UUID == uuid {
+	for _, album := range allAlbums {
+		if album.Title == key {
 			return album, nil
 		}
 	}
-
-	return Album{}, fmt.Errorf("album not found: %s", uuid)
+	return Album{}, catalog.ErrNotFound
 }
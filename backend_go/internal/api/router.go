@@ -2,9 +2,14 @@ package api
 
 import "github.com/gin-gonic/gin"
 
-var router = gin.Default()
+var router *gin.Engine
 
+// GetRouter creates the router on first use, so the commands which do not serve HTTP
+// do not set up gin.
 func GetRouter() *gin.Engine {
+	if router == nil {
+		router = gin.Default()
+	}
 	return router
 }
 
@@ -0,0 +1,28 @@
+//go:build unix
+
+package catalog
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "DATABASES", ".lock")
+
+	unlock, err := Lock(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Lock(file); !errors.Is(err, ErrLocked) {
+		t.Fatalf("got error %v locking a locked catalog, want %v", err, ErrLocked)
+	}
+
+	unlock()
+	unlockAgain, err := Lock(file)
+	if err != nil {
+		t.Fatalf("the released lock cannot be taken again: %v", err)
+	}
+	unlockAgain()
+}
@@ -0,0 +1,137 @@
+package catalog
+
+import (
+	"fmt"
+	"sync"
+)
+
+// records is the unsynchronised ordered store shared by the in-memory and parquet backends.
+type records[T Record] struct {
+	items []T
+	index map[string]int
+}
+
+func newRecords[T Record](items []T) *records[T] {
+	r := &records[T]{
+		items: make([]T, 0, len(items)),
+		index: make(map[string]int, len(items)),
+	}
+	for _, item := range items {
+		r.index[item.GetUUID()] = len(r.items)
+		r.items = append(r.items, item)
+	}
+	return r
+}
+
+func (r *records[T]) clone() *records[T] {
+	return newRecords(r.items)
+}
+
+func (r *records[T]) Get(uuid string) (T, error) {
+	position, ok := r.index[uuid]
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("%w: %s", ErrNotFound, uuid)
+	}
+	return r.items[position], nil
+}
+
+func (r *records[T]) List() ([]T, error) {
+	items := make([]T, len(r.items))
+	copy(items, r.items)
+	return items, nil
+}
+
+func (r *records[T]) Insert(record T) error {
+	if _, ok := r.index[record.GetUUID()]; ok {
+		return fmt.Errorf("%w: %s", ErrAlreadyExists, record.GetUUID())
+	}
+	r.index[record.GetUUID()] = len(r.items)
+	r.items = append(r.items, record)
+	return nil
+}
+
+func (r *records[T]) Update(record T) error {
+	position, ok := r.index[record.GetUUID()]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, record.GetUUID())
+	}
+	r.items[position] = record
+	return nil
+}
+
+func (r *records[T]) Delete(uuid string) error {
+	position, ok := r.index[uuid]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, uuid)
+	}
+	r.items = append(r.items[:position], r.items[position+1:]...)
+	delete(r.index, uuid)
+	for i := position; i < len(r.items); i++ {
+		r.index[r.items[i].GetUUID()] = i
+	}
+	return nil
+}
+
+func (r *records[T]) Transaction(fn func(tx Repository[T]) error) error {
+	return fn(r)
+}
+
+func (r *records[T]) Close() error {
+	return nil
+}
+
+type MemoryRepository[T Record] struct {
+	mutex   sync.RWMutex
+	records *records[T]
+}
+
+func NewMemoryRepository[T Record]() *MemoryRepository[T] {
+	return &MemoryRepository[T]{records: newRecords[T](nil)}
+}
+
+func (m *MemoryRepository[T]) Get(uuid string) (T, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.records.Get(uuid)
+}
+
+func (m *MemoryRepository[T]) List() ([]T, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.records.List()
+}
+
+func (m *MemoryRepository[T]) Insert(record T) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.records.Insert(record)
+}
+
+func (m *MemoryRepository[T]) Update(record T) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.records.Update(record)
+}
+
+func (m *MemoryRepository[T]) Delete(uuid string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.records.Delete(uuid)
+}
+
+func (m *MemoryRepository[T]) Transaction(fn func(tx Repository[T]) error) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	tx := m.records.clone()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	m.records = tx
+	return nil
+}
+
+func (m *MemoryRepository[T]) Close() error {
+	return nil
+}
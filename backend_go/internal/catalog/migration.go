@@ -0,0 +1,264 @@
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// SchemaVersionKey is the parquet key-value metadata entry holding the schema version
+// a catalog file was written with. Files written before versioning existed have no
+// entry and are considered to be at BaseSchemaVersion.
+const SchemaVersionKey = "schema_version"
+const BaseSchemaVersion = 1
+
+// Row is a catalog row keyed by parquet column name, as seen by migrations.
+type Row map[string]any
+
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(row Row) error
+}
+
+var migrations = map[string][]Migration{}
+
+// RegisterMigration adds a migration upgrading the rows of catalog name to
+// migration.Version. Versions of a catalog must be registered without gaps.
+func RegisterMigration(name string, migration Migration) {
+	registered := append(migrations[name], migration)
+	sort.Slice(registered, func(i, j int) bool {
+		return registered[i].Version < registered[j].Version
+	})
+	migrations[name] = registered
+}
+
+func SchemaVersion(name string) int {
+	registered := migrations[name]
+	if len(registered) == 0 {
+		return BaseSchemaVersion
+	}
+	return registered[len(registered)-1].Version
+}
+
+func PendingMigrations(name string, fromVersion int) []Migration {
+	var pending []Migration
+	for _, migration := range migrations[name] {
+		if migration.Version > fromVersion {
+			pending = append(pending, migration)
+		}
+	}
+	return pending
+}
+
+type MigrationReport struct {
+	Catalog     string
+	File        string
+	FromVersion int
+	ToVersion   int
+	Rows        int
+	Applied     []Migration
+}
+
+// MigrateParquet upgrades file to the current schema version of catalog name. With
+// dryRun the migrations are run in memory and the report is returned without
+// touching the file.
+func MigrateParquet[T Record](name string, file string, dryRun bool) (MigrationReport, error) {
+	report := MigrationReport{Catalog: name, File: file, ToVersion: SchemaVersion(name)}
+
+	if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		report.FromVersion = report.ToVersion
+		return report, nil
+	}
+
+	rows, version, err := readRows(file)
+	if err != nil {
+		return report, err
+	}
+	report.FromVersion = version
+	report.Rows = len(rows)
+
+	if version > report.ToVersion {
+		return report, fmt.Errorf("%s has schema version %d, newer than the supported version %d", file, version, report.ToVersion)
+	}
+
+	items, applied, err := migrateRows[T](name, rows, version)
+	if err != nil {
+		return report, err
+	}
+	report.Applied = applied
+
+	if len(applied) == 0 || dryRun {
+		return report, nil
+	}
+
+	if err := WriteParquet(file, items, report.ToVersion); err != nil {
+		return report, err
+	}
+
+	log.Printf("migrated %s from schema version %d to %d\n", file, report.FromVersion, report.ToVersion)
+	return report, nil
+}
+
+func migrateRows[T Record](name string, rows []Row, version int) ([]T, []Migration, error) {
+	applied := PendingMigrations(name, version)
+
+	items := make([]T, 0, len(rows))
+	for index, row := range rows {
+		for _, migration := range applied {
+			if err := migration.Up(row); err != nil {
+				return nil, nil, fmt.Errorf("migration %d (%s) failed on row %d: %w", migration.Version, migration.Description, index, err)
+			}
+		}
+
+		item, err := rowToRecord[T](row)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot convert migrated row %d: %w", index, err)
+		}
+		items = append(items, item)
+	}
+
+	return items, applied, nil
+}
+
+// readCatalog reads file into records of the current schema version, running the
+// pending migrations in memory when the file is older. The returned flag tells whether
+// migrations were applied and the file should be rewritten.
+func readCatalog[T Record](name string, file string) ([]T, bool, error) {
+	currentVersion := SchemaVersion(name)
+
+	version, err := readSchemaVersion(file)
+	if err != nil {
+		return nil, false, err
+	}
+	if version > currentVersion {
+		return nil, false, fmt.Errorf("%s has schema version %d, newer than the supported version %d", file, version, currentVersion)
+	}
+	if version == currentVersion {
+		items, err := ReadParquet[T](file)
+		return items, false, err
+	}
+
+	rows, _, err := readRows(file)
+	if err != nil {
+		return nil, false, err
+	}
+
+	items, _, err := migrateRows[T](name, rows, version)
+	if err != nil {
+		return nil, false, err
+	}
+
+	log.Printf("migrating %s from schema version %d to %d\n", file, version, currentVersion)
+	return items, true, nil
+}
+
+func readSchemaVersion(file string) (int, error) {
+	fr, err := local.NewLocalFileReader(file)
+	if err != nil {
+		return 0, fmt.Errorf("cannot open database file: %s", file)
+	}
+	defer fr.Close()
+
+	pr, err := reader.NewParquetReader(fr, nil, 1)
+	if err != nil {
+		return 0, fmt.Errorf("cannot create parquet reader for %s: %w", file, err)
+	}
+	defer pr.ReadStop()
+
+	version, err := footerSchemaVersion(pr.Footer)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version in %s: %w", file, err)
+	}
+	return version, nil
+}
+
+func schemaMetadata(version int) []*parquet.KeyValue {
+	value := strconv.Itoa(version)
+	return []*parquet.KeyValue{{Key: SchemaVersionKey, Value: &value}}
+}
+
+func footerSchemaVersion(footer *parquet.FileMetaData) (int, error) {
+	for _, keyValue := range footer.GetKeyValueMetadata() {
+		if keyValue.Key == SchemaVersionKey && keyValue.Value != nil {
+			return strconv.Atoi(*keyValue.Value)
+		}
+	}
+	return BaseSchemaVersion, nil
+}
+
+// readRows reads file with the schema stored in the file itself rather than the one
+// of the current Go struct, so files written by older versions can still be read.
+func readRows(file string) ([]Row, int, error) {
+	fr, err := local.NewLocalFileReader(file)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot open database file: %s", file)
+	}
+	defer fr.Close()
+
+	pr, err := reader.NewParquetReader(fr, nil, 4)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot create parquet reader for %s: %w", file, err)
+	}
+	defer pr.ReadStop()
+
+	version, err := footerSchemaVersion(pr.Footer)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid schema version in %s: %w", file, err)
+	}
+
+	columnNames := make(map[string]string)
+	for _, info := range pr.SchemaHandler.Infos {
+		columnNames[info.InName] = info.ExName
+	}
+
+	num := int(pr.GetNumRows())
+	if num == 0 {
+		return nil, version, nil
+	}
+
+	values, err := pr.ReadByNumber(num)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot read rows of %s: %w", file, err)
+	}
+
+	rows := make([]Row, 0, len(values))
+	for _, value := range values {
+		structValue := reflect.ValueOf(value)
+		row := make(Row, structValue.NumField())
+		for i := 0; i < structValue.NumField(); i++ {
+			field := structValue.Field(i)
+			if field.Kind() == reflect.Pointer {
+				if field.IsNil() {
+					continue
+				}
+				field = field.Elem()
+			}
+			row[columnNames[structValue.Type().Field(i).Name]] = field.Interface()
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, version, nil
+}
+
+// rowToRecord relies on the json and parquet names of the record fields being the same.
+func rowToRecord[T Record](row Row) (T, error) {
+	var record T
+
+	data, err := json.Marshal(row)
+	if err != nil {
+		return record, err
+	}
+
+	err = json.Unmarshal(data, &record)
+	return record, err
+}
@@ -0,0 +1,133 @@
+package catalog
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// versionOne is the schema of the versioned test catalog before its migrations.
+type versionOne struct {
+	UUID string `json:"uuid" parquet:"name=uuid, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+const versionedCatalog = "versioned"
+const failingCatalog = "failing"
+
+var errBrokenRow = errors.New("broken row")
+
+func init() {
+	RegisterMigration(versionedCatalog, Migration{Version: 3, Description: "mark the titles", Up: func(row Row) error {
+		row["title"] = row["title"].(string) + "!"
+		return nil
+	}})
+	// Registered out of order, the migrations are run by version.
+	RegisterMigration(versionedCatalog, Migration{Version: 2, Description: "add title", Up: func(row Row) error {
+		row["title"] = "untitled " + row["uuid"].(string)
+		return nil
+	}})
+
+	RegisterMigration(failingCatalog, Migration{Version: 2, Description: "fail on b", Up: func(row Row) error {
+		if row["uuid"] == "b" {
+			return errBrokenRow
+		}
+		return nil
+	}})
+}
+
+func writeVersionOne(t *testing.T, uuids ...string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "versioned.parquet")
+	var items []versionOne
+	for _, uuid := range uuids {
+		items = append(items, versionOne{UUID: uuid})
+	}
+	if err := WriteParquet(file, items, BaseSchemaVersion); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestMigrateParquet(t *testing.T) {
+	tests := []struct {
+		name        string
+		catalog     string
+		dryRun      bool
+		wantErr     error
+		wantVersion int
+		wantApplied int
+		wantTitles  []string
+	}{
+		{name: "migrated", catalog: versionedCatalog, wantVersion: 3, wantApplied: 2, wantTitles: []string{"untitled a!", "untitled b!"}},
+		{name: "dry run", catalog: versionedCatalog, dryRun: true, wantVersion: BaseSchemaVersion, wantApplied: 2},
+		{name: "failing", catalog: failingCatalog, wantErr: errBrokenRow, wantVersion: BaseSchemaVersion},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := writeVersionOne(t, "a", "b")
+
+			report, err := MigrateParquet[testRecord](test.catalog, file, test.dryRun)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			if err == nil && (report.FromVersion != BaseSchemaVersion || report.ToVersion != SchemaVersion(test.catalog) || len(report.Applied) != test.wantApplied || report.Rows != 2) {
+				t.Errorf("got report %+v", report)
+			}
+
+			version, err := readSchemaVersion(file)
+			if err != nil || version != test.wantVersion {
+				t.Fatalf("file at version %d, error %v, want version %d", version, err, test.wantVersion)
+			}
+			if test.wantTitles == nil {
+				return
+			}
+			items, err := ReadParquet[testRecord](file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, item := range items {
+				if item.Title != test.wantTitles[i] {
+					t.Errorf("record %s has title %q, want %q", item.UUID, item.Title, test.wantTitles[i])
+				}
+			}
+
+			// Migrating again finds nothing to do.
+			if report, err := MigrateParquet[testRecord](test.catalog, file, false); err != nil || len(report.Applied) != 0 {
+				t.Errorf("second migration applied %d, error %v", len(report.Applied), err)
+			}
+		})
+	}
+}
+
+func TestOpenMigratesOlderFiles(t *testing.T) {
+	file := writeVersionOne(t, "a")
+
+	repository, err := NewParquetRepository[testRecord](versionedCatalog, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repository.Close()
+
+	if record, err := repository.Get("a"); err != nil || record.Title != "untitled a!" {
+		t.Fatalf("got %v, %v, want the migrated record", record, err)
+	}
+	if version, err := readSchemaVersion(file); err != nil || version != 3 {
+		t.Fatalf("file rewritten at version %d, error %v", version, err)
+	}
+}
+
+func TestOpenRejectsNewerFiles(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "newer.parquet")
+	if err := WriteParquet(file, []testRecord{{UUID: "a"}}, SchemaVersion(versionedCatalog)+1); err != nil {
+		t.Fatal(err)
+	}
+
+	if repository, err := NewParquetRepository[testRecord](versionedCatalog, file); err == nil {
+		_ = repository.Close()
+		t.Fatal("a file written by a newer version is opened")
+	}
+	if _, err := MigrateParquet[testRecord](versionedCatalog, file, false); err == nil {
+		t.Fatal("a file written by a newer version is migrated")
+	}
+}
@@ -0,0 +1,518 @@
+package catalog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/writer"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	insertChange = "insert"
+	updateChange = "update"
+	deleteChange = "delete"
+)
+
+type change[T Record] struct {
+	Op     string `json:"op"`
+	UUID   string `json:"uuid"`
+	Record *T     `json:"record,omitempty"`
+}
+
+// journal records the changes made during a transaction so they can be appended
+// to the change log as a single batch on commit.
+type journal[T Record] struct {
+	*records[T]
+	changes []change[T]
+}
+
+func (j *journal[T]) Insert(record T) error {
+	if err := j.records.Insert(record); err != nil {
+		return err
+	}
+	j.changes = append(j.changes, change[T]{Op: insertChange, UUID: record.GetUUID(), Record: &record})
+	return nil
+}
+
+func (j *journal[T]) Update(record T) error {
+	if err := j.records.Update(record); err != nil {
+		return err
+	}
+	j.changes = append(j.changes, change[T]{Op: updateChange, UUID: record.GetUUID(), Record: &record})
+	return nil
+}
+
+func (j *journal[T]) Delete(uuid string) error {
+	if err := j.records.Delete(uuid); err != nil {
+		return err
+	}
+	j.changes = append(j.changes, change[T]{Op: deleteChange, UUID: uuid})
+	return nil
+}
+
+func (j *journal[T]) Transaction(fn func(tx Repository[T]) error) error {
+	return fn(j)
+}
+
+// ParquetRepository keeps the whole catalog in memory. The parquet file is loaded
+// once, every mutation is appended to a change log next to it, and the log is
+// periodically compacted back into the parquet file.
+type ParquetRepository[T Record] struct {
+	mutex   sync.RWMutex
+	name    string
+	file    string
+	log     *os.File
+	pending int
+	records *records[T]
+	done    chan struct{}
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func NewParquetRepository[T Record](name string, file string) (*ParquetRepository[T], error) {
+	items, rewrite, err := loadParquet[T](name, file)
+	if err != nil {
+		return nil, err
+	}
+
+	if rewrite {
+		if err := WriteParquet(file, items, SchemaVersion(name)); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &ParquetRepository[T]{
+		name:    name,
+		file:    file,
+		records: newRecords(items),
+		done:    make(chan struct{}),
+	}
+
+	if p.pending, err = replayLog(p.logFile(), p.records); err != nil {
+		return nil, err
+	}
+
+	p.log, err = os.OpenFile(p.logFile(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open change log %s: %w", p.logFile(), err)
+	}
+
+	go p.compactPeriodically()
+
+	return p, nil
+}
+
+func (p *ParquetRepository[T]) Get(uuid string) (T, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.records.Get(uuid)
+}
+
+func (p *ParquetRepository[T]) List() ([]T, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.records.List()
+}
+
+func (p *ParquetRepository[T]) Insert(record T) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, err := p.records.Get(record.GetUUID()); err == nil {
+		return fmt.Errorf("%w: %s", ErrAlreadyExists, record.GetUUID())
+	}
+	if err := p.commit([]change[T]{{Op: insertChange, UUID: record.GetUUID(), Record: &record}}); err != nil {
+		return err
+	}
+	if err := p.records.Insert(record); err != nil {
+		return err
+	}
+	p.compactIfDue()
+	return nil
+}
+
+func (p *ParquetRepository[T]) Update(record T) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, err := p.records.Get(record.GetUUID()); err != nil {
+		return err
+	}
+	if err := p.commit([]change[T]{{Op: updateChange, UUID: record.GetUUID(), Record: &record}}); err != nil {
+		return err
+	}
+	if err := p.records.Update(record); err != nil {
+		return err
+	}
+	p.compactIfDue()
+	return nil
+}
+
+func (p *ParquetRepository[T]) Delete(uuid string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, err := p.records.Get(uuid); err != nil {
+		return err
+	}
+	if err := p.commit([]change[T]{{Op: deleteChange, UUID: uuid}}); err != nil {
+		return err
+	}
+	if err := p.records.Delete(uuid); err != nil {
+		return err
+	}
+	p.compactIfDue()
+	return nil
+}
+
+func (p *ParquetRepository[T]) Transaction(fn func(tx Repository[T]) error) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	tx := &journal[T]{records: p.records.clone()}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.changes) == 0 {
+		return nil
+	}
+	if err := p.commit(tx.changes); err != nil {
+		return err
+	}
+	p.records = tx.records
+	p.compactIfDue()
+	return nil
+}
+
+// Close stops the periodic compaction, compacts the pending changes and closes the
+// change log, the calls after the first one return its result.
+func (p *ParquetRepository[T]) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		if p.closeErr = p.compact(); p.closeErr == nil {
+			p.closeErr = p.log.Close()
+		}
+	})
+	return p.closeErr
+}
+
+// Compact writes the in-memory catalog to the parquet file and empties the change log.
+func (p *ParquetRepository[T]) Compact() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.compact()
+}
+
+func (p *ParquetRepository[T]) logFile() string {
+	return p.file + ".wal"
+}
+
+// commit appends a batch of changes to the change log as one line, a batch cut
+// short by a crash is discarded as a whole on replay. The changes are applied to the
+// records by the caller, the compaction they may trigger waits for compactIfDue.
+func (p *ParquetRepository[T]) commit(changes []change[T]) error {
+	line, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	if _, err := p.log.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("cannot append to change log: %w", err)
+	}
+	if err := p.log.Sync(); err != nil {
+		return fmt.Errorf("cannot sync change log: %w", err)
+	}
+
+	p.pending += len(changes)
+	return nil
+}
+
+// compactIfDue compacts once enough changes are pending, it must only be called once
+// the committed changes are applied to the records, or the truncated change log would
+// take the last of them away.
+func (p *ParquetRepository[T]) compactIfDue() {
+	if p.pending >= configs.CompactionThreshold {
+		if err := p.compact(); err != nil {
+			log.Println("compaction failed:", err)
+		}
+	}
+}
+
+func (p *ParquetRepository[T]) compact() error {
+	if p.pending == 0 {
+		return nil
+	}
+	if err := WriteParquet(p.file, p.records.items, SchemaVersion(p.name)); err != nil {
+		return err
+	}
+	if err := p.log.Truncate(0); err != nil {
+		return fmt.Errorf("cannot truncate change log: %w", err)
+	}
+	p.pending = 0
+	return nil
+}
+
+func (p *ParquetRepository[T]) compactPeriodically() {
+	ticker := time.NewTicker(configs.CompactionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.Compact(); err != nil {
+				log.Println("compaction failed:", err)
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// loadParquet reads file, falling back to the newest readable previous generation
+// when the live file is corrupted. The change log is replayed on top of whichever
+// generation was loaded, so only the changes compacted since then are at risk. The
+// returned flag tells whether the live file must be rewritten because it was migrated
+// or recovered.
+func loadParquet[T Record](name string, file string) ([]T, bool, error) {
+	_ = os.Remove(file + ".tmp")
+
+	if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+
+	items, migrated, err := readCatalog[T](name, file)
+	if err == nil {
+		return items, migrated, nil
+	}
+	log.Printf("cannot load %s: %v\n", file, err)
+
+	for generation := 1; generation <= configs.DatabaseGenerations; generation++ {
+		previous, _, previousErr := readCatalog[T](name, generationFile(file, generation))
+		if previousErr == nil {
+			log.Printf("recovered %s from generation %d\n", file, generation)
+			return previous, true, nil
+		}
+	}
+
+	return nil, false, err
+}
+
+// replayLog applies the change log on top of the records loaded from parquet. Changes
+// are applied idempotently since a crash during compaction can leave a log whose
+// changes are already part of the parquet file. A torn last entry is cut off so that
+// later appends are not hidden behind it.
+func replayLog[T Record](file string, r *records[T]) (int, error) {
+	f, err := os.OpenFile(file, os.O_RDWR, 0644)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot open change log %s: %w", file, err)
+	}
+	defer f.Close()
+
+	replayed := 0
+	var offset int64
+	logReader := bufio.NewReader(f)
+
+	for {
+		line, err := logReader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			break
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("cannot read change log %s: %w", file, err)
+		}
+
+		var changes []change[T]
+		if err != nil || json.Unmarshal(line, &changes) != nil {
+			log.Printf("discarding incomplete change log entry at offset %d in %s\n", offset, file)
+			if err := f.Truncate(offset); err != nil {
+				return 0, fmt.Errorf("cannot truncate change log %s: %w", file, err)
+			}
+			break
+		}
+
+		for _, c := range changes {
+			_, getErr := r.Get(c.UUID)
+			switch {
+			case c.Op == deleteChange && getErr == nil:
+				_ = r.Delete(c.UUID)
+			case c.Op != deleteChange && c.Record != nil && getErr == nil:
+				_ = r.Update(*c.Record)
+			case c.Op != deleteChange && c.Record != nil:
+				_ = r.Insert(*c.Record)
+			}
+		}
+		replayed += len(changes)
+		offset += int64(len(line))
+	}
+
+	return replayed, nil
+}
+
+// WriteParquet replaces file with a parquet file holding items. The rows are written
+// to a temporary file which is synced and read back before it is atomically renamed
+// over the live file, the replaced file is kept as the newest generation.
+func WriteParquet[T any](file string, items []T, schemaVersion int) error {
+	tmpFile := file + ".tmp"
+
+	if err := writeParquetFile(tmpFile, items, schemaVersion); err != nil {
+		_ = os.Remove(tmpFile)
+		return err
+	}
+
+	written, err := ReadParquet[T](tmpFile)
+	if err != nil || len(written) != len(items) {
+		_ = os.Remove(tmpFile)
+		return fmt.Errorf("verification of %s failed: read %d of %d rows: %v", tmpFile, len(written), len(items), err)
+	}
+
+	if err := rotateGenerations(file); err != nil {
+		_ = os.Remove(tmpFile)
+		return err
+	}
+
+	if err := os.Rename(tmpFile, file); err != nil {
+		_ = os.Remove(tmpFile)
+		return fmt.Errorf("cannot replace database file %s: %w", file, err)
+	}
+
+	return syncDir(filepath.Dir(file))
+}
+
+func writeParquetFile[T any](file string, items []T, schemaVersion int) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("cannot create database file %s: %w", file, err)
+	}
+	defer f.Close()
+
+	pw, err := writer.NewParquetWriterFromWriter(f, new(T), 4)
+	if err != nil {
+		return fmt.Errorf("cannot create parquet writer: %w", err)
+	}
+
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	pw.Footer.KeyValueMetadata = schemaMetadata(schemaVersion)
+
+	for _, item := range items {
+		if err = pw.Write(item); err != nil {
+			return fmt.Errorf("error while writing parquet file: %w", err)
+		}
+	}
+
+	if err = pw.WriteStop(); err != nil {
+		return fmt.Errorf("error while closing parquet file: %w", err)
+	}
+
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("cannot sync database file %s: %w", file, err)
+	}
+
+	return f.Close()
+}
+
+func generationFile(file string, generation int) string {
+	return fmt.Sprintf("%s.%d", file, generation)
+}
+
+// rotateGenerations shifts the previous generations of file and hard links the current
+// file as generation 1, so the live file is never missing while it is being replaced.
+func rotateGenerations(file string) error {
+	if configs.DatabaseGenerations < 1 {
+		return nil
+	}
+	if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	for generation := configs.DatabaseGenerations - 1; generation >= 1; generation-- {
+		err := os.Rename(generationFile(file, generation), generationFile(file, generation+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("cannot rotate database generations of %s: %w", file, err)
+		}
+	}
+
+	_ = os.Remove(generationFile(file, 1))
+	if err := os.Link(file, generationFile(file, 1)); err != nil {
+		return fmt.Errorf("cannot keep previous generation of %s: %w", file, err)
+	}
+
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("cannot open directory %s: %w", dir, err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("cannot sync directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+func ReadParquet[T any](file string) ([]T, error) {
+	fr, err := local.NewLocalFileReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open database file: %s", file)
+	}
+	defer fr.Close()
+
+	pr, err := reader.NewParquetReader(fr, new(T), 4)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create parquet reader for %s: %w", file, err)
+	}
+	defer pr.ReadStop()
+
+	var items []T
+
+	batchSize := 10
+	num := int(pr.GetNumRows())
+
+	if num < batchSize {
+		batchSize = num
+	}
+
+	for len(items) < num {
+		rows, err := pr.ReadByNumber(batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read rows of %s: %w", file, err)
+		}
+		if len(rows) == 0 {
+			break // End of the file
+		}
+
+		for _, row := range rows {
+			item, ok := row.(T)
+			if !ok {
+				return nil, fmt.Errorf("unable to convert: wanted %T, got %T", *new(T), row)
+			}
+			items = append(items, item)
+		}
+	}
+
+	if len(items) != num {
+		return nil, fmt.Errorf("%s is truncated: read %d of %d rows", file, len(items), num)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,240 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+type testRecord struct {
+	UUID  string `json:"uuid" parquet:"name=uuid, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Title string `json:"title" parquet:"name=title, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+func (r testRecord) GetUUID() string {
+	return r.UUID
+}
+
+func newTestRecord(i int) testRecord {
+	return testRecord{UUID: fmt.Sprintf("record-%04d", i), Title: fmt.Sprintf("title %d", i)}
+}
+
+func openTestParquet(t *testing.T, file string) *ParquetRepository[testRecord] {
+	t.Helper()
+	repository, err := NewParquetRepository[testRecord]("test", file)
+	if err != nil {
+		t.Fatalf("cannot open %s: %v", file, err)
+	}
+	return repository
+}
+
+func TestParquetReopenPastCompactionThreshold(t *testing.T) {
+	counts := []int{configs.CompactionThreshold - 1, configs.CompactionThreshold, configs.CompactionThreshold + 1, 2*configs.CompactionThreshold + 3}
+
+	for _, count := range counts {
+		for _, closed := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%d inserts, closed %t", count, closed), func(t *testing.T) {
+				file := filepath.Join(t.TempDir(), "test.parquet")
+				repository := openTestParquet(t, file)
+				for i := 0; i < count; i++ {
+					if err := repository.Insert(newTestRecord(i)); err != nil {
+						t.Fatalf("insert %d: %v", i, err)
+					}
+				}
+				if closed {
+					if err := repository.Close(); err != nil {
+						t.Fatalf("close: %v", err)
+					}
+				} else {
+					// A crash leaves the change log behind, the repository is not closed.
+					t.Cleanup(func() { _ = repository.Close() })
+				}
+
+				reopened := openTestParquet(t, file)
+				defer reopened.Close()
+				items, err := reopened.List()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(items) != count {
+					t.Fatalf("got %d records after reopening, want %d", len(items), count)
+				}
+				if last, err := reopened.Get(newTestRecord(count - 1).UUID); err != nil || last != newTestRecord(count-1) {
+					t.Fatalf("last record: got %v, %v", last, err)
+				}
+			})
+		}
+	}
+}
+
+func TestParquetTransactionPastCompactionThreshold(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.parquet")
+	repository := openTestParquet(t, file)
+
+	err := repository.Transaction(func(tx Repository[testRecord]) error {
+		for i := 0; i < configs.CompactionThreshold; i++ {
+			if err := tx.Insert(newTestRecord(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openTestParquet(t, file)
+	defer reopened.Close()
+	if items, _ := reopened.List(); len(items) != configs.CompactionThreshold {
+		t.Fatalf("got %d records after reopening, want %d", len(items), configs.CompactionThreshold)
+	}
+}
+
+func TestParquetCloseTwice(t *testing.T) {
+	repository := openTestParquet(t, filepath.Join(t.TempDir(), "test.parquet"))
+	if err := repository.Insert(newTestRecord(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.Close(); err != nil {
+		t.Fatalf("first close: %v", err)
+	}
+	if err := repository.Close(); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+}
+
+func writeTestParquet(t *testing.T, file string, items ...testRecord) {
+	t.Helper()
+	if err := WriteParquet(file, items, SchemaVersion("test")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParquetRecovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		damage  func(t *testing.T, file string)
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "intact",
+			damage: func(t *testing.T, file string) {},
+			want:   []string{"a", "b"},
+		},
+		{
+			name: "corrupted live file",
+			damage: func(t *testing.T, file string) {
+				if err := os.WriteFile(file, []byte("PAR1 not parquet"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"a"},
+		},
+		{
+			name: "truncated live file",
+			damage: func(t *testing.T, file string) {
+				if err := os.Truncate(file, 20); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"a"},
+		},
+		{
+			name: "every generation corrupted",
+			damage: func(t *testing.T, file string) {
+				for _, damaged := range []string{file, generationFile(file, 1), generationFile(file, 2)} {
+					if err := os.WriteFile(damaged, []byte("garbage"), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "interrupted write",
+			damage: func(t *testing.T, file string) {
+				if err := os.WriteFile(file+".tmp", []byte("half written"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"a", "b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "test.parquet")
+			writeTestParquet(t, file, testRecord{UUID: "empty"})
+			writeTestParquet(t, file, testRecord{UUID: "a"})
+			writeTestParquet(t, file, testRecord{UUID: "a"}, testRecord{UUID: "b"})
+			test.damage(t, file)
+
+			repository, err := NewParquetRepository[testRecord]("test", file)
+			if test.wantErr {
+				if err == nil {
+					_ = repository.Close()
+					t.Fatal("a catalog without any readable generation is opened")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer repository.Close()
+
+			if got := uuids(t, repository); !slices.Equal(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+			if _, err := os.Stat(file + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("the temporary file is left behind: %v", err)
+			}
+			// The recovered generation replaces the damaged live file.
+			if items, err := ReadParquet[testRecord](file); err != nil || len(items) != len(test.want) {
+				t.Errorf("live file holds %d records, error %v", len(items), err)
+			}
+		})
+	}
+}
+
+func TestParquetTornChangeLog(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.parquet")
+	repository := openTestParquet(t, file)
+	for _, uuid := range []string{"a", "b"} {
+		if err := repository.Insert(testRecord{UUID: uuid}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A crash while appending leaves the last batch cut short.
+	log, err := os.OpenFile(file+".wal", os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.WriteString(`[{"op":"insert","uuid":"c","rec`); err != nil {
+		t.Fatal(err)
+	}
+	_ = log.Close()
+
+	reopened := openTestParquet(t, file)
+	if got := uuids(t, reopened); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("got %v, want the torn batch discarded", got)
+	}
+	if err := reopened.Insert(testRecord{UUID: "d"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The changes appended after the torn batch are not hidden behind it.
+	again := openTestParquet(t, file)
+	defer again.Close()
+	if got := uuids(t, again); !slices.Equal(got, []string{"a", "b", "d"}) {
+		t.Fatalf("got %v after appending past the torn batch", got)
+	}
+}
@@ -0,0 +1,55 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/configs"
+)
+
+var ErrNotFound = errors.New("record not found")
+var ErrAlreadyExists = errors.New("record already exists")
+
+type Record interface {
+	GetUUID() string
+}
+
+type Repository[T Record] interface {
+	Get(uuid string) (T, error)
+	List() ([]T, error)
+	Insert(record T) error
+	Update(record T) error
+	Delete(uuid string) error
+	// Transaction runs fn against a view of the repository; the changes made through
+	// that view are persisted all at once if fn returns nil and discarded otherwise.
+	Transaction(fn func(tx Repository[T]) error) error
+	Close() error
+}
+
+type Backend string
+
+const (
+	ParquetBackend Backend = "parquet"
+	SQLiteBackend  Backend = "sqlite"
+	MemoryBackend  Backend = "memory"
+)
+
+func Open[T Record](name string, parquetFile string) (Repository[T], error) {
+	switch Backend(configs.CatalogBackend) {
+	case ParquetBackend:
+		repository, err := NewParquetRepository[T](name, parquetFile)
+		if err != nil {
+			return nil, err
+		}
+		return repository, nil
+	case SQLiteBackend:
+		repository, err := NewSQLiteRepository[T](configs.SQLiteDatabaseFile, name)
+		if err != nil {
+			return nil, err
+		}
+		return repository, nil
+	case MemoryBackend:
+		return NewMemoryRepository[T](), nil
+	default:
+		return nil, fmt.Errorf("unknown catalog backend: %s", configs.CatalogBackend)
+	}
+}
@@ -0,0 +1,210 @@
+package catalog
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+type testBackend struct {
+	name string
+	// open opens the repository stored in dir, the memory backend starts empty each time.
+	open       func(t *testing.T, dir string) Repository[testRecord]
+	persistent bool
+}
+
+var testBackends = []testBackend{
+	{name: "memory", open: func(t *testing.T, dir string) Repository[testRecord] {
+		return NewMemoryRepository[testRecord]()
+	}},
+	{name: "parquet", persistent: true, open: func(t *testing.T, dir string) Repository[testRecord] {
+		return openTestParquet(t, filepath.Join(dir, "test.parquet"))
+	}},
+	{name: "sqlite", persistent: true, open: func(t *testing.T, dir string) Repository[testRecord] {
+		repository, err := NewSQLiteRepository[testRecord](filepath.Join(dir, "test.sqlite"), "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repository
+	}},
+}
+
+func uuids(t *testing.T, repository Repository[testRecord]) []string {
+	t.Helper()
+	items, err := repository.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uuids []string
+	for _, item := range items {
+		uuids = append(uuids, item.UUID)
+	}
+	return uuids
+}
+
+func TestRepository(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			dir := t.TempDir()
+			repository := backend.open(t, dir)
+			defer func() { _ = repository.Close() }()
+
+			for _, uuid := range []string{"c", "a", "b"} {
+				if err := repository.Insert(testRecord{UUID: uuid, Title: uuid}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := uuids(t, repository); !slices.Equal(got, []string{"c", "a", "b"}) {
+				t.Errorf("got %v, want the insertion order", got)
+			}
+
+			errorTests := []struct {
+				name    string
+				run     func() error
+				wantErr error
+			}{
+				{name: "insert existing", run: func() error { return repository.Insert(testRecord{UUID: "a"}) }, wantErr: ErrAlreadyExists},
+				{name: "update missing", run: func() error { return repository.Update(testRecord{UUID: "z"}) }, wantErr: ErrNotFound},
+				{name: "delete missing", run: func() error { return repository.Delete("z") }, wantErr: ErrNotFound},
+				{name: "get missing", run: func() error { _, err := repository.Get("z"); return err }, wantErr: ErrNotFound},
+			}
+			for _, test := range errorTests {
+				if err := test.run(); !errors.Is(err, test.wantErr) {
+					t.Errorf("%s: got error %v, want %v", test.name, err, test.wantErr)
+				}
+			}
+
+			if err := repository.Update(testRecord{UUID: "a", Title: "updated"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := repository.Delete("c"); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := repository.Get("a"); err != nil || got.Title != "updated" {
+				t.Errorf("got %v, %v, want the updated record", got, err)
+			}
+			if got := uuids(t, repository); !slices.Equal(got, []string{"a", "b"}) {
+				t.Errorf("got %v after deleting c", got)
+			}
+
+			if !backend.persistent {
+				return
+			}
+			if err := repository.Close(); err != nil {
+				t.Fatal(err)
+			}
+			repository = backend.open(t, dir)
+			if got := uuids(t, repository); !slices.Equal(got, []string{"a", "b"}) {
+				t.Errorf("got %v after reopening", got)
+			}
+			if got, _ := repository.Get("a"); got.Title != "updated" {
+				t.Errorf("got %v after reopening, want the updated record", got)
+			}
+		})
+	}
+}
+
+func TestRepositoryTransaction(t *testing.T) {
+	errAborted := errors.New("aborted")
+
+	tests := []struct {
+		name    string
+		fn      func(tx Repository[testRecord]) error
+		wantErr error
+		want    []string
+	}{
+		{
+			name: "committed",
+			fn: func(tx Repository[testRecord]) error {
+				if err := tx.Insert(testRecord{UUID: "b"}); err != nil {
+					return err
+				}
+				return tx.Delete("a")
+			},
+			want: []string{"b"},
+		},
+		{
+			name: "rolled back",
+			fn: func(tx Repository[testRecord]) error {
+				if err := tx.Insert(testRecord{UUID: "b"}); err != nil {
+					return err
+				}
+				if err := tx.Delete("a"); err != nil {
+					return err
+				}
+				return errAborted
+			},
+			wantErr: errAborted,
+			want:    []string{"a"},
+		},
+		{
+			name: "failed operation rolled back",
+			fn: func(tx Repository[testRecord]) error {
+				if err := tx.Insert(testRecord{UUID: "b"}); err != nil {
+					return err
+				}
+				return tx.Insert(testRecord{UUID: "a"})
+			},
+			wantErr: ErrAlreadyExists,
+			want:    []string{"a"},
+		},
+		{
+			name: "nested",
+			fn: func(tx Repository[testRecord]) error {
+				return tx.Transaction(func(nested Repository[testRecord]) error {
+					return nested.Insert(testRecord{UUID: "b"})
+				})
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "reads its own changes",
+			fn: func(tx Repository[testRecord]) error {
+				if err := tx.Insert(testRecord{UUID: "b"}); err != nil {
+					return err
+				}
+				if _, err := tx.Get("b"); err != nil {
+					return err
+				}
+				items, err := tx.List()
+				if err != nil || len(items) != 2 {
+					return errors.New("the transaction does not list its own insert")
+				}
+				return nil
+			},
+			want: []string{"a", "b"},
+		},
+	}
+
+	for _, backend := range testBackends {
+		for _, test := range tests {
+			t.Run(backend.name+" "+test.name, func(t *testing.T) {
+				dir := t.TempDir()
+				repository := backend.open(t, dir)
+				defer func() { _ = repository.Close() }()
+				if err := repository.Insert(testRecord{UUID: "a"}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := repository.Transaction(test.fn); !errors.Is(err, test.wantErr) {
+					t.Fatalf("got error %v, want %v", err, test.wantErr)
+				}
+				if got := uuids(t, repository); !slices.Equal(got, test.want) {
+					t.Fatalf("got %v, want %v", got, test.want)
+				}
+
+				if !backend.persistent {
+					return
+				}
+				if err := repository.Close(); err != nil {
+					t.Fatal(err)
+				}
+				repository = backend.open(t, dir)
+				if got := uuids(t, repository); !slices.Equal(got, test.want) {
+					t.Fatalf("got %v after reopening, want %v", got, test.want)
+				}
+			})
+		}
+	}
+}
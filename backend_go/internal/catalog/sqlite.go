@@ -0,0 +1,163 @@
+package catalog
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	_ "modernc.org/sqlite"
+	"regexp"
+)
+
+var tableNamePattern = regexp.MustCompile(`^[a-z_]+$`)
+
+type sqlExecutor interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// SQLiteRepository stores each record as a JSON document keyed by its UUID, the
+// position column keeps the insertion order the parquet backend naturally has.
+type SQLiteRepository[T Record] struct {
+	db       *sql.DB
+	executor sqlExecutor
+	table    string
+}
+
+func NewSQLiteRepository[T Record](file string, table string) (*SQLiteRepository[T], error) {
+	if !tableNamePattern.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name: %s", table)
+	}
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)", file))
+	if err != nil {
+		return nil, fmt.Errorf("cannot open database file %s: %w", file, err)
+	}
+	db.SetMaxOpenConns(1)
+
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (position INTEGER PRIMARY KEY AUTOINCREMENT, uuid TEXT NOT NULL UNIQUE, data TEXT NOT NULL)", table)
+	if _, err := db.Exec(query); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("cannot create table %s: %w", table, err)
+	}
+
+	return &SQLiteRepository[T]{db: db, executor: db, table: table}, nil
+}
+
+func (s *SQLiteRepository[T]) Get(uuid string) (T, error) {
+	var record T
+	var data string
+
+	err := s.executor.QueryRow(fmt.Sprintf("SELECT data FROM %s WHERE uuid = ?", s.table), uuid).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return record, fmt.Errorf("%w: %s", ErrNotFound, uuid)
+	}
+	if err != nil {
+		return record, err
+	}
+
+	err = json.Unmarshal([]byte(data), &record)
+	return record, err
+}
+
+func (s *SQLiteRepository[T]) List() ([]T, error) {
+	rows, err := s.executor.Query(fmt.Sprintf("SELECT data FROM %s ORDER BY position", s.table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []T
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var record T
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			return nil, err
+		}
+		items = append(items, record)
+	}
+
+	return items, rows.Err()
+}
+
+func (s *SQLiteRepository[T]) Insert(record T) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	var exists int
+	err = s.executor.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE uuid = ?", s.table), record.GetUUID()).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		return fmt.Errorf("%w: %s", ErrAlreadyExists, record.GetUUID())
+	}
+
+	_, err = s.executor.Exec(fmt.Sprintf("INSERT INTO %s (uuid, data) VALUES (?, ?)", s.table), record.GetUUID(), string(data))
+	return err
+}
+
+func (s *SQLiteRepository[T]) Update(record T) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.executor.Exec(fmt.Sprintf("UPDATE %s SET data = ? WHERE uuid = ?", s.table), string(data), record.GetUUID())
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, record.GetUUID())
+}
+
+func (s *SQLiteRepository[T]) Delete(uuid string) error {
+	result, err := s.executor.Exec(fmt.Sprintf("DELETE FROM %s WHERE uuid = ?", s.table), uuid)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, uuid)
+}
+
+func (s *SQLiteRepository[T]) Transaction(fn func(tx Repository[T]) error) error {
+	if s.db == nil {
+		// Already inside a transaction, SQLite has no nested transactions.
+		return fn(s)
+	}
+
+	sqlTx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(&SQLiteRepository[T]{executor: sqlTx, table: s.table}); err != nil {
+		_ = sqlTx.Rollback()
+		return err
+	}
+
+	return sqlTx.Commit()
+}
+
+func (s *SQLiteRepository[T]) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+func expectAffected(result sql.Result, uuid string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, uuid)
+	}
+	return nil
+}
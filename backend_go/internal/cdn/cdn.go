@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"strings"
 )
 
 type ImageSize string
@@ -59,7 +60,12 @@ func HandleGetImage(c *gin.Context) {
 		size = Thumb
 	}
 
-	fmt.Println(uuid, ext, size)
+	// Only the renditions are served, ext must not lead out of their directory.
+	if strings.ContainsAny(uuid+ext, `/\`) || strings.Contains(uuid+ext, "..") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+
 	imagePath, err := GetImagePath(uuid, ext, size)
 	if err != nil {
 		fmt.Println(err)
@@ -73,4 +79,5 @@ func HandleGetImage(c *gin.Context) {
 func BindRoutes(engine *gin.Engine, adminGroup *gin.RouterGroup) {
 	cdnRouter := engine.Group("/cdn")
 	cdnRouter.GET("/:uuid", HandleGetImage)
+	cdnRouter.GET("/:uuid/tiles/*path", HandleGetTile)
 }
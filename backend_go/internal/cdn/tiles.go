@@ -0,0 +1,330 @@
+package cdn
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/gin-gonic/gin"
+	"image"
+	"math/bits"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The tiles of a picture are stored in the Deep Zoom layout, DZIFile describing the
+// pyramid and image_files/<level>/<column>_<row>.jpg holding the tiles. The tiles do not
+// overlap, so the IIIF image requests are mapped to them as well.
+const DZIFile = "image.dzi"
+const TileFormat = "jpg"
+const dziFolder = "image_files"
+
+var ErrNoTiles = errors.New("picture has no tiles")
+
+var iiifRequest = regexp.MustCompile(`^/iiif/([^/]+)/([^/]+)/0/default\.jpg$`)
+
+// Pyramid is the layout of the tiles of an image, level 0 is a single pixel and each
+// level doubles the size of the previous one up to the size of the image.
+type Pyramid struct {
+	Width    int
+	Height   int
+	TileSize int
+}
+
+func NewPyramid(width int, height int) Pyramid {
+	return Pyramid{Width: width, Height: height, TileSize: configs.TileSize}
+}
+
+// MaxLevel is the level at the size of the image.
+func (p Pyramid) MaxLevel() int {
+	return bits.Len(uint(max(p.Width, p.Height) - 1))
+}
+
+// LevelSize returns the size of the image at level, halved from the level above and
+// rounded up.
+func (p Pyramid) LevelSize(level int) (int, int) {
+	scale := 1 << (p.MaxLevel() - level)
+	return ceilDiv(p.Width, scale), ceilDiv(p.Height, scale)
+}
+
+// Tiles returns the number of columns and rows of tiles at level.
+func (p Pyramid) Tiles(level int) (int, int) {
+	width, height := p.LevelSize(level)
+	return ceilDiv(width, p.TileSize), ceilDiv(height, p.TileSize)
+}
+
+// TileBounds returns the area of the image at level a tile covers, the tiles of the
+// last column and row are cut to the size of the image.
+func (p Pyramid) TileBounds(level int, column int, row int) image.Rectangle {
+	width, height := p.LevelSize(level)
+	x, y := column*p.TileSize, row*p.TileSize
+	return image.Rect(x, y, min(x+p.TileSize, width), min(y+p.TileSize, height))
+}
+
+func ceilDiv(a int, b int) int {
+	return (a + b - 1) / b
+}
+
+func TilesPath(uuid string) string {
+	return path.Join(configs.TilesDir, uuid)
+}
+
+// TilePath returns the file of a tile in the tiles directory dir.
+func TilePath(dir string, level int, column int, row int) string {
+	return path.Join(dir, dziFolder, strconv.Itoa(level), fmt.Sprintf("%d_%d.%s", column, row, TileFormat))
+}
+
+type dziImage struct {
+	XMLName  xml.Name `xml:"http://schemas.microsoft.com/deepzoom/2008 Image"`
+	Format   string   `xml:"Format,attr"`
+	Overlap  int      `xml:"Overlap,attr"`
+	TileSize int      `xml:"TileSize,attr"`
+	Size     struct {
+		Width  int `xml:"Width,attr"`
+		Height int `xml:"Height,attr"`
+	} `xml:"Size"`
+}
+
+// DZI returns the Deep Zoom descriptor of the pyramid.
+func (p Pyramid) DZI() ([]byte, error) {
+	descriptor := dziImage{Format: TileFormat, TileSize: p.TileSize}
+	descriptor.Size.Width, descriptor.Size.Height = p.Width, p.Height
+	data, err := xml.MarshalIndent(descriptor, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// TilesVersion identifies the pyramid of the tiles of a picture as written, it changes
+// each time they are written again: a new rendition version, a forced rebuild or a
+// reprocess. The tiles are served under it and cached for a long time.
+func TilesVersion(uuid string) (string, error) {
+	info, err := os.Stat(path.Join(TilesPath(uuid), DZIFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNoTiles
+	}
+	if err != nil {
+		return "", err
+	}
+	return "v" + strconv.FormatInt(info.ModTime().UnixNano(), 36), nil
+}
+
+// TilesURL returns the URL of the directory of the tiles of a picture at version.
+func TilesURL(uuid string, version string) string {
+	return "/cdn/" + uuid + "/tiles/" + version + "/"
+}
+
+// ReadPyramid reads the pyramid of the tiles of a picture from their descriptor.
+func ReadPyramid(uuid string) (Pyramid, error) {
+	data, err := os.ReadFile(path.Join(TilesPath(uuid), DZIFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return Pyramid{}, ErrNoTiles
+	}
+	if err != nil {
+		return Pyramid{}, err
+	}
+
+	var descriptor dziImage
+	if err := xml.Unmarshal(data, &descriptor); err != nil {
+		return Pyramid{}, fmt.Errorf("invalid tiles descriptor of %s: %w", uuid, err)
+	}
+	if descriptor.Size.Width < 1 || descriptor.Size.Height < 1 || descriptor.TileSize < 1 || descriptor.Overlap != 0 {
+		return Pyramid{}, fmt.Errorf("invalid tiles descriptor of %s", uuid)
+	}
+	return Pyramid{Width: descriptor.Size.Width, Height: descriptor.Size.Height, TileSize: descriptor.TileSize}, nil
+}
+
+// IIIFInfo is the info.json of a level 0 IIIF Image API 3 service.
+type IIIFInfo struct {
+	Context  string      `json:"@context"`
+	ID       string      `json:"id"`
+	Type     string      `json:"type"`
+	Protocol string      `json:"protocol"`
+	Profile  string      `json:"profile"`
+	Width    int         `json:"width"`
+	Height   int         `json:"height"`
+	Tiles    []IIIFTiles `json:"tiles"`
+	Sizes    []IIIFSize  `json:"sizes"`
+}
+
+type IIIFTiles struct {
+	Width        int   `json:"width"`
+	ScaleFactors []int `json:"scaleFactors"`
+}
+
+type IIIFSize struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// IIIF describes the pyramid as the IIIF service id: the tiles at each scale factor,
+// and the sizes at which the whole image fits in a single tile.
+func (p Pyramid) IIIF(id string) IIIFInfo {
+	info := IIIFInfo{
+		Context:  "http://iiif.io/api/image/3/context.json",
+		ID:       id,
+		Type:     "ImageService3",
+		Protocol: "http://iiif.io/api/image",
+		Profile:  "level0",
+		Width:    p.Width,
+		Height:   p.Height,
+		Sizes:    make([]IIIFSize, 0),
+	}
+
+	tiles := IIIFTiles{Width: p.TileSize}
+	for level := 0; level <= p.MaxLevel(); level++ {
+		tiles.ScaleFactors = append(tiles.ScaleFactors, 1<<(p.MaxLevel()-level))
+		if columns, rows := p.Tiles(level); columns == 1 && rows == 1 {
+			width, height := p.LevelSize(level)
+			info.Sizes = append(info.Sizes, IIIFSize{Width: width, Height: height})
+		}
+	}
+	slices.Reverse(tiles.ScaleFactors)
+	info.Tiles = []IIIFTiles{tiles}
+	return info
+}
+
+// IIIFTile finds the tile answering a IIIF image request, a level 0 service only gives
+// the regions and sizes of its tiles.
+func (p Pyramid) IIIFTile(region string, size string) (int, int, int, bool) {
+	x, y, width, height := 0, 0, p.Width, p.Height
+	if region != "full" {
+		values, ok := parseInts(region, 4)
+		if !ok {
+			return 0, 0, 0, false
+		}
+		x, y, width, height = values[0], values[1], values[2], values[3]
+	}
+
+	for level := p.MaxLevel(); level >= 0; level-- {
+		scale := 1 << (p.MaxLevel() - level)
+		span := p.TileSize * scale
+		if x%span != 0 || y%span != 0 || x >= p.Width || y >= p.Height {
+			continue
+		}
+		if width != min(span, p.Width-x) || height != min(span, p.Height-y) {
+			continue
+		}
+
+		column, row := x/span, y/span
+		bounds := p.TileBounds(level, column, row)
+		if matchesSize(size, bounds.Dx(), bounds.Dy(), scale) {
+			return level, column, row, true
+		}
+	}
+	return 0, 0, 0, false
+}
+
+// matchesSize tells whether the size of a IIIF request, max, w, or w,h, is the size of
+// a tile.
+func matchesSize(size string, width int, height int, scale int) bool {
+	if size == "max" {
+		return scale == 1
+	}
+	if requested, ok := strings.CutSuffix(size, ","); ok {
+		values, ok := parseInts(requested, 1)
+		return ok && values[0] == width
+	}
+	values, ok := parseInts(size, 2)
+	return ok && values[0] == width && values[1] == height
+}
+
+func parseInts(raw string, count int) ([]int, bool) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != count {
+		return nil, false
+	}
+	values := make([]int, 0, count)
+	for _, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+	return values, true
+}
+
+// requestOrigin returns the scheme and host the request was sent to, the IIIF ids must
+// be absolute.
+func requestOrigin(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// HandleGetTile serves the tiles of a picture under their version: the Deep Zoom
+// descriptor and tiles as stored, the IIIF info.json, and the IIIF image requests mapped
+// to the tiles. The URLs of a version never change content, they are cached for a long
+// time, and the ones of an older version are gone.
+func HandleGetTile(c *gin.Context) {
+	uuid := c.Param("uuid")
+	version, file, _ := strings.Cut(strings.TrimPrefix(c.Param("path"), "/"), "/")
+	file = "/" + file
+
+	// Only the tiles are served, the path must not lead out of their directory.
+	if strings.ContainsAny(uuid, `/\`) || strings.Contains(uuid+file, "..") || strings.Contains(file, `\`) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+
+	current, err := TilesVersion(uuid)
+	if errors.Is(err, ErrNoTiles) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
+	if version != current {
+		c.JSON(http.StatusNotFound, gin.H{"error": "tiles version not found"})
+		return
+	}
+	cacheControl := fmt.Sprintf("public, max-age=%d, immutable", int(configs.TilesMaxAge.Seconds()))
+
+	if file == "/iiif/info.json" || iiifRequest.MatchString(file) {
+		pyramid, err := ReadPyramid(uuid)
+		if errors.Is(err, ErrNoTiles) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			c.Status(500)
+			return
+		}
+
+		if file == "/iiif/info.json" {
+			c.Header("Cache-Control", cacheControl)
+			c.Header("Content-Type", `application/ld+json;profile="http://iiif.io/api/image/3/context.json"`)
+			c.JSON(http.StatusOK, pyramid.IIIF(requestOrigin(c)+TilesURL(uuid, version)+"iiif"))
+			return
+		}
+
+		request := iiifRequest.FindStringSubmatch(file)
+		level, column, row, ok := pyramid.IIIFTile(request[1], request[2])
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only the tiles listed in info.json are available"})
+			return
+		}
+		file = strings.TrimPrefix(TilePath("", level, column, row), "/")
+	}
+
+	tilePath := path.Join(TilesPath(uuid), file)
+	if info, err := os.Stat(tilePath); err != nil || info.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	c.Header("Cache-Control", cacheControl)
+	c.File(tilePath)
+}
@@ -0,0 +1,89 @@
+package cdn
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestTiles writes the descriptor and the single tile of a picture of 10x10 pixels,
+// modified at the given time.
+func writeTestTiles(t *testing.T, uuid string, modified time.Time) {
+	t.Helper()
+	pyramid := NewPyramid(10, 10)
+	tile := TilePath(TilesPath(uuid), pyramid.MaxLevel(), 0, 0)
+	if err := os.MkdirAll(path.Dir(tile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tile, []byte("tile"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	descriptor, err := pyramid.DZI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dzi := path.Join(TilesPath(uuid), DZIFile)
+	if err := os.WriteFile(dzi, descriptor, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(dzi, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleGetTileVersions(t *testing.T) {
+	t.Chdir(t.TempDir())
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	BindRoutes(engine, engine.Group("/admin"))
+
+	writeTestTiles(t, "picture", time.Unix(1000, 0))
+	stale, err := TilesVersion("picture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The pyramid is written again, by a forced rebuild or a reprocess.
+	writeTestTiles(t, "picture", time.Unix(2000, 0))
+	current, err := TilesVersion("picture")
+	if err != nil || current == stale {
+		t.Fatalf("got version %q, error %v, after writing the tiles again over %q", current, err, stale)
+	}
+
+	tile := strings.TrimPrefix(TilePath("", NewPyramid(10, 10).MaxLevel(), 0, 0), "/")
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+	}{
+		{name: "descriptor", target: TilesURL("picture", current) + DZIFile, wantStatus: http.StatusOK},
+		{name: "tile", target: TilesURL("picture", current) + tile, wantStatus: http.StatusOK},
+		{name: "iiif info", target: TilesURL("picture", current) + "iiif/info.json", wantStatus: http.StatusOK},
+		{name: "iiif tile", target: TilesURL("picture", current) + "iiif/full/max/0/default.jpg", wantStatus: http.StatusOK},
+		{name: "stale descriptor", target: TilesURL("picture", stale) + DZIFile, wantStatus: http.StatusNotFound},
+		{name: "stale iiif info", target: TilesURL("picture", stale) + "iiif/info.json", wantStatus: http.StatusNotFound},
+		{name: "without version", target: "/cdn/picture/tiles/" + DZIFile, wantStatus: http.StatusNotFound},
+		{name: "unknown picture", target: TilesURL("other", current) + DZIFile, wantStatus: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, httptest.NewRequest("GET", test.target, nil))
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("got status %d, want %d", recorder.Code, test.wantStatus)
+			}
+			immutable := strings.Contains(recorder.Header().Get("Cache-Control"), "immutable")
+			if immutable != (recorder.Code == http.StatusOK) {
+				t.Fatalf("got Cache-Control %q with status %d", recorder.Header().Get("Cache-Control"), recorder.Code)
+			}
+			if test.name == "iiif info" && !strings.Contains(recorder.Body.String(), TilesURL("picture", current)+"iiif") {
+				t.Fatalf("the IIIF id is not under the version of the tiles: %s", recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/evanespen/vanespen.art_2025/internal/pictures"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// StashPath returns a unique path in the stash for an uploaded file, only the base
+// name of the client provided filename is kept.
+func StashPath(filename string) string {
+	return path.Join(configs.StashDir, uuid.New().String()+"-"+filepath.Base(filename))
+}
+
+func stashUploads(c *gin.Context, files []*multipart.FileHeader) ([]StashedFile, []pictures.UploadResult) {
+	var stashed []StashedFile
+	var failed []pictures.UploadResult
+
+	for _, file := range files {
+		filename := filepath.Base(file.Filename)
+		stashImagePath := StashPath(filename)
+
+		if err := c.SaveUploadedFile(file, stashImagePath); err != nil {
+			fmt.Println(err)
+			failed = append(failed, pictures.UploadResult{Filename: filename, Status: pictures.UploadFailed, Reason: "unable to save uploaded file"})
+			continue
+		}
+		stashed = append(stashed, StashedFile{Filename: filename, StashPath: stashImagePath})
+	}
+
+	return stashed, failed
+}
+
+// UploadPictures stashes the uploaded files and queues them for ingest, the response
+// is the job to follow. With ?sync=true the files are ingested within the request and
+// the per-file results are returned directly.
+func UploadPictures(c *gin.Context) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expected a multipart form with files"})
+		return
+	}
+	files := form.File["files"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no files uploaded"})
+		return
+	}
+
+	if err := os.MkdirAll(configs.StashDir, 0755); err != nil {
+		fmt.Println(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	stashed, results := stashUploads(c, files)
+
+	if c.Query("sync") == "true" {
+		for _, file := range stashed {
+			result := pictures.Ingest(file.StashPath, file.Filename)
+			_ = os.Remove(file.StashPath)
+
+			fmt.Println(fmt.Sprintf("%s process %s", file.StashPath, result.Status))
+			results = append(results, result)
+		}
+
+		c.JSON(pictures.UploadStatusCode(results), gin.H{"files": results})
+		return
+	}
+
+	respondWithJob(c, stashed, results)
+}
+
+// respondWithJob queues the stashed files and answers 202 with the job, files which
+// could not be stashed are reported in failed.
+func respondWithJob(c *gin.Context, stashed []StashedFile, failed []pictures.UploadResult) {
+	if len(stashed) == 0 {
+		c.JSON(pictures.UploadStatusCode(failed), gin.H{"files": failed})
+		return
+	}
+
+	job, err := Enqueue(stashed)
+	if errors.Is(err, ErrQueueFull) || errors.Is(err, ErrQueueStopped) {
+		for _, file := range stashed {
+			_ = os.Remove(file.StashPath)
+		}
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Location", "/admin/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, gin.H{"job": job, "failed": failed})
+}
+
+func GetOneJob(c *gin.Context) {
+	job, ok := GetJob(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"job": job, "results": job.Results()})
+}
+
+// StreamJob sends the job state then its progress events as Server-Sent Events until
+// every file reached a final stage.
+func StreamJob(c *gin.Context) {
+	job, events, unsubscribe, ok := queue.Subscribe(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	defer unsubscribe()
+
+	c.SSEvent("job", job)
+	if job.Status == JobDone {
+		return
+	}
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-events:
+			c.SSEvent("progress", event)
+			return event.JobStatus != JobDone
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func BindRoutes(engine *gin.Engine, adminGroup *gin.RouterGroup) {
+	adminGroup.POST("/pictures", UploadPictures)
+	adminGroup.POST("/pictures/archive", UploadArchive)
+	adminGroup.GET("/jobs/:id", GetOneJob)
+	adminGroup.GET("/jobs/:id/events", StreamJob)
+}
@@ -0,0 +1,338 @@
+package ingest
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/evanespen/vanespen.art_2025/internal/pictures"
+	"github.com/gin-gonic/gin"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrArchiveTooLarge is returned when an archive goes over the extraction limits, which
+// is how archive bombs are detected.
+var ErrArchiveTooLarge = errors.New("archive exceeds the extraction limits")
+
+// ratioCheckedSize is the size past which the data is checked against
+// configs.MaxArchiveRatio, small files legitimately compress very well.
+const ratioCheckedSize = 1 << 20
+
+var zipMagic = []byte("PK\x03\x04")
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// extractor ingests the entries of an archive one at a time, each entry is only on
+// disk while it is being ingested.
+type extractor struct {
+	entries   int
+	extracted int64
+	results   []pictures.UploadResult
+}
+
+// limitedReader fails with ErrArchiveTooLarge instead of stopping silently at the limit,
+// the data may be exactly as large as the limit.
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if l.remaining <= 0 {
+		// At the limit, the data is only too large if more of it follows.
+		var probe [1]byte
+		n, err := l.reader.Read(probe[:])
+		if n > 0 {
+			return 0, ErrArchiveTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.reader.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// countingReader counts the bytes read from the compressed archive.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// ratioReader fails with ErrArchiveTooLarge once the data decompressed goes over
+// configs.MaxArchiveRatio times the compressed data read, as the zip entries do.
+type ratioReader struct {
+	reader       io.Reader
+	compressed   *countingReader
+	decompressed int64
+}
+
+func (r *ratioReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.decompressed += int64(n)
+	if r.decompressed > ratioCheckedSize && r.decompressed > r.compressed.count*configs.MaxArchiveRatio {
+		return n, ErrArchiveTooLarge
+	}
+	return n, err
+}
+
+// unsafeEntry tells whether the entry name would escape the extraction directory.
+func unsafeEntry(name string) bool {
+	return !filepath.IsLocal(strings.ReplaceAll(name, `\`, "/"))
+}
+
+// ignoredEntry tells whether the entry is not a picture to ingest: unsupported formats,
+// hidden files and the metadata macOS adds to the archives it creates.
+func ignoredEntry(name string) bool {
+	name = strings.ReplaceAll(name, `\`, "/")
+	return !pictures.IsSupportedImage(name) || strings.HasPrefix(path.Base(name), ".") || strings.HasPrefix(name, "__MACOSX/")
+}
+
+// add handles one entry, body is only read for the regular files which are ingested.
+func (e *extractor) add(name string, regular bool, body io.Reader) error {
+	e.entries++
+	if e.entries > configs.MaxArchiveEntries {
+		return ErrArchiveTooLarge
+	}
+
+	if unsafeEntry(name) {
+		e.results = append(e.results, pictures.UploadResult{Filename: name, Status: pictures.UploadRejected, Reason: "unsafe path in archive"})
+		return nil
+	}
+	if ignoredEntry(name) {
+		return nil
+	}
+	if !regular {
+		e.results = append(e.results, pictures.UploadResult{Filename: name, Status: pictures.UploadRejected, Reason: "not a regular file"})
+		return nil
+	}
+
+	stashImagePath := StashPath(name)
+	written, err := e.stash(stashImagePath, body)
+	e.extracted += written
+	if err != nil {
+		_ = os.Remove(stashImagePath)
+		if errors.Is(err, ErrArchiveTooLarge) {
+			return err
+		}
+		fmt.Println(err)
+		e.results = append(e.results, pictures.UploadResult{Filename: name, Status: pictures.UploadFailed, Reason: "unable to extract file"})
+		return nil
+	}
+
+	result := pictures.Ingest(stashImagePath, name)
+	_ = os.Remove(stashImagePath)
+
+	fmt.Println(fmt.Sprintf("%s process %s", name, result.Status))
+	e.results = append(e.results, result)
+	return nil
+}
+
+func (e *extractor) stash(stashImagePath string, body io.Reader) (int64, error) {
+	file, err := os.Create(stashImagePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	limit := min(int64(configs.MaxArchiveEntrySize), configs.MaxUploadSize-e.extracted)
+	return io.Copy(file, &limitedReader{reader: body, remaining: limit})
+}
+
+func (e *extractor) extractTar(reader io.Reader) error {
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		if err := e.add(header.Name, header.FileInfo().Mode().IsRegular(), tarReader); err != nil {
+			return err
+		}
+	}
+}
+
+// extractTarGzip extracts a gzipped tar, bounded by the size of the uploads and by the
+// compression ratio, a small archive must not spool gigabytes to the stash.
+func (e *extractor) extractTarGzip(reader io.Reader) error {
+	compressed := &countingReader{reader: reader}
+	gzipReader, err := gzip.NewReader(compressed)
+	if err != nil {
+		return err
+	}
+	decompressed := &ratioReader{reader: gzipReader, compressed: compressed}
+	return e.extractTar(&limitedReader{reader: decompressed, remaining: configs.MaxUploadSize})
+}
+
+// extractZip spools the archive itself to the stash as the zip directory is at its end,
+// the entries are then extracted one at a time.
+func (e *extractor) extractZip(reader io.Reader) error {
+	spool, err := os.CreateTemp(configs.StashDir, "archive-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	size, err := io.Copy(spool, reader)
+	if err != nil {
+		return err
+	}
+
+	zipReader, err := zip.NewReader(spool, size)
+	if err != nil {
+		return err
+	}
+	if err := checkZip(zipReader); err != nil {
+		return err
+	}
+
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		err := e.addZipFile(file)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *extractor) addZipFile(file *zip.File) error {
+	if !file.Mode().IsRegular() || unsafeEntry(file.Name) || ignoredEntry(file.Name) {
+		return e.add(file.Name, false, nil)
+	}
+
+	body, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return e.add(file.Name, true, body)
+}
+
+// checkZip rejects archive bombs from the sizes declared in the zip directory before
+// anything is extracted, the sizes are enforced again while extracting.
+func checkZip(zipReader *zip.Reader) error {
+	if len(zipReader.File) > configs.MaxArchiveEntries {
+		return ErrArchiveTooLarge
+	}
+
+	var total uint64
+	for _, file := range zipReader.File {
+		if ignoredEntry(file.Name) {
+			continue
+		}
+		if file.UncompressedSize64 > configs.MaxArchiveEntrySize {
+			return ErrArchiveTooLarge
+		}
+		if file.UncompressedSize64 > ratioCheckedSize && file.UncompressedSize64 > file.CompressedSize64*configs.MaxArchiveRatio {
+			return ErrArchiveTooLarge
+		}
+		total += file.UncompressedSize64
+	}
+	if total > configs.MaxUploadSize {
+		return ErrArchiveTooLarge
+	}
+	return nil
+}
+
+// archiveBody returns the archive sent either as the request body or as the archive
+// field of a multipart form, without buffering the form.
+func archiveBody(c *gin.Context) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return c.Request.Body, nil
+	}
+
+	multipartReader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := multipartReader.NextPart()
+		if err != nil {
+			return nil, errors.New("expected an archive field in the multipart form")
+		}
+		if part.FormName() == "archive" {
+			return part, nil
+		}
+	}
+}
+
+// UploadArchive ingests the images of a ZIP, tar or gzipped tar archive and returns the
+// per-file results like UploadPictures does with ?sync=true.
+func UploadArchive(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, configs.MaxUploadSize)
+
+	body, err := archiveBody(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := os.MkdirAll(configs.StashDir, 0755); err != nil {
+		fmt.Println(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	reader := bufio.NewReader(body)
+	magic, _ := reader.Peek(len(zipMagic))
+
+	var e extractor
+	switch {
+	case bytes.HasPrefix(magic, zipMagic):
+		err = e.extractZip(reader)
+	case bytes.HasPrefix(magic, gzipMagic):
+		err = e.extractTarGzip(reader)
+	default:
+		err = e.extractTar(reader)
+	}
+
+	var maxBytesError *http.MaxBytesError
+	switch {
+	case errors.Is(err, ErrArchiveTooLarge), errors.As(err, &maxBytesError):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": ErrArchiveTooLarge.Error(), "files": e.results})
+		return
+	case err != nil:
+		fmt.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unreadable archive: " + err.Error(), "files": e.results})
+		return
+	case len(e.results) == 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no supported image in archive"})
+		return
+	}
+
+	c.JSON(pictures.UploadStatusCode(e.results), gin.H{"files": e.results})
+}
@@ -0,0 +1,208 @@
+package ingest
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/evanespen/vanespen.art_2025/internal/pictures"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestLimitedReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		limit   int64
+		wantErr error
+	}{
+		{name: "under the limit", size: 99, limit: 100},
+		{name: "exactly the limit", size: 100, limit: 100},
+		{name: "one byte over", size: 101, limit: 100, wantErr: ErrArchiveTooLarge},
+		{name: "empty", size: 0, limit: 0},
+		{name: "empty limit", size: 1, limit: 0, wantErr: ErrArchiveTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := io.ReadAll(&limitedReader{reader: strings.NewReader(strings.Repeat("x", test.size)), remaining: test.limit})
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			if test.wantErr == nil && len(data) != test.size {
+				t.Fatalf("read %d bytes, want %d", len(data), test.size)
+			}
+		})
+	}
+}
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	body     string
+}
+
+func tarArchive(t *testing.T, entries []tarEntry) *bytes.Buffer {
+	t.Helper()
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Mode: 0644, Size: int64(len(entry.body))}
+		if entry.typeflag == tar.TypeSymlink {
+			header.Linkname, header.Size = "/etc/passwd", 0
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(entry.body)); err != nil && header.Size > 0 {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &archive
+}
+
+func TestExtractTarRejectsUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		name       string
+		entry      tarEntry
+		wantReason string
+	}{
+		{name: "parent directory", entry: tarEntry{name: "../evil.jpg", typeflag: tar.TypeReg, body: "x"}, wantReason: "unsafe path in archive"},
+		{name: "nested parent directory", entry: tarEntry{name: "photos/../../evil.jpg", typeflag: tar.TypeReg, body: "x"}, wantReason: "unsafe path in archive"},
+		{name: "absolute", entry: tarEntry{name: "/tmp/evil.jpg", typeflag: tar.TypeReg, body: "x"}, wantReason: "unsafe path in archive"},
+		{name: "windows separators", entry: tarEntry{name: `..\evil.jpg`, typeflag: tar.TypeReg, body: "x"}, wantReason: "unsafe path in archive"},
+		{name: "symlink", entry: tarEntry{name: "link.jpg", typeflag: tar.TypeSymlink}, wantReason: "not a regular file"},
+		{name: "ignored", entry: tarEntry{name: "notes.txt", typeflag: tar.TypeReg, body: "x"}},
+		{name: "macOS metadata", entry: tarEntry{name: "__MACOSX/._photo.jpg", typeflag: tar.TypeReg, body: "x"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var e extractor
+			if err := e.extractTar(tarArchive(t, []tarEntry{test.entry})); err != nil {
+				t.Fatal(err)
+			}
+			if test.wantReason == "" {
+				if len(e.results) != 0 {
+					t.Fatalf("got results %v, want the entry ignored", e.results)
+				}
+				return
+			}
+			if len(e.results) != 1 || e.results[0].Status != pictures.UploadRejected || e.results[0].Reason != test.wantReason {
+				t.Fatalf("got results %v, want the entry rejected: %s", e.results, test.wantReason)
+			}
+		})
+	}
+}
+
+func TestExtractTarTooManyEntries(t *testing.T) {
+	entries := make([]tarEntry, configs.MaxArchiveEntries+1)
+	for i := range entries {
+		entries[i] = tarEntry{name: "notes.txt", typeflag: tar.TypeReg}
+	}
+
+	var e extractor
+	if err := e.extractTar(tarArchive(t, entries)); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Fatalf("got error %v, want %v", err, ErrArchiveTooLarge)
+	}
+}
+
+func TestCheckZip(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string][]byte
+		wantErr error
+	}{
+		{name: "regular", files: map[string][]byte{"photo.jpg": bytes.Repeat([]byte{1, 2, 3, 4, 5, 6, 7}, 1000)}},
+		{name: "small and compressible", files: map[string][]byte{"photo.jpg": make([]byte, 1<<19)}},
+		{name: "bomb", files: map[string][]byte{"photo.jpg": make([]byte, 4<<20)}, wantErr: ErrArchiveTooLarge},
+		{name: "ignored bomb", files: map[string][]byte{"notes.txt": make([]byte, 4<<20)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var archive bytes.Buffer
+			writer := zip.NewWriter(&archive)
+			for name, data := range test.files {
+				file, err := writer.Create(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := file.Write(data); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			zipReader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := checkZip(zipReader); !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckZipDeclaredSizes(t *testing.T) {
+	// The sizes of the zip directory are the ones declared by the archive, they can be
+	// anything.
+	zipReader := &zip.Reader{File: []*zip.File{
+		{FileHeader: zip.FileHeader{Name: "a.jpg", UncompressedSize64: configs.MaxArchiveEntrySize, CompressedSize64: configs.MaxArchiveEntrySize}},
+		{FileHeader: zip.FileHeader{Name: "b.jpg", UncompressedSize64: configs.MaxArchiveEntrySize + 1, CompressedSize64: configs.MaxArchiveEntrySize + 1}},
+	}}
+	if err := checkZip(zipReader); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Fatalf("got error %v, want %v", err, ErrArchiveTooLarge)
+	}
+
+	zipReader.File = zipReader.File[:1]
+	if err := checkZip(zipReader); err != nil {
+		t.Fatalf("an entry of exactly the size limit is rejected: %v", err)
+	}
+}
+
+func TestExtractTarGzipRatio(t *testing.T) {
+	incompressible := make([]byte, 2<<20)
+	rand.New(rand.NewSource(1)).Read(incompressible)
+
+	tests := []struct {
+		name    string
+		body    []byte
+		wantErr error
+	}{
+		{name: "incompressible", body: incompressible},
+		{name: "small and compressible", body: make([]byte, 1<<19)},
+		{name: "bomb", body: make([]byte, 16<<20), wantErr: ErrArchiveTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The ignored entries are decompressed as well to reach the next header.
+			archive := tarArchive(t, []tarEntry{{name: "notes.txt", typeflag: tar.TypeReg, body: string(test.body)}})
+			var compressed bytes.Buffer
+			writer := gzip.NewWriter(&compressed)
+			if _, err := writer.Write(archive.Bytes()); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			var e extractor
+			if err := e.extractTarGzip(&compressed); !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
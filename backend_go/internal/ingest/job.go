@@ -0,0 +1,72 @@
+package ingest
+
+import (
+	"github.com/evanespen/vanespen.art_2025/internal/pictures"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobQueued  JobStatus = "queued"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+)
+
+type FileProgress struct {
+	Filename  string                 `json:"filename"`
+	StashPath string                 `json:"-"`
+	Stage     pictures.Stage         `json:"stage"`
+	Result    *pictures.UploadResult `json:"result,omitempty"`
+}
+
+// persistedFileProgress keeps the stash path in the state file, it is hidden from API responses.
+type persistedFileProgress struct {
+	FileProgress
+	StashPath string `json:"stash_path"`
+}
+
+type Job struct {
+	ID        string         `json:"id"`
+	Status    JobStatus      `json:"status"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	Files     []FileProgress `json:"files"`
+}
+
+// ProgressEvent is sent to the subscribers of a job each time one of its files
+// moves to another stage.
+type ProgressEvent struct {
+	JobID     string                 `json:"job_id"`
+	Index     int                    `json:"index"`
+	Filename  string                 `json:"filename"`
+	Stage     pictures.Stage         `json:"stage"`
+	Result    *pictures.UploadResult `json:"result,omitempty"`
+	JobStatus JobStatus              `json:"job_status"`
+}
+
+func (j *Job) clone() Job {
+	clone := *j
+	clone.Files = make([]FileProgress, len(j.Files))
+	copy(clone.Files, j.Files)
+	return clone
+}
+
+func (j *Job) Results() []pictures.UploadResult {
+	results := make([]pictures.UploadResult, 0, len(j.Files))
+	for _, file := range j.Files {
+		if file.Result != nil {
+			results = append(results, *file.Result)
+		}
+	}
+	return results
+}
+
+func (j *Job) finished() bool {
+	for _, file := range j.Files {
+		if file.Stage != pictures.StageStored && file.Stage != pictures.StageFailed {
+			return false
+		}
+	}
+	return true
+}
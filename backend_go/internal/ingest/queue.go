@@ -0,0 +1,371 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/evanespen/vanespen.art_2025/internal/pictures"
+	"github.com/google/uuid"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var ErrQueueFull = errors.New("ingest queue is full")
+var ErrQueueStopped = errors.New("ingest queue is stopped")
+
+type StashedFile struct {
+	Filename  string
+	StashPath string
+}
+
+type workItem struct {
+	jobID string
+	index int
+}
+
+type persistedJob struct {
+	Job
+	Files []persistedFileProgress `json:"files"`
+}
+
+// Queue runs ingest jobs on a bounded pool of workers. Its state is written to a file
+// after every change so the files still waiting in the stash are picked up again
+// after a restart.
+type Queue struct {
+	mutex       sync.Mutex
+	jobs        map[string]*Job
+	work        chan workItem
+	subscribers map[string]map[chan ProgressEvent]struct{}
+	stateFile   string
+	workers     sync.WaitGroup
+	stopped     bool
+}
+
+var queue *Queue
+
+func Start() error {
+	queue = &Queue{
+		jobs:        make(map[string]*Job),
+		work:        make(chan workItem, configs.IngestQueueSize),
+		subscribers: make(map[string]map[chan ProgressEvent]struct{}),
+		stateFile:   configs.JobsStateFile,
+	}
+
+	if err := queue.restore(); err != nil {
+		return err
+	}
+
+	for i := 0; i < configs.IngestWorkers; i++ {
+		queue.workers.Add(1)
+		go queue.worker()
+	}
+
+	return nil
+}
+
+// Stop waits for the workers to finish the files they are ingesting, the catalog can
+// then be closed. The files still queued stay in the stash, they are resumed on the
+// next start.
+func Stop() {
+	if queue != nil {
+		queue.Stop()
+	}
+}
+
+func Enqueue(files []StashedFile) (Job, error) {
+	return queue.Enqueue(files)
+}
+
+func GetJob(id string) (Job, bool) {
+	return queue.Get(id)
+}
+
+func (q *Queue) Enqueue(files []StashedFile) (Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.stopped {
+		return Job{}, ErrQueueStopped
+	}
+	if len(q.work)+len(files) > cap(q.work) {
+		return Job{}, ErrQueueFull
+	}
+
+	now := time.Now()
+	job := &Job{ID: uuid.New().String(), Status: JobQueued, CreatedAt: now, UpdatedAt: now}
+	for _, file := range files {
+		job.Files = append(job.Files, FileProgress{Filename: file.Filename, StashPath: file.StashPath, Stage: pictures.StageStashed})
+	}
+	q.jobs[job.ID] = job
+
+	for index := range job.Files {
+		q.work <- workItem{jobID: job.ID, index: index}
+	}
+
+	q.persist()
+	return job.clone(), nil
+}
+
+func (q *Queue) Get(id string) (Job, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return job.clone(), true
+}
+
+// Subscribe returns the current state of the job along with a channel receiving its
+// next progress events, unsubscribe must be called once the caller stops reading.
+func (q *Queue) Subscribe(id string) (Job, <-chan ProgressEvent, func(), bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, nil, nil, false
+	}
+
+	events := make(chan ProgressEvent, 64)
+	if q.subscribers[id] == nil {
+		q.subscribers[id] = make(map[chan ProgressEvent]struct{})
+	}
+	q.subscribers[id][events] = struct{}{}
+
+	unsubscribe := func() {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		delete(q.subscribers[id], events)
+		if len(q.subscribers[id]) == 0 {
+			delete(q.subscribers, id)
+		}
+	}
+
+	return job.clone(), events, unsubscribe, true
+}
+
+func (q *Queue) Stop() {
+	q.mutex.Lock()
+	if !q.stopped {
+		q.stopped = true
+		close(q.work)
+	}
+	q.mutex.Unlock()
+
+	q.workers.Wait()
+}
+
+func (q *Queue) worker() {
+	defer q.workers.Done()
+	for item := range q.work {
+		file, ok := q.file(item)
+		if !ok {
+			continue
+		}
+
+		picture, err := pictures.HandleWithProgress(file.StashPath, file.Filename, func(stage pictures.Stage) {
+			if stage != pictures.StageStored {
+				q.update(item, stage, nil)
+			}
+		})
+		result := pictures.NewUploadResult(file.Filename, picture, err)
+
+		stage := pictures.StageStored
+		if result.Status != pictures.UploadCreated {
+			stage = pictures.StageFailed
+		}
+		q.update(item, stage, &result)
+
+		_ = os.Remove(file.StashPath)
+	}
+}
+
+func (q *Queue) file(item workItem) (FileProgress, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	// Once stopped the queued files are left for the next start.
+	job, ok := q.jobs[item.jobID]
+	if !ok || q.stopped {
+		return FileProgress{}, false
+	}
+	if job.Status == JobQueued {
+		job.Status = JobRunning
+	}
+	return job.Files[item.index], true
+}
+
+func (q *Queue) update(item workItem, stage pictures.Stage, result *pictures.UploadResult) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	job, ok := q.jobs[item.jobID]
+	if !ok {
+		return
+	}
+
+	file := &job.Files[item.index]
+	file.Stage = stage
+	file.Result = result
+	job.UpdatedAt = time.Now()
+	if job.finished() {
+		job.Status = JobDone
+	}
+
+	q.persist()
+
+	event := ProgressEvent{
+		JobID:     job.ID,
+		Index:     item.index,
+		Filename:  file.Filename,
+		Stage:     stage,
+		Result:    result,
+		JobStatus: job.Status,
+	}
+	for subscriber := range q.subscribers[job.ID] {
+		deliver(subscriber, event)
+	}
+}
+
+// deliver sends event without waiting for the subscriber. A subscriber that does not keep
+// up misses events, GET /admin/jobs/:id still gives the complete state, but the last one
+// takes the place of the oldest event waiting so the stream always learns the job is done.
+// The subscriber channels are only sent to with the mutex held, the room freed is kept.
+func deliver(subscriber chan ProgressEvent, event ProgressEvent) {
+	select {
+	case subscriber <- event:
+		return
+	default:
+	}
+	if event.JobStatus != JobDone {
+		return
+	}
+
+	select {
+	case <-subscriber:
+	default:
+	}
+	select {
+	case subscriber <- event:
+	default:
+	}
+}
+
+// persist writes every job to the state file, finished jobs are dropped once they are
+// older than configs.JobRetention. It must be called with the mutex held.
+func (q *Queue) persist() {
+	state := make([]persistedJob, 0, len(q.jobs))
+	for id, job := range q.jobs {
+		if job.Status == JobDone && time.Since(job.UpdatedAt) > configs.JobRetention {
+			delete(q.jobs, id)
+			continue
+		}
+
+		persisted := persistedJob{Job: *job}
+		for _, file := range job.Files {
+			persisted.Files = append(persisted.Files, persistedFileProgress{FileProgress: file, StashPath: file.StashPath})
+		}
+		state = append(state, persisted)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		log.Println("cannot encode ingest jobs:", err)
+		return
+	}
+
+	tmpFile := q.stateFile + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		log.Println("cannot save ingest jobs:", err)
+		return
+	}
+	if err := os.Rename(tmpFile, q.stateFile); err != nil {
+		log.Println("cannot save ingest jobs:", err)
+	}
+}
+
+// restore reloads the jobs saved before a restart and queues again the files which
+// were not completely ingested, as long as they are still in the stash.
+func (q *Queue) restore() error {
+	if err := os.MkdirAll(filepath.Dir(q.stateFile), 0755); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(q.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read ingest jobs from %s: %w", q.stateFile, err)
+	}
+
+	var state []persistedJob
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("cannot decode ingest jobs from %s: %w", q.stateFile, err)
+	}
+
+	var pending []workItem
+	for _, persisted := range state {
+		job := persisted.Job
+		job.Files = make([]FileProgress, 0, len(persisted.Files))
+
+		for index, persistedFile := range persisted.Files {
+			file := persistedFile.FileProgress
+			file.StashPath = persistedFile.StashPath
+
+			if file.Stage != pictures.StageStored && file.Stage != pictures.StageFailed {
+				if _, err := os.Stat(file.StashPath); err == nil {
+					file.Stage = pictures.StageStashed
+					pending = append(pending, workItem{jobID: job.ID, index: index})
+				} else {
+					file.Stage = pictures.StageFailed
+					file.Result = &pictures.UploadResult{Filename: file.Filename, Status: pictures.UploadFailed, Reason: "stashed file lost during restart"}
+				}
+			}
+			job.Files = append(job.Files, file)
+		}
+
+		if job.finished() {
+			job.Status = JobDone
+		} else {
+			job.Status = JobQueued
+		}
+		q.jobs[job.ID] = &job
+	}
+
+	// The workers are not started yet, the files which do not fit in the queue fail
+	// rather than staying stashed forever.
+	resumed := 0
+	for _, item := range pending {
+		select {
+		case q.work <- item:
+			resumed++
+			continue
+		default:
+		}
+
+		log.Printf("ingest queue full, file %d of job %s not resumed\n", item.index, item.jobID)
+		job := q.jobs[item.jobID]
+		file := &job.Files[item.index]
+		_ = os.Remove(file.StashPath)
+		file.Stage = pictures.StageFailed
+		file.Result = &pictures.UploadResult{Filename: file.Filename, Status: pictures.UploadFailed, Reason: "ingest queue full after restart"}
+		if job.finished() {
+			job.Status = JobDone
+		}
+	}
+	if resumed > 0 {
+		log.Printf("resumed %d pending ingest files\n", resumed)
+	}
+	if resumed < len(pending) {
+		q.persist()
+	}
+
+	return nil
+}
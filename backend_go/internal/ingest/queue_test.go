@@ -0,0 +1,200 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/evanespen/vanespen.art_2025/internal/pictures"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestQueue(t *testing.T, capacity int) *Queue {
+	t.Helper()
+	return &Queue{
+		jobs:        make(map[string]*Job),
+		work:        make(chan workItem, capacity),
+		subscribers: make(map[string]map[chan ProgressEvent]struct{}),
+		stateFile:   filepath.Join(t.TempDir(), "jobs.json"),
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	tests := []struct {
+		name       string
+		buffered   int
+		final      bool
+		wantEvents []int
+	}{
+		{name: "room left", buffered: 1, wantEvents: []int{0, 9}},
+		{name: "full, progress dropped", buffered: 3, wantEvents: []int{0, 1, 2}},
+		{name: "full, final replaces the oldest", buffered: 3, final: true, wantEvents: []int{1, 2, 9}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subscriber := make(chan ProgressEvent, 3)
+			for i := 0; i < test.buffered; i++ {
+				subscriber <- ProgressEvent{Index: i, JobStatus: JobRunning}
+			}
+			event := ProgressEvent{Index: 9, JobStatus: JobRunning}
+			if test.final {
+				event.JobStatus = JobDone
+			}
+			deliver(subscriber, event)
+
+			close(subscriber)
+			var got []int
+			for event := range subscriber {
+				got = append(got, event.Index)
+			}
+			if len(got) != len(test.wantEvents) {
+				t.Fatalf("got events %v, want %v", got, test.wantEvents)
+			}
+			for i := range got {
+				if got[i] != test.wantEvents[i] {
+					t.Fatalf("got events %v, want %v", got, test.wantEvents)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateDeliversJobDone(t *testing.T) {
+	q := newTestQueue(t, 10)
+	job := &Job{ID: "job", Status: JobRunning, Files: []FileProgress{{Filename: "a.jpg", Stage: pictures.StageStashed}}}
+	q.jobs[job.ID] = job
+	_, events, unsubscribe, _ := q.Subscribe(job.ID)
+	defer unsubscribe()
+
+	// The subscriber does not read until the job is done.
+	for i := 0; i < 2*cap(events); i++ {
+		q.update(workItem{jobID: job.ID}, pictures.StageExtracted, nil)
+	}
+	q.update(workItem{jobID: job.ID}, pictures.StageStored, &pictures.UploadResult{Filename: "a.jpg", Status: pictures.UploadCreated})
+
+	var last ProgressEvent
+	for len(events) > 0 {
+		last = <-events
+	}
+	if last.JobStatus != JobDone {
+		t.Fatalf("last event %+v, want the job done", last)
+	}
+}
+
+func countFailed(job Job) int {
+	failed := 0
+	for _, file := range job.Files {
+		if file.Stage == pictures.StageFailed {
+			failed++
+		}
+	}
+	return failed
+}
+
+func TestRestore(t *testing.T) {
+	tests := []struct {
+		name          string
+		capacity      int
+		stashed       int
+		lost          int
+		wantQueued    int
+		wantFailed    int
+		wantJobStatus JobStatus
+	}{
+		{name: "resumed", capacity: 10, stashed: 3, wantQueued: 3, wantJobStatus: JobQueued},
+		{name: "stash lost", capacity: 10, stashed: 1, lost: 2, wantQueued: 1, wantFailed: 2, wantJobStatus: JobQueued},
+		{name: "queue full", capacity: 2, stashed: 3, wantQueued: 2, wantFailed: 1, wantJobStatus: JobQueued},
+		{name: "nothing fits", capacity: 0, stashed: 2, wantFailed: 2, wantJobStatus: JobDone},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := newTestQueue(t, test.capacity)
+			stash := t.TempDir()
+
+			persisted := persistedJob{Job: Job{ID: "job", Status: JobRunning, UpdatedAt: time.Now()}}
+			for i := 0; i < test.stashed+test.lost; i++ {
+				stashPath := filepath.Join(stash, string(rune('a'+i))+".jpg")
+				if i < test.stashed {
+					if err := os.WriteFile(stashPath, []byte("image"), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				file := FileProgress{Filename: filepath.Base(stashPath), Stage: pictures.StageExtracted}
+				persisted.Files = append(persisted.Files, persistedFileProgress{FileProgress: file, StashPath: stashPath})
+			}
+			data, _ := json.Marshal([]persistedJob{persisted})
+			if err := os.WriteFile(q.stateFile, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := q.restore(); err != nil {
+				t.Fatal(err)
+			}
+
+			job, _ := q.Get("job")
+			for _, file := range job.Files {
+				if _, err := os.Stat(file.StashPath); file.Stage == pictures.StageFailed && err == nil {
+					t.Errorf("%s failed but is still stashed", file.Filename)
+				}
+			}
+			if len(q.work) != test.wantQueued || countFailed(job) != test.wantFailed || job.Status != test.wantJobStatus {
+				t.Fatalf("got %d queued, %d failed, job %s, want %d, %d, %s", len(q.work), countFailed(job), job.Status, test.wantQueued, test.wantFailed, test.wantJobStatus)
+			}
+
+			// The failures are saved, they are not resumed by the next restart.
+			restarted := newTestQueue(t, test.capacity)
+			restarted.stateFile = q.stateFile
+			if err := restarted.restore(); err != nil {
+				t.Fatal(err)
+			}
+			job, _ = restarted.Get("job")
+			if len(job.Files) != len(persisted.Files) || countFailed(job) != test.wantFailed {
+				t.Errorf("%d of %d files failed after the next restart, want %d", countFailed(job), len(job.Files), test.wantFailed)
+			}
+		})
+	}
+}
+
+func TestStopLeavesQueuedFilesForTheNextStart(t *testing.T) {
+	q := newTestQueue(t, 10)
+	stash := t.TempDir()
+	var files []StashedFile
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		stashPath := filepath.Join(stash, name)
+		if err := os.WriteFile(stashPath, []byte("image"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, StashedFile{Filename: name, StashPath: stashPath})
+	}
+	job, err := q.Enqueue(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q.Stop()
+	q.Stop()
+	// A worker still running drains the queue without ingesting anything.
+	q.workers.Add(1)
+	q.worker()
+
+	if _, err := q.Enqueue(files); !errors.Is(err, ErrQueueStopped) {
+		t.Fatalf("got error %v enqueuing after stop, want %v", err, ErrQueueStopped)
+	}
+	for _, file := range files {
+		if _, err := os.Stat(file.StashPath); err != nil {
+			t.Fatalf("%s is no longer stashed: %v", file.Filename, err)
+		}
+	}
+
+	restarted := newTestQueue(t, 10)
+	restarted.stateFile = q.stateFile
+	if err := restarted.restore(); err != nil {
+		t.Fatal(err)
+	}
+	if resumed, _ := restarted.Get(job.ID); len(restarted.work) != len(files) || resumed.Status != JobQueued {
+		t.Fatalf("got %d files resumed, job %s, want %d queued", len(restarted.work), resumed.Status, len(files))
+	}
+}
@@ -1,74 +1,216 @@
 package pictures
 
 import (
+	"errors"
 	"fmt"
 	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/evanespen/vanespen.art_2025/internal/catalog"
 	"github.com/gin-gonic/gin"
 	"net/http"
-	"os"
-	"path"
+	"strconv"
 )
 
-func UploadPictures(c *gin.Context) {
-	form, _ := c.MultipartForm()
-	files := form.File["files"]
-
-	for _, file := range files {
-		stashImagePath := path.Join(configs.StashDir, file.Filename)
-		err := c.SaveUploadedFile(file, stashImagePath)
-		if err != nil {
-			c.Status(500)
-		}
-
-		handleErr := Handle(path.Join(configs.StashDir, file.Filename))
+func GetAllPictures(c *gin.Context) {
+	query, err := ParseQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-		if handleErr == nil {
-			_ = os.Remove(stashImagePath)
-			fmt.Println(fmt.Sprintf("%s process succeed", stashImagePath))
-		} else {
-			fmt.Println(handleErr)
-		}
+	allPictures, err := repository.List()
+	if err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
 	}
 
-	c.Status(200)
+	page := query.Apply(allPictures)
+	if page.Pictures, err = PublicPictures(page.Pictures); err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, page)
 }
 
-func GetAllPictures(c *gin.Context) {
-	allPictures, err := Read()
+func GetPictureFacets(c *gin.Context) {
+	filter, err := ParsePublicFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	allPictures, err := repository.List()
 	if err != nil {
 		fmt.Println(err)
 		c.Status(500)
 		return
 	}
-	c.IndentedJSON(http.StatusOK, allPictures)
+	c.IndentedJSON(http.StatusOK, ComputeFacets(filter.Apply(allPictures)))
 }
 
 func GetOnePicture(c *gin.Context) {
 	uuid := c.Param("uuid")
 
-	allPictures, err := Read()
+	picture, err := repository.Get(uuid)
+	if errors.Is(err, catalog.ErrNotFound) {
+		c.Status(404)
+		return
+	}
 	if err != nil {
 		c.Status(500)
 		return
 	}
 
-	for _, picture := range allPictures {
-		if picture.UUID == uuid {
-			c.IndentedJSON(http.StatusOK, picture)
+	if picture, err = PublicPicture(picture); err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, picture)
+}
+
+func DeleteOnePicture(c *gin.Context) {
+	err := DeletePicture(c.Param("uuid"))
+	if errors.Is(err, catalog.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "picture not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type DeletePicturesPayload struct {
+	UUIDs []string `json:"uuids" binding:"required"`
+}
+
+func DeleteManyPictures(c *gin.Context) {
+	var payload DeletePicturesPayload
+	if err := c.BindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report := DeletePictures(payload.UUIDs)
+
+	status := http.StatusOK
+	if len(report.Failed) > 0 && len(report.Deleted) > 0 {
+		status = http.StatusMultiStatus
+	} else if len(report.Failed) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	c.JSON(status, report)
+}
+
+func PatchPicture(c *gin.Context) {
+	var patch PicturePatch
+	if err := c.BindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	picture, err := UpdatePicture(c.Param("uuid"), patch)
+	if errors.Is(err, ErrInvalidPatch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, catalog.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "picture not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, picture)
+}
+
+// RebuildRenditions starts rebuilding the renditions of the pictures matching the filter
+// of the query string, the body selects the renditions and may force the rebuild.
+func RebuildRenditions(c *gin.Context) {
+	var options ReprocessOptions
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&options); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 	}
 
-	c.Status(404)
-	return
+	filter, err := ParseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	options.Filter = filter
+
+	status, err := StartReprocess(options)
+	if errors.Is(err, ErrUnknownRendition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, ErrReprocessRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": status})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, status)
 }
 
-// TODO: DELETE
-// TODO: PUT (favourite)
+func GetRenditionsRebuild(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, GetReprocessStatus())
+}
+
+// GetSimilarClusters lists the clusters of similar pictures among the ones matching the
+// filter, ?threshold overrides the distance used at ingest.
+func GetSimilarClusters(c *gin.Context) {
+	filter, err := ParseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	threshold := configs.NearDuplicateThreshold
+	if rawThreshold, ok := c.GetQuery("threshold"); ok {
+		threshold, err = strconv.Atoi(rawThreshold)
+		if err != nil || threshold < 0 || threshold > 64 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be between 0 and 64"})
+			return
+		}
+	}
+
+	allPictures, err := repository.List()
+	if err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"threshold": threshold, "clusters": Clusters(filter.Apply(allPictures), threshold)})
+}
 
 func BindRoutes(engine *gin.Engine, adminGroup *gin.RouterGroup) {
 	picturesRouter := engine.Group("/pictures")
 	picturesRouter.GET("/", GetAllPictures)
+	picturesRouter.GET("/facets", GetPictureFacets)
+	picturesRouter.GET("/geo", GetPicturesGeo)
 	picturesRouter.GET("/:uuid", GetOnePicture)
-	adminGroup.POST("/pictures", UploadPictures)
+	picturesRouter.GET("/:uuid/stack", GetPictureStack)
+	picturesRouter.GET("/:uuid/tiles", GetPictureTiles)
+	engine.GET("/tags", GetTags)
+	adminGroup.DELETE("/pictures", DeleteManyPictures)
+	adminGroup.PATCH("/pictures/:uuid", PatchPicture)
+	adminGroup.DELETE("/pictures/:uuid", DeleteOnePicture)
+	adminGroup.PUT("/pictures/:uuid/stack", PutPictureStack)
+	adminGroup.PUT("/pictures/:uuid/stack/cover", PutStackCover)
+	adminGroup.POST("/renditions", RebuildRenditions)
+	adminGroup.GET("/renditions", GetRenditionsRebuild)
+	adminGroup.GET("/pictures/clusters", GetSimilarClusters)
 }
@@ -0,0 +1,125 @@
+package pictures
+
+import (
+	"errors"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/internal/albums"
+	"os"
+)
+
+const stagedSuffix = ".deleting"
+
+// DeletePicture removes the picture from the catalog, its renditions from the storage
+// and its UUID from the albums, its stack gets a new cover if it was the cover. The
+// rendition files are first moved aside so they can be put back if the catalog update
+// fails. The albums are another repository, they are changed once the picture is gone
+// from the catalog, which is put back as it was if they cannot be.
+func DeletePicture(pictureUUID string) error {
+	picture, err := repository.Get(pictureUUID)
+	if err != nil {
+		return err
+	}
+
+	staged, err := stageFiles(RenditionPaths(picture))
+	if err != nil {
+		return err
+	}
+
+	var previous, updated []Picture
+	err = repository.Transaction(func(tx Repository) error {
+		err := tx.Delete(pictureUUID)
+		if err != nil {
+			return err
+		}
+		previous, updated, err = electCover(tx, picture.Stack)
+		return err
+	})
+	if err != nil {
+		restoreFiles(staged)
+		return err
+	}
+
+	if err := albums.RemovePicture(pictureUUID); err != nil {
+		if restoreErr := restorePicture(picture, previous); restoreErr != nil {
+			fmt.Println(restoreErr)
+		}
+		restoreFiles(staged)
+		return err
+	}
+
+	for _, file := range staged {
+		if err := os.RemoveAll(file + stagedSuffix); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	publish(Event{Type: PictureDeleted, Picture: picture})
+	publishUpdates(previous, updated)
+	return nil
+}
+
+// restorePicture undoes a deletion committed to the catalog, the picture is inserted
+// back and the members of its stack get their former cover.
+func restorePicture(picture Picture, stackMembers []Picture) error {
+	return repository.Transaction(func(tx Repository) error {
+		if err := tx.Insert(picture); err != nil {
+			return err
+		}
+		for _, member := range stackMembers {
+			if err := tx.Update(member); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type DeleteFailure struct {
+	UUID  string `json:"uuid"`
+	Error string `json:"error"`
+}
+
+type DeleteReport struct {
+	Deleted []string        `json:"deleted"`
+	Failed  []DeleteFailure `json:"failed"`
+}
+
+func DeletePictures(pictureUUIDs []string) DeleteReport {
+	report := DeleteReport{Deleted: make([]string, 0), Failed: make([]DeleteFailure, 0)}
+
+	for _, pictureUUID := range pictureUUIDs {
+		if err := DeletePicture(pictureUUID); err != nil {
+			report.Failed = append(report.Failed, DeleteFailure{UUID: pictureUUID, Error: err.Error()})
+			continue
+		}
+		report.Deleted = append(report.Deleted, pictureUUID)
+	}
+
+	return report
+}
+
+func stageFiles(files []string) ([]string, error) {
+	var staged []string
+
+	for _, file := range files {
+		err := os.Rename(file, file+stagedSuffix)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			restoreFiles(staged)
+			return nil, fmt.Errorf("cannot remove %s: %w", file, err)
+		}
+		staged = append(staged, file)
+	}
+
+	return staged, nil
+}
+
+func restoreFiles(staged []string) {
+	for _, file := range staged {
+		if err := os.Rename(file+stagedSuffix, file); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
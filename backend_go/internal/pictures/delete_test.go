@@ -0,0 +1,105 @@
+package pictures
+
+import (
+	"errors"
+	"github.com/evanespen/vanespen.art_2025/internal/albums"
+	"os"
+	"slices"
+	"testing"
+)
+
+var errAlbumsUnavailable = errors.New("albums unavailable")
+var errCatalogUnavailable = errors.New("catalog unavailable")
+
+// failingAlbums fails every transaction, as when the albums change log cannot be written.
+type failingAlbums struct {
+	albums.Repository
+}
+
+func (f failingAlbums) Transaction(fn func(tx albums.Repository) error) error {
+	return errAlbumsUnavailable
+}
+
+// failingCommit runs the transactions and then fails to commit them.
+type failingCommit struct {
+	Repository
+}
+
+func (f failingCommit) Transaction(fn func(tx Repository) error) error {
+	return f.Repository.Transaction(func(tx Repository) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return errCatalogUnavailable
+	})
+}
+
+func TestDeletePicture(t *testing.T) {
+	cover := Picture{UUID: "cover", Stack: "stack", StackCover: true}
+	edit := Picture{UUID: "edit", Stack: "stack"}
+
+	tests := []struct {
+		name         string
+		failAlbums   bool
+		failCatalog  bool
+		wantErr      error
+		wantPictures []string
+		wantCover    string
+		wantKept     bool
+	}{
+		{name: "deleted everywhere", wantPictures: []string{"edit"}, wantCover: "edit"},
+		{name: "catalog failing", failCatalog: true, wantErr: errCatalogUnavailable, wantPictures: []string{"cover", "edit"}, wantCover: "cover", wantKept: true},
+		{name: "albums failing", failAlbums: true, wantErr: errAlbumsUnavailable, wantPictures: []string{"cover", "edit"}, wantCover: "cover", wantKept: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestCatalog(t)
+			insertTestPictures(t, cover, edit)
+			album := albums.Album{UUID: "album", Title: "album", Pictures: []string{"cover", "edit"}}
+			if err := albums.GetRepository().Insert(album); err != nil {
+				t.Fatal(err)
+			}
+			if test.failCatalog {
+				SetRepository(failingCommit{repository})
+			}
+			if test.failAlbums {
+				albums.SetRepository(failingAlbums{albums.GetRepository()})
+			}
+
+			files := RenditionPaths(Picture{UUID: "cover", Ext: ".jpg"})
+			for _, file := range files {
+				if err := os.WriteFile(file, []byte("rendition"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := DeletePicture("cover"); !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+
+			remaining, _ := repository.List()
+			var uuids []string
+			for _, picture := range remaining {
+				uuids = append(uuids, picture.UUID)
+				if picture.StackCover != (picture.UUID == test.wantCover) {
+					t.Errorf("%s: stack cover %t, want cover %s", picture.UUID, picture.StackCover, test.wantCover)
+				}
+			}
+			slices.Sort(uuids)
+			if !slices.Equal(uuids, test.wantPictures) {
+				t.Errorf("got pictures %v, want %v", uuids, test.wantPictures)
+			}
+
+			stored, _ := albums.GetRepository().Get("album")
+			if slices.Contains(stored.Pictures, "cover") != test.wantKept {
+				t.Errorf("album pictures %v, want the picture kept %t", stored.Pictures, test.wantKept)
+			}
+			for _, file := range files {
+				if _, err := os.Stat(file); (err == nil) != test.wantKept {
+					t.Errorf("%s: rendition kept %t, want %t", file, err == nil, test.wantKept)
+				}
+			}
+		})
+	}
+}
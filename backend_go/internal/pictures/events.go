@@ -0,0 +1,36 @@
+package pictures
+
+import "sync"
+
+type EventType string
+
+const (
+	PictureCreated EventType = "created"
+	PictureUpdated EventType = "updated"
+	PictureDeleted EventType = "deleted"
+)
+
+// Event describes a change to the catalog, Previous holds the picture as it was before
+// an update or a deletion.
+type Event struct {
+	Type     EventType
+	Picture  Picture
+	Previous *Picture
+}
+
+var listeners []func(event Event)
+var listenersMutex sync.RWMutex
+
+func Subscribe(listener func(event Event)) {
+	listenersMutex.Lock()
+	defer listenersMutex.Unlock()
+	listeners = append(listeners, listener)
+}
+
+func publish(event Event) {
+	listenersMutex.RLock()
+	defer listenersMutex.RUnlock()
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
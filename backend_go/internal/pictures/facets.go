@@ -0,0 +1,170 @@
+package pictures
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type Facets struct {
+	Total        int          `json:"total"`
+	Cameras      []FacetCount `json:"cameras"`
+	Lenses       []FacetCount `json:"lenses"`
+	Years        []FacetCount `json:"years"`
+	Months       []FacetCount `json:"months"`
+	Orientations []FacetCount `json:"orientations"`
+	FocalLengths []FacetCount `json:"focal_lengths"`
+	Isos         []FacetCount `json:"isos"`
+	Tags         []FacetCount `json:"tags"`
+	Ratings      []FacetCount `json:"ratings"`
+}
+
+type bucket struct {
+	label string
+	upTo  float64
+}
+
+// Buckets are listed in ascending order, a value falls in the first bucket whose upTo
+// bound it is below.
+var focalLengthBuckets = []bucket{
+	{"0-23mm", 24},
+	{"24-34mm", 35},
+	{"35-69mm", 70},
+	{"70-134mm", 135},
+	{"135-299mm", 300},
+	{"300-599mm", 600},
+	{"600mm+", -1},
+}
+
+var isoBuckets = []bucket{
+	{"0-199", 200},
+	{"200-399", 400},
+	{"400-799", 800},
+	{"800-1599", 1600},
+	{"1600-3199", 3200},
+	{"3200-6399", 6400},
+	{"6400+", -1},
+}
+
+const (
+	Landscape = "landscape"
+	Portrait  = "portrait"
+	Panoramic = "panoramic"
+)
+
+func Orientation(picture Picture) string {
+	switch {
+	case picture.Panoramic:
+		return Panoramic
+	case picture.Landscape:
+		return Landscape
+	default:
+		return Portrait
+	}
+}
+
+func ComputeFacets(pictures []Picture) Facets {
+	cameras := map[string]int{}
+	lenses := map[string]int{}
+	years := map[string]int{}
+	months := map[string]int{}
+	orientations := map[string]int{}
+	focalLengths := map[string]int{}
+	isos := map[string]int{}
+	ratings := map[string]int{}
+
+	for _, picture := range pictures {
+		datetime := time.Unix(int64(picture.Timestamp), 0).UTC()
+
+		cameras[picture.Camera]++
+		lenses[picture.Lens]++
+		years[fmt.Sprintf("%04d", datetime.Year())]++
+		months[fmt.Sprintf("%04d-%02d", datetime.Year(), datetime.Month())]++
+		orientations[Orientation(picture)]++
+		focalLengths[FocalLengthBucket(picture)]++
+		isos[IsoBucket(picture)]++
+		ratings[strconv.Itoa(int(picture.Rating))]++
+	}
+
+	return Facets{
+		Total:        len(pictures),
+		Cameras:      FacetsByCount(cameras),
+		Lenses:       FacetsByCount(lenses),
+		Years:        FacetsByValue(years),
+		Months:       FacetsByValue(months),
+		Orientations: FacetsInOrder(orientations, []string{Landscape, Portrait, Panoramic}),
+		FocalLengths: FacetsInOrder(focalLengths, FocalLengthBucketLabels()),
+		Isos:         FacetsInOrder(isos, IsoBucketLabels()),
+		Tags:         FacetsByCount(TagCounts(pictures)),
+		Ratings:      FacetsByValue(ratings),
+	}
+}
+
+func FocalLengthBucket(picture Picture) string {
+	return bucketOf(focalLengthBuckets, FocalLengthMillimeters(picture))
+}
+
+func IsoBucket(picture Picture) string {
+	return bucketOf(isoBuckets, float64(picture.Iso))
+}
+
+func FocalLengthBucketLabels() []string {
+	return bucketLabels(focalLengthBuckets)
+}
+
+func IsoBucketLabels() []string {
+	return bucketLabels(isoBuckets)
+}
+
+func bucketOf(buckets []bucket, value float64) string {
+	for _, b := range buckets {
+		if b.upTo < 0 || value < b.upTo {
+			return b.label
+		}
+	}
+	return buckets[len(buckets)-1].label
+}
+
+func bucketLabels(buckets []bucket) []string {
+	labels := make([]string, 0, len(buckets))
+	for _, b := range buckets {
+		labels = append(labels, b.label)
+	}
+	return labels
+}
+
+func FacetsByCount(counts map[string]int) []FacetCount {
+	facets := FacetsByValue(counts)
+	slices.SortStableFunc(facets, func(a FacetCount, b FacetCount) int {
+		return cmp.Compare(b.Count, a.Count)
+	})
+	return facets
+}
+
+func FacetsByValue(counts map[string]int) []FacetCount {
+	facets := make([]FacetCount, 0, len(counts))
+	for value, count := range counts {
+		facets = append(facets, FacetCount{Value: value, Count: count})
+	}
+	slices.SortFunc(facets, func(a FacetCount, b FacetCount) int {
+		return cmp.Compare(a.Value, b.Value)
+	})
+	return facets
+}
+
+func FacetsInOrder(counts map[string]int, order []string) []FacetCount {
+	facets := make([]FacetCount, 0, len(counts))
+	for _, value := range order {
+		if counts[value] > 0 {
+			facets = append(facets, FacetCount{Value: value, Count: counts[value]})
+		}
+	}
+	return facets
+}
@@ -0,0 +1,99 @@
+package pictures
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// facetPictures are covers shot in 2023 and 2024 with two cameras, and an edit of the
+// first one which only the listings of every version count.
+func facetPictures() []Picture {
+	return []Picture{
+		{UUID: "a", StackCover: true, Camera: "R6", Lens: "100-500", Timestamp: 1700000000, Landscape: true, FocalLength: "500.0 mm", Iso: 1600, Tags: []string{"ibex"}, Rating: 5},
+		{UUID: "b", StackCover: true, Camera: "R6", Lens: "24-105", Timestamp: 1710000000, Landscape: true, Panoramic: true, FocalLength: "24.0 mm", Iso: 100, Tags: []string{"alps", "ibex"}, Rating: 3},
+		{UUID: "c", StackCover: true, Camera: "7D", Lens: "100-500", Timestamp: 1690000000, FocalLength: "300.0 mm", Iso: 800, Tags: []string{"Ibex"}, Rating: 5},
+		{UUID: "a-edit", Stack: "a", Camera: "R6", Lens: "100-500", Timestamp: 1700000000, Landscape: true, FocalLength: "500.0 mm", Iso: 1600, Rating: 4},
+	}
+}
+
+func TestGetPictureFacets(t *testing.T) {
+	useTestCatalog(t)
+	insertTestPictures(t, facetPictures()...)
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/pictures/facets", GetPictureFacets)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       Facets
+	}{
+		{name: "covers", query: "", wantStatus: http.StatusOK, want: Facets{
+			Total:        3,
+			Cameras:      []FacetCount{{"R6", 2}, {"7D", 1}},
+			Lenses:       []FacetCount{{"100-500", 2}, {"24-105", 1}},
+			Years:        []FacetCount{{"2023", 2}, {"2024", 1}},
+			Months:       []FacetCount{{"2023-07", 1}, {"2023-11", 1}, {"2024-03", 1}},
+			Orientations: []FacetCount{{Landscape, 1}, {Portrait, 1}, {Panoramic, 1}},
+			FocalLengths: []FacetCount{{"24-34mm", 1}, {"300-599mm", 2}},
+			Isos:         []FacetCount{{"0-199", 1}, {"800-1599", 1}, {"1600-3199", 1}},
+			Tags:         []FacetCount{{"ibex", 3}, {"alps", 1}},
+			Ratings:      []FacetCount{{"3", 1}, {"5", 2}},
+		}},
+		{name: "camera", query: "?camera=R6", wantStatus: http.StatusOK, want: Facets{
+			Total:        2,
+			Cameras:      []FacetCount{{"R6", 2}},
+			Lenses:       []FacetCount{{"100-500", 1}, {"24-105", 1}},
+			Years:        []FacetCount{{"2023", 1}, {"2024", 1}},
+			Months:       []FacetCount{{"2023-11", 1}, {"2024-03", 1}},
+			Orientations: []FacetCount{{Landscape, 1}, {Panoramic, 1}},
+			FocalLengths: []FacetCount{{"24-34mm", 1}, {"300-599mm", 1}},
+			Isos:         []FacetCount{{"0-199", 1}, {"1600-3199", 1}},
+			Tags:         []FacetCount{{"ibex", 2}, {"alps", 1}},
+			Ratings:      []FacetCount{{"3", 1}, {"5", 1}},
+		}},
+		{name: "every version", query: "?versions=all&iso_min=1000", wantStatus: http.StatusOK, want: Facets{
+			Total:        2,
+			Cameras:      []FacetCount{{"R6", 2}},
+			Lenses:       []FacetCount{{"100-500", 2}},
+			Years:        []FacetCount{{"2023", 2}},
+			Months:       []FacetCount{{"2023-11", 2}},
+			Orientations: []FacetCount{{Landscape, 2}},
+			FocalLengths: []FacetCount{{"300-599mm", 2}},
+			Isos:         []FacetCount{{"1600-3199", 2}},
+			Tags:         []FacetCount{{"ibex", 1}},
+			Ratings:      []FacetCount{{"4", 1}, {"5", 1}},
+		}},
+		{name: "nothing matching", query: "?camera=R5", wantStatus: http.StatusOK, want: Facets{
+			Cameras: []FacetCount{}, Lenses: []FacetCount{}, Years: []FacetCount{}, Months: []FacetCount{}, Orientations: []FacetCount{},
+			FocalLengths: []FacetCount{}, Isos: []FacetCount{}, Tags: []FacetCount{}, Ratings: []FacetCount{},
+		}},
+		{name: "invalid filter", query: "?iso_min=high", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, httptest.NewRequest("GET", "/pictures/facets"+test.query, nil))
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("got status %d, want %d", recorder.Code, test.wantStatus)
+			}
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+
+			var facets Facets
+			if err := json.Unmarshal(recorder.Body.Bytes(), &facets); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(facets, test.want) {
+				t.Fatalf("got %+v\nwant %+v", facets, test.want)
+			}
+		})
+	}
+}
@@ -1,69 +1,347 @@
 package pictures
 
 import (
-	"errors"
+	"bytes"
+	"cmp"
+	"context"
 	"fmt"
 	"github.com/disintegration/imaging"
 	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/evanespen/vanespen.art_2025/internal/utils"
 	"github.com/google/uuid"
+	"golang.org/x/sync/semaphore"
+	"image"
+	"os"
 	"path"
+	"slices"
+	"sync"
 )
 
-func PersistImage(imagePath string, pictureUUID string) error {
-	ext := path.Ext(imagePath)
-	filename := fmt.Sprintf("%s%s", pictureUUID, ext)
+// Rendition is a size profile of the stored images, the full rendition keeps the size
+// of the upload and the others are resized from it.
+type Rendition struct {
+	Name    string
+	Dir     string
+	Divisor int
+	// Version is bumped whenever the size, the encoding or the metadata of the rendition
+	// changes, the renditions made with an older version are rebuilt by Reprocess.
+	Version  int32
+	Metadata MetadataPolicy
+	// Tiles stores the image as a pyramid of tiles in a directory instead of a single
+	// file, for the panoramas only.
+	Tiles bool
+}
 
-	img, err := imaging.Open(imagePath)
-	if err != nil {
-		fmt.Println(err)
-		return errors.New("unable to open source image")
+// Every rendition is served publicly, the tiny one is kept as small as possible and the
+// panoramas are tiled for a zoomable viewer.
+var Renditions = []Rendition{
+	{Name: "full", Dir: configs.FullResDir, Divisor: 1, Version: 2, Metadata: MetadataPolicy{KeepCredits: true, Licence: true}},
+	{Name: "half", Dir: configs.HalfResDir, Divisor: 2, Version: 2, Metadata: MetadataPolicy{KeepCredits: true, Licence: true}},
+	{Name: "thumb", Dir: configs.ThumbResDir, Divisor: 6, Version: 2, Metadata: MetadataPolicy{Licence: true}},
+	{Name: "tiny", Dir: configs.TinyResDir, Divisor: 100, Version: 1},
+	{Name: "tiles", Dir: configs.TilesDir, Divisor: 1, Version: 1, Tiles: true},
+}
+
+func RenditionPaths(picture Picture) []string {
+	paths := make([]string, 0, len(Renditions))
+	for _, rendition := range Renditions {
+		if rendition.AppliesTo(picture) {
+			paths = append(paths, rendition.Path(picture))
+		}
 	}
+	return paths
+}
+
+// AppliesTo tells whether picture has the rendition, only the panoramas are tiled.
+func (r Rendition) AppliesTo(picture Picture) bool {
+	return !r.Tiles || picture.Panoramic
+}
 
-	if imaging.Save(img, path.Join(configs.FullResDir, filename)) != nil {
-		return errors.New("unable to save full res image")
+// Path returns the file of the rendition of picture, or the directory of its tiles.
+func (r Rendition) Path(picture Picture) string {
+	if r.Tiles {
+		return path.Join(r.Dir, picture.UUID)
+	}
+	return path.Join(r.Dir, picture.UUID+picture.Ext)
+}
+
+// save writes the rendition of an image of the given full size with the metadata of its
+// policy, from source, the image itself or a downscale of it at least as large as the
+// rendition. It returns the image written, the smaller renditions are resized from it.
+func (r Rendition) save(source image.Image, size image.Point, picture Picture) (image.Image, error) {
+	if r.Tiles {
+		return source, r.saveTiles(source, picture)
+	}
+	if r.Divisor > 1 {
+		source = imaging.Resize(source, max(1, size.X/r.Divisor), max(1, size.Y/r.Divisor), imaging.Lanczos)
 	}
 
-	dstImageHalf := imaging.Resize(img, img.Bounds().Dx()/2, img.Bounds().Dy()/2, imaging.Lanczos)
-	if imaging.Save(dstImageHalf, path.Join(configs.HalfResDir, filename)) != nil {
-		return errors.New("unable to save half res image")
+	target := r.Path(picture)
+	format, err := imaging.FormatFromFilename(target)
+	if err != nil {
+		return nil, err
 	}
-	dstImageThumb := imaging.Resize(img, img.Bounds().Dx()/6, img.Bounds().Dy()/6, imaging.Lanczos)
-	if imaging.Save(dstImageThumb, path.Join(configs.ThumbResDir, filename)) != nil {
-		return errors.New("unable to save thumb res image")
+	var encoded bytes.Buffer
+	if err := imaging.Encode(&encoded, source, format, imaging.JPEGQuality(configs.RenditionQuality)); err != nil {
+		return nil, err
 	}
-	dstImageTiny := imaging.Resize(img, img.Bounds().Dx()/100, img.Bounds().Dy()/100, imaging.Lanczos)
-	if imaging.Save(dstImageTiny, path.Join(configs.TinyResDir, filename)) != nil {
-		return errors.New("unable to save tiny res image")
+
+	data := encoded.Bytes()
+	if format == imaging.JPEG {
+		if data, err = r.Metadata.Apply(data, picture); err != nil {
+			return nil, err
+		}
 	}
+	return source, r.write(target, data)
+}
 
+// saveRenditions writes the renditions of the full size image img from the largest to
+// the smallest, each one resized from the previous one. img is no longer referenced once
+// the half rendition is made, a very large image is never held with several copies of
+// its size.
+func saveRenditions(img image.Image, picture Picture, renditions []Rendition) error {
+	size := img.Bounds().Size()
+	bySize := slices.Clone(renditions)
+	slices.SortStableFunc(bySize, func(a Rendition, b Rendition) int {
+		return cmp.Compare(a.Divisor, b.Divisor)
+	})
+
+	for _, rendition := range bySize {
+		var err error
+		if img, err = rendition.save(img, size, picture); err != nil {
+			return fmt.Errorf("unable to save the %s rendition of %s: %w", rendition.Name, picture.UUID, err)
+		}
+	}
 	return nil
 }
 
-func Handle(imagePath string) error {
-	pictureUUID := uuid.New().String()
+// RewriteMetadata replaces the metadata of the rendition of picture with the one of its
+// policy, without encoding the image again.
+func (r Rendition) RewriteMetadata(picture Picture) error {
+	target := r.Path(picture)
+	if !IsJPEG(target) {
+		return nil
+	}
 
-	persistError := PersistImage(imagePath, pictureUUID)
-	if persistError != nil {
-		fmt.Println(persistError)
-		return persistError
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return err
+	}
+	if data, err = r.Metadata.Apply(data, picture); err != nil {
+		return err
 	}
+	return r.write(target, data)
+}
+
+// write writes data next to target then renames it, an interrupted write never leaves a
+// truncated rendition behind.
+func (r Rendition) write(target string, data []byte) error {
+	temporary := path.Join(r.Dir, ".tmp-"+path.Base(target))
+	if err := os.WriteFile(temporary, data, 0644); err != nil {
+		_ = os.Remove(temporary)
+		return err
+	}
+	return os.Rename(temporary, target)
+}
+
+func currentRenditionVersions(picture Picture) map[string]int32 {
+	versions := make(map[string]int32, len(Renditions))
+	for _, rendition := range Renditions {
+		if rendition.AppliesTo(picture) {
+			versions[rendition.Name] = rendition.Version
+		}
+	}
+	return versions
+}
+
+// IsSupportedImage tells from its extension whether renditions can be made from the file.
+func IsSupportedImage(filename string) bool {
+	_, err := imaging.FormatFromFilename(filename)
+	return err == nil
+}
+
+// checkImageSize reads the size of the image from its header, the images of more than
+// configs.MaxImagePixels are rejected before being decoded. It returns the pixels of the
+// image.
+func checkImageSize(imagePath string) (int, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
 
-	picture, err := NewPicture(imagePath, pictureUUID)
+	config, _, err := image.DecodeConfig(file)
 	if err != nil {
 		fmt.Println(err)
-		return err
+		return 0, fmt.Errorf("%w: unable to read the image size", ErrUnsupportedImage)
+	}
+	if config.Width*config.Height > configs.MaxImagePixels {
+		return 0, fmt.Errorf("%w: %dx%d pixels, the limit is %d", ErrUnsupportedImage, config.Width, config.Height, configs.MaxImagePixels)
+	}
+	return config.Width * config.Height, nil
+}
+
+// decoding is weighted by the pixels of the images decoded and not released yet, several
+// small images are decoded in parallel while a large one waits for room.
+var decoding = semaphore.NewWeighted(configs.DecodedPixelsBudget)
+
+// openImage decodes the image once its pixels fit in configs.DecodedPixelsBudget, the
+// returned function must be called once the image is no longer used.
+func openImage(imagePath string) (image.Image, func(), error) {
+	pixels, err := checkImageSize(imagePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	weight := min(max(int64(pixels), 1), configs.DecodedPixelsBudget)
+	if err := decoding.Acquire(context.Background(), weight); err != nil {
+		return nil, nil, err
+	}
+	var once sync.Once
+	release := func() {
+		once.Do(func() { decoding.Release(weight) })
+	}
+
+	img, err := imaging.Open(imagePath)
+	if err != nil {
+		release()
+		fmt.Println(err)
+		return nil, nil, fmt.Errorf("%w: unable to open source image", ErrUnsupportedImage)
+	}
+	return img, release, nil
+}
+
+// PersistImage writes the renditions of img and sets the placeholder of picture, computed
+// before the full size image is released.
+func PersistImage(img image.Image, picture *Picture) error {
+	placeholder, err := NewPlaceholder(img)
+	if err != nil {
+		fmt.Println(err)
+		return fmt.Errorf("unable to compute the placeholder of %s: %w", picture.UUID, err)
 	}
+	picture.SetPlaceholder(placeholder)
 
-	pictures, err := Read()
-	if err == nil && len(pictures) > 0 {
-		for _, existingPicture := range pictures {
-			if existingPicture.Checksum == picture.Checksum {
-				return errors.New("picture already exists")
-			}
+	var renditions []Rendition
+	for _, rendition := range Renditions {
+		if rendition.AppliesTo(*picture) {
+			renditions = append(renditions, rendition)
 		}
 	}
 
-	Append(picture)
+	if err := saveRenditions(img, *picture, renditions); err != nil {
+		fmt.Println(err)
+		return err
+	}
+	return nil
+}
+
+type DuplicateError struct {
+	ExistingUUID string
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("picture already exists: %s", e.ExistingUUID)
+}
 
+func findDuplicate(r Repository, checksum string) error {
+	pictures, err := r.List()
+	if err != nil {
+		return err
+	}
+	for _, existingPicture := range pictures {
+		if existingPicture.Checksum == checksum {
+			return &DuplicateError{ExistingUUID: existingPicture.UUID}
+		}
+	}
 	return nil
 }
+
+func removeRenditions(picture Picture) {
+	for _, file := range RenditionPaths(picture) {
+		_ = os.RemoveAll(file)
+	}
+}
+
+// Handle ingests the image at imagePath, uploaded as filename, and returns the created
+// picture.
+func Handle(imagePath string, filename string) (Picture, error) {
+	return HandleWithProgress(imagePath, filename, nil)
+}
+
+// HandleWithProgress ingests the image at imagePath, uploaded as filename, calling
+// progress after each completed stage. Duplicates, and near duplicates when they are
+// rejected, are looked up before the costly resizes and checked again when inserting,
+// since another upload of the same file may have been stored in between. The picture
+// joins the stack of the other versions of its frame.
+func HandleWithProgress(imagePath string, filename string, progress func(stage Stage)) (Picture, error) {
+	if progress == nil {
+		progress = func(stage Stage) {}
+	}
+
+	checksum, err := utils.CalculateSHA256Checksum(imagePath)
+	if err != nil {
+		return Picture{}, err
+	}
+	if err := findDuplicate(repository, checksum); err != nil {
+		return Picture{}, err
+	}
+
+	img, release, err := openImage(imagePath)
+	if err != nil {
+		return Picture{}, err
+	}
+	defer release()
+
+	// The metadata is extracted first, the renditions carry the credits of the upload.
+	picture, err := NewPicture(imagePath, uuid.New().String())
+	if err != nil {
+		fmt.Println(err)
+		return Picture{}, err
+	}
+	picture.RenditionVersions = currentRenditionVersions(picture)
+	picture.PerceptualHash = DifferenceHash(img)
+	picture.Filename = uploadFilename(filename)
+	if err := findNearDuplicate(repository, picture); err != nil {
+		return Picture{}, err
+	}
+	progress(StageExtracted)
+
+	persistError := PersistImage(img, &picture)
+	release()
+	if persistError != nil {
+		fmt.Println(persistError)
+		removeRenditions(picture)
+		return Picture{}, persistError
+	}
+	progress(StageResized)
+
+	var previous, updated []Picture
+	err = repository.Transaction(func(tx Repository) error {
+		if err := findDuplicate(tx, picture.Checksum); err != nil {
+			return err
+		}
+		if err := findNearDuplicate(tx, picture); err != nil {
+			return err
+		}
+		members, err := joinStack(tx, &picture)
+		if err != nil {
+			return err
+		}
+		if err := tx.Insert(picture); err != nil {
+			return err
+		}
+		if picture.StackCover {
+			previous, updated, err = setCover(tx, members, picture.UUID)
+		}
+		return err
+	})
+	if err != nil {
+		removeRenditions(picture)
+		return Picture{}, err
+	}
+	progress(StageStored)
+
+	publish(Event{Type: PictureCreated, Picture: picture})
+	publishUpdates(previous, updated)
+	return picture, nil
+}
@@ -0,0 +1,86 @@
+package pictures
+
+import (
+	"bytes"
+	"golang.org/x/sync/semaphore"
+	"image"
+	"image/jpeg"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestJPEG(t *testing.T, width int, height int) string {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, testImage(width, height), nil); err != nil {
+		t.Fatal(err)
+	}
+	return writeTestFile(t, encoded.Bytes())
+}
+
+func TestOpenImageBudget(t *testing.T) {
+	previous := decoding
+	decoding = semaphore.NewWeighted(150 * 100)
+	t.Cleanup(func() { decoding = previous })
+
+	large, small := writeTestJPEG(t, 100, 100), writeTestJPEG(t, 50, 50)
+
+	_, releaseFirst, err := openImage(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A small image still fits next to the large one.
+	_, releaseSmall, err := openImage(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseSmall()
+
+	opened := make(chan func())
+	go func() {
+		_, release, err := openImage(large)
+		if err != nil {
+			t.Error(err)
+			release = func() {}
+		}
+		opened <- release
+	}()
+
+	select {
+	case release := <-opened:
+		release()
+		t.Fatal("two large images are decoded at once")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	releaseFirst()
+	releaseFirst()
+	select {
+	case release := <-opened:
+		release()
+	case <-time.After(5 * time.Second):
+		t.Fatal("the large image is not decoded once the first one is released")
+	}
+
+	// Everything released, the whole budget is available again.
+	if !decoding.TryAcquire(150 * 100) {
+		t.Fatal("the budget is not entirely released")
+	}
+}
+
+func TestOpenImageTooLarge(t *testing.T) {
+	// The header is read before anything is decoded or reserved.
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 1, 1)), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := encoded.Bytes()
+	// The size of the frame is at offset 5 of the SOF0 segment.
+	sof := bytes.Index(data, []byte{0xff, 0xc0})
+	data[sof+5], data[sof+6], data[sof+7], data[sof+8] = 0xff, 0xff, 0xff, 0xff
+
+	if _, _, err := openImage(writeTestFile(t, data)); err == nil || !strings.Contains(err.Error(), "65535x65535 pixels") {
+		t.Fatalf("got error %v opening an image of 65535x65535 pixels", err)
+	}
+}
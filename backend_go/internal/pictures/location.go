@@ -0,0 +1,236 @@
+package pictures
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/gin-gonic/gin"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Location privacy levels, from the least to the most private.
+const (
+	LocationExact  = "exact"
+	LocationCoarse = "coarse"
+	LocationHidden = "hidden"
+)
+
+var LocationPrivacyLevels = []string{LocationExact, LocationCoarse, LocationHidden}
+
+// LocationPolicy returns by picture UUID the privacy level other parts of the catalog
+// require for the given pictures, such as the species they show.
+type LocationPolicy func(pictures []Picture) (map[string]string, error)
+
+var locationPolicies []LocationPolicy
+var locationPoliciesMutex sync.RWMutex
+
+var altitudePattern = regexp.MustCompile(`^-?\d+(\.\d+)?`)
+
+func RegisterLocationPolicy(policy LocationPolicy) {
+	locationPoliciesMutex.Lock()
+	defer locationPoliciesMutex.Unlock()
+	locationPolicies = append(locationPolicies, policy)
+}
+
+func IsLocationPrivacy(level string) bool {
+	return slices.Contains(LocationPrivacyLevels, level)
+}
+
+// StricterPrivacy returns the most private of two levels, an empty level sets nothing.
+func StricterPrivacy(a string, b string) string {
+	if slices.Index(LocationPrivacyLevels, b) > slices.Index(LocationPrivacyLevels, a) {
+		return b
+	}
+	return a
+}
+
+func (p Picture) HasLocation() bool {
+	return p.Latitude != nil && p.Longitude != nil
+}
+
+// readLocation reads the GPS position written by the camera or the phone, exiftool
+// gives the coordinates as decimal degrees and the altitude as "12.3 m Above Sea Level".
+// Positions out of range are ignored.
+func readLocation(fields exifFields, picture *Picture) {
+	latitude, latitudeErr := fields.Float("GPSLatitude")
+	longitude, longitudeErr := fields.Float("GPSLongitude")
+	if latitudeErr != nil || longitudeErr != nil || math.Abs(latitude) > 90 || math.Abs(longitude) > 180 {
+		return
+	}
+	// The coordinates of the GPS group are unsigned, the hemisphere is in the reference.
+	if strings.HasPrefix(fields.String("GPSLatitudeRef"), "S") && latitude > 0 {
+		latitude = -latitude
+	}
+	if strings.HasPrefix(fields.String("GPSLongitudeRef"), "W") && longitude > 0 {
+		longitude = -longitude
+	}
+	picture.Latitude = &latitude
+	picture.Longitude = &longitude
+
+	rawAltitude := fields.String("GPSAltitude")
+	if altitude, err := strconv.ParseFloat(altitudePattern.FindString(rawAltitude), 64); err == nil {
+		if strings.Contains(rawAltitude, "Below") {
+			altitude = -altitude
+		}
+		picture.Altitude = &altitude
+	}
+}
+
+// locationPrivacy resolves the level applying to each picture: the level set on the
+// picture, or the configured default when none is set, made more private by the levels
+// the policies require. The policies never make a position more precise.
+func locationPrivacy(pictures []Picture) (map[string]string, error) {
+	levels := make(map[string]string, len(pictures))
+	for _, picture := range pictures {
+		level := cmp.Or(picture.LocationPrivacy, configs.LocationPrivacy)
+		if !IsLocationPrivacy(level) {
+			level = LocationHidden
+		}
+		levels[picture.UUID] = level
+	}
+
+	locationPoliciesMutex.RLock()
+	defer locationPoliciesMutex.RUnlock()
+	for _, policy := range locationPolicies {
+		required, err := policy(pictures)
+		if err != nil {
+			return nil, err
+		}
+		for uuid, level := range required {
+			if _, ok := levels[uuid]; ok {
+				levels[uuid] = StricterPrivacy(levels[uuid], level)
+			}
+		}
+	}
+	return levels, nil
+}
+
+// coarsen moves a coordinate to the centre of its cell of the grid, rounded to drop the
+// floating point noise.
+func coarsen(coordinate float64) float64 {
+	grid := configs.LocationGridSize
+	return math.Round((math.Floor(coordinate/grid)*grid+grid/2)*1e6) / 1e6
+}
+
+func applyLocationPrivacy(picture Picture, level string) Picture {
+	picture.LocationPrivacy = level
+	if !picture.HasLocation() {
+		return picture
+	}
+
+	switch level {
+	case LocationExact:
+	case LocationCoarse:
+		latitude, longitude := coarsen(*picture.Latitude), coarsen(*picture.Longitude)
+		picture.Latitude, picture.Longitude, picture.Altitude = &latitude, &longitude, nil
+	default:
+		picture.Latitude, picture.Longitude, picture.Altitude = nil, nil, nil
+	}
+	return picture
+}
+
+// PublicPictures returns the pictures as they can be shown publicly, their position
+// coarsened or removed according to their privacy level, which LocationPrivacy then
+// holds. Every public response holding pictures must go through it.
+func PublicPictures(pictures []Picture) ([]Picture, error) {
+	levels, err := locationPrivacy(pictures)
+	if err != nil {
+		return nil, err
+	}
+
+	public := make([]Picture, 0, len(pictures))
+	for _, picture := range pictures {
+		public = append(public, applyLocationPrivacy(picture, levels[picture.UUID]))
+	}
+	return public, nil
+}
+
+func PublicPicture(picture Picture) (Picture, error) {
+	public, err := PublicPictures([]Picture{picture})
+	if err != nil {
+		return Picture{}, err
+	}
+	return public[0], nil
+}
+
+type GeoFeatureCollection struct {
+	Type     string       `json:"type"`
+	Features []GeoFeature `json:"features"`
+}
+
+type GeoFeature struct {
+	Type       string        `json:"type"`
+	Geometry   GeoPoint      `json:"geometry"`
+	Properties GeoProperties `json:"properties"`
+}
+
+type GeoPoint struct {
+	Type string `json:"type"`
+	// Coordinates are the longitude, the latitude and, when known, the altitude.
+	Coordinates []float64 `json:"coordinates"`
+}
+
+type GeoProperties struct {
+	UUID            string `json:"uuid"`
+	Title           string `json:"title"`
+	Timestamp       int    `json:"timestamp"`
+	LocationPrivacy string `json:"location_privacy"`
+}
+
+// GeoJSON lists the pictures having a position as a GeoJSON FeatureCollection.
+func GeoJSON(pictures []Picture) GeoFeatureCollection {
+	collection := GeoFeatureCollection{Type: "FeatureCollection", Features: make([]GeoFeature, 0)}
+	for _, picture := range pictures {
+		if !picture.HasLocation() {
+			continue
+		}
+
+		coordinates := []float64{*picture.Longitude, *picture.Latitude}
+		if picture.Altitude != nil {
+			coordinates = append(coordinates, *picture.Altitude)
+		}
+		collection.Features = append(collection.Features, GeoFeature{
+			Type:     "Feature",
+			Geometry: GeoPoint{Type: "Point", Coordinates: coordinates},
+			Properties: GeoProperties{
+				UUID:            picture.UUID,
+				Title:           picture.Title,
+				Timestamp:       picture.Timestamp,
+				LocationPrivacy: picture.LocationPrivacy,
+			},
+		})
+	}
+	return collection
+}
+
+// GetPicturesGeo gives the public positions of the pictures matching the filter, the
+// pictures whose position is hidden are left out.
+func GetPicturesGeo(c *gin.Context) {
+	filter, err := ParsePublicFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	allPictures, err := repository.List()
+	if err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
+
+	public, err := PublicPictures(filter.Apply(allPictures))
+	if err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
+	c.Header("Content-Type", "application/geo+json")
+	c.JSON(http.StatusOK, GeoJSON(public))
+}
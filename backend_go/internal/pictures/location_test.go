@@ -0,0 +1,126 @@
+package pictures
+
+import (
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"testing"
+)
+
+func TestStricterPrivacy(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{a: LocationExact, b: LocationCoarse, want: LocationCoarse},
+		{a: LocationCoarse, b: LocationExact, want: LocationCoarse},
+		{a: LocationHidden, b: LocationCoarse, want: LocationHidden},
+		{a: LocationExact, b: LocationHidden, want: LocationHidden},
+		{a: LocationCoarse, b: LocationCoarse, want: LocationCoarse},
+		{a: LocationExact, b: "", want: LocationExact},
+		{a: "", b: LocationExact, want: LocationExact},
+	}
+
+	for _, test := range tests {
+		if got := StricterPrivacy(test.a, test.b); got != test.want {
+			t.Errorf("StricterPrivacy(%q, %q) = %q, want %q", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestCoarsen(t *testing.T) {
+	tests := []struct {
+		coordinate float64
+		want       float64
+	}{
+		{coordinate: 45.5432, want: 45.55},
+		{coordinate: 45.5, want: 45.55},
+		{coordinate: 45.4999, want: 45.45},
+		{coordinate: 6.1234, want: 6.15},
+		{coordinate: 0, want: 0.05},
+		{coordinate: -0.01, want: -0.05},
+		{coordinate: -122.4194, want: -122.45},
+	}
+
+	for _, test := range tests {
+		if got := coarsen(test.coordinate); got != test.want {
+			t.Errorf("coarsen(%v) = %v, want %v", test.coordinate, got, test.want)
+		}
+	}
+}
+
+// useLocationPolicy runs the test with a single policy requiring level for every
+// picture, as a species showing them would, and the given default level.
+func useLocationPolicy(t *testing.T, level string, defaultLevel string) {
+	t.Helper()
+	previousPolicies, previousDefault := locationPolicies, configs.LocationPrivacy
+	locationPolicies = []LocationPolicy{func(pictures []Picture) (map[string]string, error) {
+		levels := make(map[string]string)
+		if level != "" {
+			for _, picture := range pictures {
+				levels[picture.UUID] = level
+			}
+		}
+		return levels, nil
+	}}
+	configs.LocationPrivacy = defaultLevel
+	t.Cleanup(func() {
+		locationPolicies, configs.LocationPrivacy = previousPolicies, previousDefault
+	})
+}
+
+func TestPublicPictures(t *testing.T) {
+	tests := []struct {
+		picture      string
+		species      string
+		defaultLevel string
+		want         string
+	}{
+		{picture: "", species: "", defaultLevel: LocationCoarse, want: LocationCoarse},
+		{picture: "", species: LocationExact, defaultLevel: LocationCoarse, want: LocationCoarse},
+		{picture: "", species: LocationExact, defaultLevel: LocationHidden, want: LocationHidden},
+		{picture: "", species: LocationCoarse, defaultLevel: LocationHidden, want: LocationHidden},
+		{picture: "", species: LocationHidden, defaultLevel: LocationExact, want: LocationHidden},
+		{picture: "", species: "", defaultLevel: LocationExact, want: LocationExact},
+		{picture: LocationExact, species: "", defaultLevel: LocationCoarse, want: LocationExact},
+		{picture: LocationExact, species: LocationCoarse, defaultLevel: LocationExact, want: LocationCoarse},
+		{picture: LocationExact, species: LocationHidden, defaultLevel: LocationCoarse, want: LocationHidden},
+		{picture: LocationCoarse, species: LocationExact, defaultLevel: LocationExact, want: LocationCoarse},
+		{picture: LocationHidden, species: LocationExact, defaultLevel: LocationExact, want: LocationHidden},
+		{picture: LocationHidden, species: LocationCoarse, defaultLevel: LocationExact, want: LocationHidden},
+		{picture: "", species: LocationExact, defaultLevel: "nowhere", want: LocationHidden},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("picture %q species %q default %q", test.picture, test.species, test.defaultLevel), func(t *testing.T) {
+			useLocationPolicy(t, test.species, test.defaultLevel)
+			latitude, longitude, altitude := 45.5432, 6.1234, 1200.0
+			picture := Picture{UUID: "picture", LocationPrivacy: test.picture, Latitude: &latitude, Longitude: &longitude, Altitude: &altitude}
+
+			public, err := PublicPicture(picture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if public.LocationPrivacy != test.want {
+				t.Fatalf("published as %q, want %q", public.LocationPrivacy, test.want)
+			}
+
+			switch test.want {
+			case LocationExact:
+				if !public.HasLocation() || *public.Latitude != latitude || *public.Longitude != longitude || public.Altitude == nil {
+					t.Fatalf("the exact position is not published")
+				}
+			case LocationCoarse:
+				if !public.HasLocation() || *public.Latitude != 45.55 || *public.Longitude != 6.15 || public.Altitude != nil {
+					t.Fatalf("got position %v, %v, altitude %v, want the centre of its cell", *public.Latitude, *public.Longitude, public.Altitude)
+				}
+			case LocationHidden:
+				if public.Latitude != nil || public.Longitude != nil || public.Altitude != nil {
+					t.Fatalf("the hidden position is published")
+				}
+			}
+			if *picture.Latitude != latitude {
+				t.Fatalf("the catalog picture is modified")
+			}
+		})
+	}
+}
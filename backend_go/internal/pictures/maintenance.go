@@ -0,0 +1,246 @@
+package pictures
+
+import (
+	"errors"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/evanespen/vanespen.art_2025/internal/catalog"
+	"image"
+	"os"
+	"path"
+	"slices"
+)
+
+type VerifyReport struct {
+	Pictures int `json:"pictures"`
+	// MissingRenditions lists by picture the rendition files which do not exist.
+	MissingRenditions map[string][]string `json:"missing_renditions"`
+	// OrphanRenditions are the files, and the tile directories, of the rendition
+	// directories no picture refers to.
+	OrphanRenditions []string `json:"orphan_renditions"`
+	// DuplicateChecksums lists by checksum the pictures sharing it.
+	DuplicateChecksums map[string][]string `json:"duplicate_checksums"`
+	// MetadataLeaks are the renditions holding a GPS position, a serial number or the
+	// owner of the camera, every rendition is served publicly by the cdn.
+	MetadataLeaks []MetadataLeak `json:"metadata_leaks"`
+}
+
+type MetadataLeak struct {
+	UUID      string   `json:"uuid"`
+	Rendition string   `json:"rendition"`
+	File      string   `json:"file"`
+	Fields    []string `json:"fields"`
+}
+
+func (r VerifyReport) OK() bool {
+	return len(r.MissingRenditions) == 0 && len(r.OrphanRenditions) == 0 && len(r.DuplicateChecksums) == 0 && len(r.MetadataLeaks) == 0
+}
+
+// Verify checks the catalog against the rendition files in storage, and checks that no
+// rendition exposes sensitive metadata.
+func Verify() (VerifyReport, error) {
+	report := VerifyReport{MissingRenditions: map[string][]string{}, DuplicateChecksums: map[string][]string{}}
+
+	allPictures, err := repository.List()
+	if err != nil {
+		return report, err
+	}
+	report.Pictures = len(allPictures)
+
+	known := make(map[string]bool)
+	checksums := make(map[string][]string)
+	for _, picture := range allPictures {
+		for _, rendition := range Renditions {
+			if !rendition.AppliesTo(picture) {
+				continue
+			}
+			file := rendition.Path(picture)
+			known[file] = true
+			if _, err := os.Stat(file); err != nil {
+				report.MissingRenditions[picture.UUID] = append(report.MissingRenditions[picture.UUID], file)
+				continue
+			}
+
+			if !IsJPEG(file) {
+				continue
+			}
+			fields, err := SensitiveMetadata(file)
+			if err != nil {
+				fields = []string{err.Error()}
+			}
+			if len(fields) > 0 {
+				report.MetadataLeaks = append(report.MetadataLeaks, MetadataLeak{UUID: picture.UUID, Rendition: rendition.Name, File: file, Fields: fields})
+			}
+		}
+		checksums[picture.Checksum] = append(checksums[picture.Checksum], picture.UUID)
+	}
+
+	for checksum, uuids := range checksums {
+		if len(uuids) > 1 {
+			report.DuplicateChecksums[checksum] = uuids
+		}
+	}
+
+	for _, rendition := range Renditions {
+		dir := rendition.Dir
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		for _, entry := range entries {
+			file := path.Join(dir, entry.Name())
+			if entry.IsDir() == rendition.Tiles && !known[file] {
+				report.OrphanRenditions = append(report.OrphanRenditions, file)
+			}
+		}
+	}
+	slices.Sort(report.OrphanRenditions)
+
+	return report, nil
+}
+
+// FixMetadataLeaks rewrites the metadata of the leaking renditions according to their
+// policy.
+func FixMetadataLeaks(leaks []MetadataLeak) error {
+	for _, leak := range leaks {
+		picture, err := repository.Get(leak.UUID)
+		if err != nil {
+			return err
+		}
+		rendition, ok := RenditionByName(leak.Rendition)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownRendition, leak.Rendition)
+		}
+		if err := rendition.RewriteMetadata(picture); err != nil {
+			return fmt.Errorf("unable to rewrite the metadata of %s: %w", leak.File, err)
+		}
+	}
+	return nil
+}
+
+type ReindexReport struct {
+	Changed []Picture `json:"changed"`
+	// Unreadable lists by picture the error met reading its full resolution rendition.
+	Unreadable map[string]string `json:"unreadable"`
+}
+
+// Reindex refreshes the dimensions and orientation of the pictures from their full
+// resolution rendition, and computes the perceptual hashes and placeholders missing. The
+// images are read before the catalog is locked, the transaction only applies the values
+// read to the pictures as they are then, those deleted in between are left out.
+func Reindex(dryRun bool) (ReindexReport, error) {
+	report := ReindexReport{Unreadable: map[string]string{}}
+
+	allPictures, err := repository.List()
+	if err != nil {
+		return report, err
+	}
+
+	var indexed []Picture
+	for _, picture := range allPictures {
+		updated, err := reindexPicture(picture)
+		if err != nil {
+			report.Unreadable[picture.UUID] = err.Error()
+			continue
+		}
+		if !sameIndex(updated, picture) {
+			indexed = append(indexed, updated)
+		}
+	}
+	if dryRun {
+		report.Changed = indexed
+		return report, nil
+	}
+
+	var previous []Picture
+	err = repository.Transaction(func(tx Repository) error {
+		for _, index := range indexed {
+			picture, err := tx.Get(index.UUID)
+			if errors.Is(err, catalog.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			updated := picture
+			updated.SetSize(index.Width, index.Height)
+			updated.PerceptualHash = index.PerceptualHash
+			updated.BlurHash, updated.DominantColor, updated.Placeholder = index.BlurHash, index.DominantColor, index.Placeholder
+			if sameIndex(updated, picture) {
+				continue
+			}
+			if err := tx.Update(updated); err != nil {
+				return err
+			}
+			report.Changed = append(report.Changed, updated)
+			previous = append(previous, picture)
+		}
+		return nil
+	})
+	if err != nil {
+		report.Changed = nil
+		return report, err
+	}
+
+	for i := range report.Changed {
+		publish(Event{Type: PictureUpdated, Picture: report.Changed[i], Previous: &previous[i]})
+	}
+	return report, nil
+}
+
+// reindexPicture returns the picture with the values read from its full resolution
+// rendition, the image is only decoded when a hash or the placeholder is missing.
+func reindexPicture(picture Picture) (Picture, error) {
+	full := path.Join(configs.FullResDir, picture.UUID+picture.Ext)
+	width, height, err := renditionSize(full)
+	if err != nil {
+		return Picture{}, err
+	}
+
+	updated := picture
+	updated.SetSize(width, height)
+	if updated.PerceptualHash != "" && updated.BlurHash != "" {
+		return updated, nil
+	}
+
+	img, release, err := openImage(full)
+	if err != nil {
+		return Picture{}, err
+	}
+	defer release()
+	if updated.PerceptualHash == "" {
+		updated.PerceptualHash = DifferenceHash(img)
+	}
+	if updated.BlurHash == "" {
+		placeholder, err := NewPlaceholder(img)
+		if err != nil {
+			return Picture{}, err
+		}
+		updated.SetPlaceholder(placeholder)
+	}
+	return updated, nil
+}
+
+// sameIndex tells whether the values refreshed by Reindex are the same for both pictures.
+func sameIndex(a Picture, b Picture) bool {
+	return a.Width == b.Width && a.Height == b.Height && a.Landscape == b.Landscape && a.Panoramic == b.Panoramic &&
+		a.PerceptualHash == b.PerceptualHash && a.BlurHash == b.BlurHash && a.DominantColor == b.DominantColor && a.Placeholder == b.Placeholder
+}
+
+func renditionSize(file string) (int, int, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer reader.Close()
+
+	config, _, err := image.DecodeConfig(reader)
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
@@ -0,0 +1,67 @@
+package pictures
+
+import (
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"image/jpeg"
+	"os"
+	"path"
+	"testing"
+)
+
+func writeFullRendition(t *testing.T, picture Picture, width int, height int) {
+	t.Helper()
+	file, err := os.Create(path.Join(configs.FullResDir, picture.UUID+picture.Ext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := jpeg.Encode(file, testImage(width, height), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReindex(t *testing.T) {
+	tests := []struct {
+		name           string
+		dryRun         bool
+		missingFile    bool
+		wantChanged    int
+		wantUnreadable int
+		wantStored     bool
+	}{
+		{name: "refreshed", wantChanged: 1, wantStored: true},
+		{name: "dry run", dryRun: true, wantChanged: 1},
+		{name: "unreadable", missingFile: true, wantUnreadable: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestCatalog(t)
+			// The size stored is the one of a former int16 field which wrapped.
+			picture := Picture{UUID: "panorama", Ext: ".jpg", Width: 600 - 1<<16, Height: 100}
+			insertTestPictures(t, picture)
+			if !test.missingFile {
+				writeFullRendition(t, picture, 600, 100)
+			}
+
+			report, err := Reindex(test.dryRun)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Changed) != test.wantChanged || len(report.Unreadable) != test.wantUnreadable {
+				t.Fatalf("got %d changed and %d unreadable, want %d and %d", len(report.Changed), len(report.Unreadable), test.wantChanged, test.wantUnreadable)
+			}
+			if test.wantChanged > 0 {
+				changed := report.Changed[0]
+				if changed.Width != 600 || !changed.Panoramic || changed.PerceptualHash == "" || changed.BlurHash == "" || changed.Placeholder == "" {
+					t.Errorf("reindexed picture %dx%d panoramic %t, hash %q, blur hash %q", changed.Width, changed.Height, changed.Panoramic, changed.PerceptualHash, changed.BlurHash)
+				}
+			}
+
+			stored, _ := repository.Get(picture.UUID)
+			if (stored.Width == 600 && stored.BlurHash != "") != test.wantStored {
+				t.Errorf("stored %dx%d with blur hash %q, want the reindexed values stored %t", stored.Width, stored.Height, stored.BlurHash, test.wantStored)
+			}
+		})
+	}
+}
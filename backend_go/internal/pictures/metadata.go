@@ -0,0 +1,289 @@
+package pictures
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"github.com/disintegration/imaging"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"io"
+	"os"
+	"strings"
+)
+
+// MetadataPolicy is the metadata written in a rendition. The renditions are encoded
+// without the metadata of the upload, so the GPS position, the serial numbers and the
+// owner of the camera never reach them, the policy only adds the credits.
+type MetadataPolicy struct {
+	// KeepCredits writes the creator and the copyright read from the upload.
+	KeepCredits bool
+	// Licence writes the copyright, creator and licence configured for the site, they
+	// take precedence over the credits of the upload.
+	Licence bool
+}
+
+var errInvalidJPEG = errors.New("invalid JPEG")
+
+const xmpNamespace = "http://ns.adobe.com/xap/1.0/\x00"
+const exifHeader = "Exif\x00\x00"
+const maxSegmentLength = 65533
+
+// JPEG markers.
+const (
+	markerSOI  = 0xD8
+	markerEOI  = 0xD9
+	markerSOS  = 0xDA
+	markerAPP0 = 0xE0
+	markerAPP1 = 0xE1
+	markerAPP2 = 0xE2
+	markerAPPE = 0xEE
+	markerAPPF = 0xEF
+	markerCOM  = 0xFE
+)
+
+// EXIF tags revealing where the picture was taken or who owns the camera.
+var sensitiveExifTags = map[uint16]string{
+	0x8825: "GPS",
+	0xA430: "CameraOwnerName",
+	0xA431: "BodySerialNumber",
+	0xA435: "LensSerialNumber",
+}
+
+var sensitiveXMPProperties = []string{"exif:GPS", "exifEX:CameraOwnerName", "exifEX:BodySerialNumber", "exifEX:LensSerialNumber", "aux:SerialNumber", "aux:OwnerName", "aux:LensSerialNumber"}
+
+type segment struct {
+	marker byte
+	data   []byte
+}
+
+// readSegments reads the segments of a JPEG up to the start of the scan, and returns the
+// offset of the scan, the image data runs from there to the end of the file. The offset
+// is -1 when the file holds no scan.
+func readSegments(reader *bufio.Reader) ([]segment, int, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(reader, soi[:]); err != nil || soi[0] != 0xFF || soi[1] != markerSOI {
+		return nil, 0, errInvalidJPEG
+	}
+	offset := len(soi)
+
+	var segments []segment
+	for {
+		start := offset
+		marker, err := reader.ReadByte()
+		if err != nil || marker != 0xFF {
+			return nil, 0, errInvalidJPEG
+		}
+		// Markers may be padded with any number of 0xFF.
+		for marker == 0xFF {
+			if marker, err = reader.ReadByte(); err != nil {
+				return nil, 0, errInvalidJPEG
+			}
+			offset++
+		}
+		offset++
+		switch marker {
+		case markerEOI:
+			return segments, -1, nil
+		case markerSOS:
+			return segments, start, nil
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(reader, length[:]); err != nil || binary.BigEndian.Uint16(length[:]) < 2 {
+			return nil, 0, errInvalidJPEG
+		}
+		data := make([]byte, binary.BigEndian.Uint16(length[:])-2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, 0, errInvalidJPEG
+		}
+		offset += len(length) + len(data)
+		segments = append(segments, segment{marker: marker, data: data})
+	}
+}
+
+// keepSegment tells whether a segment is needed to decode the image: the JFIF header,
+// the colour profile and the Adobe colour transform. The others are metadata.
+func keepSegment(s segment) bool {
+	switch {
+	case s.marker == markerAPP0:
+		return true
+	case s.marker == markerAPP2:
+		return bytes.HasPrefix(s.data, []byte("ICC_PROFILE\x00"))
+	case s.marker == markerAPPE:
+		return bytes.HasPrefix(s.data, []byte("Adobe"))
+	case s.marker >= markerAPP1 && s.marker <= markerAPPF, s.marker == markerCOM:
+		return false
+	default:
+		return true
+	}
+}
+
+// Apply removes the metadata from a JPEG and writes the XMP packet of the policy, if
+// any. The image data is copied as is, once, the JPEG of a large image is big.
+func (p MetadataPolicy) Apply(jpeg []byte, picture Picture) ([]byte, error) {
+	segments, scan, err := readSegments(bufio.NewReader(bytes.NewReader(jpeg)))
+	if err != nil {
+		return nil, err
+	}
+	if scan < 0 {
+		return nil, errInvalidJPEG
+	}
+
+	packet := p.xmpPacket(picture)
+	if len(xmpNamespace)+len(packet) > maxSegmentLength {
+		return nil, errors.New("XMP packet too large")
+	}
+
+	var output bytes.Buffer
+	output.Grow(len(jpeg) + len(xmpNamespace) + len(packet) + 4)
+	output.Write([]byte{0xFF, markerSOI})
+	// The XMP packet goes after the JFIF header, which must come first.
+	for len(segments) > 0 && segments[0].marker == markerAPP0 {
+		writeSegment(&output, segments[0])
+		segments = segments[1:]
+	}
+	if packet != "" {
+		writeSegment(&output, segment{marker: markerAPP1, data: []byte(xmpNamespace + packet)})
+	}
+	for _, s := range segments {
+		if keepSegment(s) {
+			writeSegment(&output, s)
+		}
+	}
+	output.Write(jpeg[scan:])
+	return output.Bytes(), nil
+}
+
+func writeSegment(output *bytes.Buffer, s segment) {
+	output.Write([]byte{0xFF, s.marker})
+	_ = binary.Write(output, binary.BigEndian, uint16(len(s.data)+2))
+	output.Write(s.data)
+}
+
+// xmpPacket returns the XMP packet holding the credits of the policy, empty when there
+// is nothing to write.
+func (p MetadataPolicy) xmpPacket(picture Picture) string {
+	var creator, rights, licence string
+	if p.KeepCredits {
+		creator, rights = picture.Creator, picture.Copyright
+	}
+	if p.Licence {
+		creator = cmp.Or(configs.Creator, creator)
+		rights = cmp.Or(configs.Copyright, rights)
+		licence = configs.LicenceURL
+	}
+	if creator == "" && rights == "" && licence == "" {
+		return ""
+	}
+
+	var packet strings.Builder
+	packet.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	packet.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n<rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	packet.WriteString("<rdf:Description rdf:about=\"\" xmlns:dc=\"http://purl.org/dc/elements/1.1/\" xmlns:xmpRights=\"http://ns.adobe.com/xap/1.0/rights/\" xmlns:cc=\"http://creativecommons.org/ns#\">\n")
+	if creator != "" {
+		packet.WriteString("<dc:creator><rdf:Seq><rdf:li>" + escapeXML(creator) + "</rdf:li></rdf:Seq></dc:creator>\n")
+	}
+	if rights != "" {
+		packet.WriteString("<dc:rights><rdf:Alt><rdf:li xml:lang=\"x-default\">" + escapeXML(rights) + "</rdf:li></rdf:Alt></dc:rights>\n")
+		packet.WriteString("<xmpRights:Marked>True</xmpRights:Marked>\n")
+	}
+	if licence != "" {
+		packet.WriteString("<xmpRights:WebStatement>" + escapeXML(licence) + "</xmpRights:WebStatement>\n")
+		packet.WriteString("<cc:license rdf:resource=\"" + escapeXML(licence) + "\"/>\n")
+	}
+	packet.WriteString("</rdf:Description>\n</rdf:RDF>\n</x:xmpmeta>\n<?xpacket end=\"r\"?>")
+	return packet.String()
+}
+
+func escapeXML(value string) string {
+	var escaped strings.Builder
+	_ = xml.EscapeText(&escaped, []byte(value))
+	return escaped.String()
+}
+
+// IsJPEG tells from its extension whether a rendition is a JPEG, the renditions in the
+// other formats are encoded without any metadata.
+func IsJPEG(filename string) bool {
+	format, err := imaging.FormatFromFilename(filename)
+	return err == nil && format == imaging.JPEG
+}
+
+// SensitiveMetadata lists the sensitive EXIF and XMP fields of a JPEG file: the GPS
+// position, the serial numbers and the owner of the camera.
+func SensitiveMetadata(file string) ([]string, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	segments, _, err := readSegments(bufio.NewReader(reader))
+	if err != nil {
+		return nil, err
+	}
+
+	var found []string
+	for _, s := range segments {
+		if s.marker != markerAPP1 {
+			continue
+		}
+		if bytes.HasPrefix(s.data, []byte(exifHeader)) {
+			found = append(found, sensitiveExifFields(s.data[len(exifHeader):])...)
+		}
+		if bytes.HasPrefix(s.data, []byte(xmpNamespace)) {
+			for _, property := range sensitiveXMPProperties {
+				if bytes.Contains(s.data, []byte(property)) {
+					found = append(found, "XMP "+property)
+				}
+			}
+		}
+	}
+	return found, nil
+}
+
+// sensitiveExifFields looks for the sensitive tags in the first IFD of the TIFF
+// structure of the EXIF data and in the EXIF IFD it points to.
+func sensitiveExifFields(tiff []byte) []string {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(tiff, []byte("II*\x00")):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(tiff, []byte("MM\x00*")):
+		order = binary.BigEndian
+	default:
+		return []string{"EXIF"}
+	}
+
+	var found []string
+	visited := make(map[uint32]bool)
+	var walk func(offset uint32)
+	walk = func(offset uint32) {
+		if visited[offset] || int(offset)+2 > len(tiff) {
+			return
+		}
+		visited[offset] = true
+
+		count := int(order.Uint16(tiff[offset:]))
+		for i := 0; i < count; i++ {
+			entry := int(offset) + 2 + i*12
+			if entry+12 > len(tiff) {
+				return
+			}
+			tag := order.Uint16(tiff[entry:])
+			if name, ok := sensitiveExifTags[tag]; ok {
+				found = append(found, "EXIF "+name)
+			}
+			// The EXIF IFD holds the serial numbers and the owner.
+			if tag == 0x8769 {
+				walk(order.Uint32(tiff[entry+8:]))
+			}
+		}
+	}
+	if len(tiff) >= 8 {
+		walk(order.Uint32(tiff[4:]))
+	}
+	return found
+}
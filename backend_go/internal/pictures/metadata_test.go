@@ -0,0 +1,157 @@
+package pictures
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+type ifdEntry struct {
+	tag   uint16
+	kind  uint16
+	count uint32
+	value uint32
+}
+
+// sensitiveExif builds a little endian TIFF structure holding a GPS IFD, and an EXIF IFD
+// with the owner and the serial number of the camera.
+func sensitiveExif() []byte {
+	const ifdSize = 2 + 2*12 + 4
+	const exifOffset, gpsOffset = 8 + ifdSize, 8 + 2*ifdSize
+	ifds := [][]ifdEntry{
+		{{0x8769, 4, 1, exifOffset}, {0x8825, 4, 1, gpsOffset}},
+		{{0xA430, 2, 4, binary.LittleEndian.Uint32([]byte("Own\x00"))}, {0xA431, 2, 4, binary.LittleEndian.Uint32([]byte("123\x00"))}},
+		{{0x0001, 2, 2, binary.LittleEndian.Uint32([]byte("N\x00\x00\x00"))}, {0x0002, 4, 1, 45}},
+	}
+
+	var tiff bytes.Buffer
+	tiff.WriteString("II*\x00")
+	_ = binary.Write(&tiff, binary.LittleEndian, uint32(8))
+	for _, entries := range ifds {
+		_ = binary.Write(&tiff, binary.LittleEndian, uint16(len(entries)))
+		for _, entry := range entries {
+			_ = binary.Write(&tiff, binary.LittleEndian, entry)
+		}
+		_ = binary.Write(&tiff, binary.LittleEndian, uint32(0))
+	}
+	return tiff.Bytes()
+}
+
+// sensitiveJPEG encodes img as a JPEG carrying the GPS position, the owner and the
+// serial numbers as EXIF, XMP and a comment, as a camera or a phone writes them.
+func sensitiveJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	xmp := xmpNamespace + `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description exif:GPSLatitude="45,30.0N" exifEX:BodySerialNumber="123" exifEX:CameraOwnerName="Own" aux:SerialNumber="123" aux:LensSerialNumber="456"/>` +
+		`</rdf:RDF></x:xmpmeta>`
+
+	var output bytes.Buffer
+	output.Write(encoded.Bytes()[:2])
+	writeSegment(&output, segment{marker: markerAPP1, data: append([]byte(exifHeader), sensitiveExif()...)})
+	writeSegment(&output, segment{marker: markerAPP1, data: []byte(xmp)})
+	writeSegment(&output, segment{marker: markerCOM, data: []byte("GPS 45.5N 6.1E")})
+	output.Write(encoded.Bytes()[2:])
+	return output.Bytes()
+}
+
+func testImage(width int, height int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(x + y), A: 255})
+		}
+	}
+	return img
+}
+
+func sensitiveTestPicture() Picture {
+	latitude, longitude := 45.5, 6.1
+	picture := Picture{UUID: "sensitive", Ext: ".jpg", Latitude: &latitude, Longitude: &longitude, Creator: "Creator", Copyright: "Copyright"}
+	picture.SetSize(1200, 300)
+	return picture
+}
+
+func writeTestFile(t *testing.T, data []byte) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "test.jpg")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestSensitiveMetadataFixture(t *testing.T) {
+	found, err := SensitiveMetadata(writeTestFile(t, sensitiveJPEG(t, testImage(64, 16))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"EXIF GPS", "EXIF CameraOwnerName", "EXIF BodySerialNumber", "XMP exif:GPS", "XMP exifEX:BodySerialNumber", "XMP aux:SerialNumber"} {
+		if !slices.Contains(found, field) {
+			t.Errorf("%s not found in %v", field, found)
+		}
+	}
+}
+
+// TestRenditionsDropSensitiveMetadata checks that no size served by the CDN gives the
+// position, the owner or the serial numbers, whether the rendition is encoded from the
+// upload or has its metadata rewritten.
+func TestRenditionsDropSensitiveMetadata(t *testing.T) {
+	useTestCatalog(t)
+	picture := sensitiveTestPicture()
+	upload := sensitiveJPEG(t, testImage(picture.Width, picture.Height))
+
+	for _, rendition := range Renditions {
+		t.Run(rendition.Name+" applied", func(t *testing.T) {
+			data, err := rendition.Metadata.Apply(upload, picture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found, err := SensitiveMetadata(writeTestFile(t, data)); err != nil || len(found) > 0 {
+				t.Fatalf("sensitive metadata %v, error %v", found, err)
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+				t.Fatalf("rendition cannot be decoded: %v", err)
+			}
+		})
+
+		t.Run(rendition.Name+" saved", func(t *testing.T) {
+			if !rendition.AppliesTo(picture) {
+				t.Fatalf("the test picture has no %s rendition", rendition.Name)
+			}
+			source, err := jpeg.Decode(bytes.NewReader(upload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rendition.save(source, source.Bounds().Size(), picture); err != nil {
+				t.Fatal(err)
+			}
+
+			checked := 0
+			err = filepath.WalkDir(rendition.Path(picture), func(file string, entry fs.DirEntry, err error) error {
+				if err != nil || entry.IsDir() || !IsJPEG(file) {
+					return err
+				}
+				checked++
+				if found, err := SensitiveMetadata(file); err != nil || len(found) > 0 {
+					t.Errorf("%s: sensitive metadata %v, error %v", file, found, err)
+				}
+				return nil
+			})
+			if err != nil || checked == 0 {
+				t.Fatalf("checked %d files, error %v", checked, err)
+			}
+		})
+	}
+}
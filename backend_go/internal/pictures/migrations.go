@@ -0,0 +1,119 @@
+package pictures
+
+import (
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/internal/catalog"
+)
+
+func init() {
+	catalog.RegisterMigration(catalogName, catalog.Migration{
+		Version:     2,
+		Description: "add original_values to keep EXIF values replaced by corrections",
+		Up: func(row catalog.Row) error {
+			row["original_values"] = map[string]string{}
+			return nil
+		},
+	})
+
+	catalog.RegisterMigration(catalogName, catalog.Migration{
+		Version:     3,
+		Description: "add rendition_versions, existing renditions were made with the first profiles",
+		Up: func(row catalog.Row) error {
+			row["rendition_versions"] = map[string]int32{"full": 1, "half": 1, "thumb": 1, "tiny": 1}
+			return nil
+		},
+	})
+
+	catalog.RegisterMigration(catalogName, catalog.Migration{
+		Version:     4,
+		Description: "add perceptual_hash, computed for existing pictures by reindex",
+		Up: func(row catalog.Row) error {
+			row["perceptual_hash"] = ""
+			return nil
+		},
+	})
+
+	catalog.RegisterMigration(catalogName, catalog.Migration{
+		Version:     5,
+		Description: "add title, tags and rating, left empty for the pictures already ingested",
+		Up: func(row catalog.Row) error {
+			row["title"] = ""
+			row["tags"] = []string{}
+			row["rating"] = int32(0)
+			return nil
+		},
+	})
+
+	catalog.RegisterMigration(catalogName, catalog.Migration{
+		Version:     6,
+		Description: "add the GPS position, unknown for the pictures already ingested, and location_privacy",
+		Up: func(row catalog.Row) error {
+			row["latitude"] = nil
+			row["longitude"] = nil
+			row["altitude"] = nil
+			row["location_privacy"] = ""
+			return nil
+		},
+	})
+
+	catalog.RegisterMigration(catalogName, catalog.Migration{
+		Version:     7,
+		Description: "add creator and copyright, left empty for the pictures already ingested",
+		Up: func(row catalog.Row) error {
+			row["creator"] = ""
+			row["copyright"] = ""
+			return nil
+		},
+	})
+
+	catalog.RegisterMigration(catalogName, catalog.Migration{
+		Version:     8,
+		Description: "add filename, unknown for the pictures already ingested, and stacks, each of them in a stack of its own",
+		Up: func(row catalog.Row) error {
+			row["filename"] = ""
+			row["stack"] = row["uuid"]
+			row["stack_cover"] = true
+			return nil
+		},
+	})
+
+	catalog.RegisterMigration(catalogName, catalog.Migration{
+		Version:     9,
+		Description: "widen width, height and iso to INT64, recovering the values which overflowed the former int16 fields, and derive the orientation again from the recovered size",
+		Up: func(row catalog.Row) error {
+			for _, column := range []string{"width", "height", "iso"} {
+				value, ok := row[column].(int32)
+				if !ok {
+					return fmt.Errorf("%s is not an INT32: %v", column, row[column])
+				}
+				row[column] = unwrapInt16(value)
+			}
+
+			var picture Picture
+			picture.SetSize(int(row["width"].(int64)), int(row["height"].(int64)))
+			row["landscape"] = picture.Landscape
+			row["panoramic"] = picture.Panoramic
+			return nil
+		},
+	})
+
+	catalog.RegisterMigration(catalogName, catalog.Migration{
+		Version:     10,
+		Description: "add blur_hash, dominant_color and placeholder, computed for existing pictures by reindex",
+		Up: func(row catalog.Row) error {
+			row["blur_hash"] = ""
+			row["dominant_color"] = ""
+			row["placeholder"] = ""
+			return nil
+		},
+	})
+}
+
+// unwrapInt16 recovers a value stored in an int16 field, the values from 32768 to 65535
+// wrapped to negative ones. Reindex reads the exact size of the larger images.
+func unwrapInt16(value int32) int64 {
+	if value < 0 {
+		return int64(value) + 1<<16
+	}
+	return int64(value)
+}
@@ -0,0 +1,55 @@
+package pictures
+
+import (
+	"github.com/evanespen/vanespen.art_2025/internal/catalog"
+	"testing"
+)
+
+func migration(t *testing.T, version int) catalog.Migration {
+	t.Helper()
+	for _, migration := range catalog.PendingMigrations(catalogName, version-1) {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	t.Fatalf("no migration to version %d", version)
+	return catalog.Migration{}
+}
+
+func TestMigrationWidenSizes(t *testing.T) {
+	tests := []struct {
+		name                 string
+		width, height, iso   int32
+		landscape, panoramic bool
+		wantWidth            int64
+		wantHeight           int64
+		wantIso              int64
+		wantLandscape        bool
+		wantPanoramic        bool
+	}{
+		{name: "small", width: 6000, height: 4000, iso: 100, landscape: true, wantWidth: 6000, wantHeight: 4000, wantIso: 100, wantLandscape: true},
+		{name: "wrapped panorama", width: 40000 - 1<<16, height: 60, iso: 51200 - 1<<16, wantWidth: 40000, wantHeight: 60, wantIso: 51200, wantLandscape: true, wantPanoramic: true},
+		{name: "wrapped height", width: 500, height: 36000 - 1<<16, iso: 200, landscape: true, wantWidth: 500, wantHeight: 36000, wantIso: 200},
+		{name: "wrapped square", width: 40000 - 1<<16, height: 40000 - 1<<16, wantWidth: 40000, wantHeight: 40000},
+	}
+
+	up := migration(t, 9).Up
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			row := catalog.Row{"width": test.width, "height": test.height, "iso": test.iso, "landscape": test.landscape, "panoramic": test.panoramic}
+			if err := up(row); err != nil {
+				t.Fatal(err)
+			}
+			if row["width"] != test.wantWidth || row["height"] != test.wantHeight || row["iso"] != test.wantIso {
+				t.Errorf("got %vx%v ISO %v, want %dx%d ISO %d", row["width"], row["height"], row["iso"], test.wantWidth, test.wantHeight, test.wantIso)
+			}
+			if row["landscape"] != test.wantLandscape || row["panoramic"] != test.wantPanoramic {
+				t.Errorf("got landscape %v panoramic %v, want %t %t", row["landscape"], row["panoramic"], test.wantLandscape, test.wantPanoramic)
+			}
+		})
+	}
+
+	if err := up(catalog.Row{"width": int64(1), "height": int32(1), "iso": int32(1)}); err == nil {
+		t.Error("a width which is not an INT32 is accepted")
+	}
+}
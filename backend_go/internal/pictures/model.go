@@ -7,6 +7,8 @@ import (
 	"github.com/evanespen/vanespen.art_2025/internal/utils"
 	"math"
 	"path"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,22 +20,127 @@ type Picture struct {
 	Camera         string `json:"camera" parquet:"name=camera, type=BYTE_ARRAY, encoding=DELTA_LENGTH_BYTE_ARRAY"`
 	Mode           string `json:"mode" parquet:"name=mode, type=BYTE_ARRAY, encoding=DELTA_LENGTH_BYTE_ARRAY"`
 	Aperture       string `json:"aperture" parquet:"name=aperture, type=BYTE_ARRAY, encoding=DELTA_LENGTH_BYTE_ARRAY"`
-	Iso            int16  `json:"iso" parquet:"name=iso, type=INT32, encoding=DELTA_BINARY_PACKED"`
+	Iso            int    `json:"iso" parquet:"name=iso, type=INT64, encoding=DELTA_BINARY_PACKED"`
 	Speed          string `json:"speed" parquet:"name=speed, type=BYTE_ARRAY, encoding=DELTA_LENGTH_BYTE_ARRAY"`
 	FocalLength    string `json:"focal_length" parquet:"name=focal_length, type=BYTE_ARRAY, encoding=DELTA_LENGTH_BYTE_ARRAY"`
 	Lens           string `json:"lens" parquet:"name=lens, type=BYTE_ARRAY, encoding=DELTA_LENGTH_BYTE_ARRAY"`
 	Flash          bool   `json:"flash" parquet:"name=flash, type=BOOLEAN, encoding=PLAIN"`
 	Landscape      bool   `json:"landscape" parquet:"name=landscape, type=BOOLEAN, encoding=PLAIN"`
 	Panoramic      bool   `json:"panoramic" parquet:"name=panoramic, type=BOOLEAN, encoding=PLAIN"`
-	Width          int16  `json:"width" parquet:"name=width, type=INT32, encoding=DELTA_BINARY_PACKED"`
-	Height         int16  `json:"height" parquet:"name=height, type=INT32, encoding=DELTA_BINARY_PACKED"`
+	Width          int    `json:"width" parquet:"name=width, type=INT64, encoding=DELTA_BINARY_PACKED"`
+	Height         int    `json:"height" parquet:"name=height, type=INT64, encoding=DELTA_BINARY_PACKED"`
 	Favourite      bool   `json:"favourite" parquet:"name=favourite, type=BOOLEAN, encoding=PLAIN"`
 	TriggerWarning bool   `json:"trigger_warning" parquet:"name=trigger_warning, type=BOOLEAN, encoding=PLAIN"`
 	Description    string `json:"description" parquet:"name=description, type=BYTE_ARRAY, encoding=DELTA_LENGTH_BYTE_ARRAY"`
+
+	// OriginalValues keeps the value extracted at ingest of the EXIF fields corrected since.
+	OriginalValues map[string]string `json:"original_values" parquet:"name=original_values, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+
+	// RenditionVersions holds by rendition name the version of the profile it was made with.
+	RenditionVersions map[string]int32 `json:"rendition_versions" parquet:"name=rendition_versions, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=INT32"`
+
+	// PerceptualHash is the DifferenceHash of the image, empty until computed for the
+	// pictures ingested before it existed.
+	PerceptualHash string `json:"perceptual_hash" parquet:"name=perceptual_hash, type=BYTE_ARRAY, convertedtype=UTF8, encoding=DELTA_LENGTH_BYTE_ARRAY"`
+
+	// Title, Tags and Rating are read at ingest from the IPTC and XMP metadata, the
+	// caption goes to the Description. Rating is the 0 to 5 stars of the picture.
+	Title  string   `json:"title" parquet:"name=title, type=BYTE_ARRAY, convertedtype=UTF8, encoding=DELTA_LENGTH_BYTE_ARRAY"`
+	Tags   []string `json:"tags" parquet:"name=tags, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	Rating int32    `json:"rating" parquet:"name=rating, type=INT32, encoding=DELTA_BINARY_PACKED"`
+
+	// Latitude, Longitude and Altitude are the GPS position in degrees and meters, nil
+	// when unknown. LocationPrivacy is the privacy level set on the picture, if any.
+	Latitude        *float64 `json:"latitude" parquet:"name=latitude, type=DOUBLE, repetitiontype=OPTIONAL"`
+	Longitude       *float64 `json:"longitude" parquet:"name=longitude, type=DOUBLE, repetitiontype=OPTIONAL"`
+	Altitude        *float64 `json:"altitude" parquet:"name=altitude, type=DOUBLE, repetitiontype=OPTIONAL"`
+	LocationPrivacy string   `json:"location_privacy" parquet:"name=location_privacy, type=BYTE_ARRAY, convertedtype=UTF8, encoding=DELTA_LENGTH_BYTE_ARRAY"`
+
+	// Creator and Copyright are the credits read from the upload, written back in the
+	// renditions whose MetadataPolicy keeps them.
+	Creator   string `json:"creator" parquet:"name=creator, type=BYTE_ARRAY, convertedtype=UTF8, encoding=DELTA_LENGTH_BYTE_ARRAY"`
+	Copyright string `json:"copyright" parquet:"name=copyright, type=BYTE_ARRAY, convertedtype=UTF8, encoding=DELTA_LENGTH_BYTE_ARRAY"`
+
+	// Filename is the name of the uploaded file. Stack groups the versions of a frame,
+	// the original and its edits, StackCover marks the one shown in the public listings.
+	Filename   string `json:"filename" parquet:"name=filename, type=BYTE_ARRAY, convertedtype=UTF8, encoding=DELTA_LENGTH_BYTE_ARRAY"`
+	Stack      string `json:"stack" parquet:"name=stack, type=BYTE_ARRAY, convertedtype=UTF8, encoding=DELTA_BYTE_ARRAY"`
+	StackCover bool   `json:"stack_cover" parquet:"name=stack_cover, type=BOOLEAN, encoding=PLAIN"`
+
+	// BlurHash, DominantColor and Placeholder are painted by the galleries while the
+	// picture loads, empty until computed for the pictures ingested before them.
+	BlurHash      string `json:"blur_hash" parquet:"name=blur_hash, type=BYTE_ARRAY, convertedtype=UTF8, encoding=DELTA_LENGTH_BYTE_ARRAY"`
+	DominantColor string `json:"dominant_color" parquet:"name=dominant_color, type=BYTE_ARRAY, convertedtype=UTF8, encoding=DELTA_LENGTH_BYTE_ARRAY"`
+	Placeholder   string `json:"placeholder" parquet:"name=placeholder, type=BYTE_ARRAY, convertedtype=UTF8, encoding=DELTA_LENGTH_BYTE_ARRAY"`
+}
+
+// ErrUnsupportedImage is returned for files that cannot be ingested, as opposed to
+// errors of the server itself.
+var ErrUnsupportedImage = errors.New("unsupported image")
+
+// maxCreditLength bounds the credits read from the upload, they are written back in
+// the renditions where a metadata segment is limited to 64 KiB.
+const maxCreditLength = 1000
+
+type exifFields map[string]interface{}
+
+// String returns the field as a string, exiftool reports some textual fields as numbers.
+func (f exifFields) String(key string) string {
+	switch value := f[key].(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// First returns the first of the fields which is set, the same data is often written
+// both as IPTC and XMP under different names.
+func (f exifFields) First(keys ...string) string {
+	for _, key := range keys {
+		if value := strings.TrimSpace(f.String(key)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Strings gathers the values of list fields, exiftool reports a list holding a single
+// value as that value.
+func (f exifFields) Strings(keys ...string) []string {
+	var values []string
+	for _, key := range keys {
+		switch value := f[key].(type) {
+		case []interface{}:
+			for _, item := range value {
+				values = append(values, exifFields{key: item}.String(key))
+			}
+		default:
+			values = append(values, f.String(key))
+		}
+	}
+	return values
+}
+
+func (f exifFields) Float(key string) (float64, error) {
+	switch value := f[key].(type) {
+	case float64:
+		return value, nil
+	case string:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: invalid %s: %s", ErrUnsupportedImage, key, value)
+		}
+		return parsed, nil
+	default:
+		return 0, fmt.Errorf("%w: missing %s", ErrUnsupportedImage, key)
+	}
 }
 
 func NewPicture(imagePath string, pictureUUID string) (Picture, error) {
-	et, err := exiftool.NewExiftool()
+	et, err := exiftool.NewExiftool(exiftool.CoordFormant("%.8f"))
 	if err != nil {
 		fmt.Printf("Error when intializing: %v\n", err)
 		return Picture{}, errors.New(fmt.Sprintf("Error when intializing: %v\n", err))
@@ -43,7 +150,12 @@ func NewPicture(imagePath string, pictureUUID string) (Picture, error) {
 	fileInfos := et.ExtractMetadata(imagePath)
 	extension := path.Ext(imagePath)
 
-	datetime, err := time.Parse("2006:01:02 15:04:05", fileInfos[0].Fields["DateTimeOriginal"].(string))
+	if len(fileInfos) == 0 || fileInfos[0].Err != nil {
+		return Picture{}, fmt.Errorf("%w: cannot read metadata", ErrUnsupportedImage)
+	}
+	fields := exifFields(fileInfos[0].Fields)
+
+	datetime, err := time.Parse("2006:01:02 15:04:05", fields.String("DateTimeOriginal"))
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -51,47 +163,60 @@ func NewPicture(imagePath string, pictureUUID string) (Picture, error) {
 
 	checksum, _ := utils.CalculateSHA256Checksum(imagePath)
 
-	//for _, fileInfo := range fileInfos {
-	//	if fileInfo.Err != nil {
-	//		fmt.Printf("Error concerning %v: %v\n", fileInfo.File, fileInfo.Err)
-	//		continue
-	//	}
-	//
-	//	for k, v := range fileInfo.Fields {
-	//		fmt.Printf("[%v] %v\n", k, v)
-	//	}
-	//}
-
-	width := int16(fileInfos[0].Fields["ImageWidth"].(float64))
-	height := int16(fileInfos[0].Fields["ImageHeight"].(float64))
-	landscape := width > height
-
-	var panoramic bool
-	if landscape && float32(width)/float32(height) > 1.5 {
-		panoramic = true
-	} else {
-		panoramic = false
+	imageWidth, err := fields.Float("ImageWidth")
+	if err != nil {
+		return Picture{}, err
+	}
+	imageHeight, err := fields.Float("ImageHeight")
+	if err != nil {
+		return Picture{}, err
 	}
 
-	return Picture{
+	fNumber, _ := fields.Float("FNumber")
+	iso, _ := fields.Float("ISO")
+	rating, _ := fields.Float("Rating")
+
+	picture := Picture{
 		UUID:           pictureUUID,
 		Ext:            extension,
 		Checksum:       checksum,
-		Camera:         fileInfos[0].Fields["Model"].(string),
+		Camera:         fields.String("Model"),
 		Timestamp:      int(timestamp),
-		Mode:           fileInfos[0].Fields["ExposureProgram"].(string),
-		Aperture:       fmt.Sprintf("f/%f", math.Round(fileInfos[0].Fields["FNumber"].(float64))),
-		Iso:            int16(math.Round(fileInfos[0].Fields["ISO"].(float64))),
-		Speed:          fileInfos[0].Fields["ShutterSpeed"].(string),
-		FocalLength:    fileInfos[0].Fields["FocalLength"].(string),
-		Lens:           fileInfos[0].Fields["LensID"].(string),
-		Flash:          fileInfos[0].Fields["Flash"].(string) == "Off, Did not fire.",
-		Landscape:      landscape,
-		Panoramic:      panoramic,
-		Width:          width,
-		Height:         height,
+		Mode:           fields.String("ExposureProgram"),
+		Aperture:       fmt.Sprintf("f/%f", math.Round(fNumber)),
+		Iso:            int(min(max(math.Round(iso), 0), math.MaxInt32)),
+		Speed:          fields.String("ShutterSpeed"),
+		FocalLength:    fields.String("FocalLength"),
+		Lens:           fields.String("LensID"),
+		Flash:          fields.String("Flash") == "Off, Did not fire.",
 		Favourite:      false,
 		TriggerWarning: false,
-		Description:    "",
-	}, nil
+		Description:    fields.First("Description", "Caption-Abstract", "ImageDescription"),
+		OriginalValues: make(map[string]string),
+		Title:          fields.First("Title", "ObjectName", "Headline"),
+		Tags:           NormalizeTags(fields.Strings("Subject", "Keywords")),
+		Rating:         int32(min(max(math.Round(rating), 0), 5)),
+		Creator:        truncate(fields.First("Creator", "Artist", "By-line"), maxCreditLength),
+		Copyright:      truncate(fields.First("Rights", "Copyright", "CopyrightNotice"), maxCreditLength),
+	}
+	picture.SetSize(int(imageWidth), int(imageHeight))
+	readLocation(fields, &picture)
+
+	return picture, nil
+}
+
+// truncate cuts value to at most length bytes without splitting a character.
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	return strings.ToValidUTF8(value[:length], "")
+}
+
+// SetSize sets the dimensions of the picture and the orientation derived from them.
+func (p *Picture) SetSize(width int, height int) {
+	p.Width = width
+	p.Height = height
+	p.Landscape = width > height
+	p.Panoramic = p.Landscape && float32(width)/float32(height) > 1.5
 }
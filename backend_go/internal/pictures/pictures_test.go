@@ -0,0 +1,40 @@
+package pictures
+
+import (
+	"github.com/evanespen/vanespen.art_2025/internal/albums"
+	"github.com/evanespen/vanespen.art_2025/internal/catalog"
+	"os"
+	"testing"
+)
+
+// useTestCatalog runs the test in an empty directory, where the storage directories are
+// created, against in-memory repositories.
+func useTestCatalog(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	for _, rendition := range Renditions {
+		if err := os.MkdirAll(rendition.Dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	previousPictures, previousAlbums := repository, albums.GetRepository()
+	SetRepository(catalog.NewMemoryRepository[Picture]())
+	albums.SetRepository(catalog.NewMemoryRepository[albums.Album]())
+	t.Cleanup(func() {
+		SetRepository(previousPictures)
+		albums.SetRepository(previousAlbums)
+	})
+}
+
+func insertTestPictures(t *testing.T, pictures ...Picture) {
+	t.Helper()
+	for _, picture := range pictures {
+		if picture.Ext == "" {
+			picture.Ext = ".jpg"
+		}
+		if err := repository.Insert(picture); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
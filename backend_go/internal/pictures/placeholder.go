@@ -0,0 +1,87 @@
+package pictures
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/buckket/go-blurhash"
+	"github.com/disintegration/imaging"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"image"
+	"image/jpeg"
+)
+
+// Placeholder is what a gallery paints while a picture loads, small enough to be sent
+// along with the picture in the listings.
+type Placeholder struct {
+	BlurHash      string
+	DominantColor string
+	// Image is a micro-JPEG of at most configs.PlaceholderSize pixels, as a data URI.
+	Image string
+}
+
+// NewPlaceholder computes the placeholder of img from a single small downscale, the
+// BlurHash has more components along the longest side.
+func NewPlaceholder(img image.Image) (Placeholder, error) {
+	small := imaging.Fit(img, configs.PlaceholderSize, configs.PlaceholderSize, imaging.Box)
+
+	xComponents, yComponents := 4, 3
+	if small.Bounds().Dx() < small.Bounds().Dy() {
+		xComponents, yComponents = 3, 4
+	}
+	hash, err := blurhash.Encode(xComponents, yComponents, small)
+	if err != nil {
+		return Placeholder{}, err
+	}
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, small, &jpeg.Options{Quality: configs.PlaceholderQuality}); err != nil {
+		return Placeholder{}, err
+	}
+
+	return Placeholder{
+		BlurHash:      hash,
+		DominantColor: dominantColor(small),
+		Image:         "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(encoded.Bytes()),
+	}, nil
+}
+
+// dominantColor returns as #rrggbb the mean colour of the most frequent of the colours
+// of img reduced to 4 bits per channel, the mean of the whole image is often a grey
+// found nowhere in it.
+func dominantColor(img *image.NRGBA) string {
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := make(map[int]*bucket)
+	var dominant *bucket
+
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			pixel := img.Pix[y*img.Stride+x*4:]
+			r, g, b := int(pixel[0]), int(pixel[1]), int(pixel[2])
+			key := r>>4<<8 | g>>4<<4 | b>>4
+			if buckets[key] == nil {
+				buckets[key] = &bucket{}
+			}
+			current := buckets[key]
+			current.count++
+			current.r, current.g, current.b = current.r+r, current.g+g, current.b+b
+			if dominant == nil || current.count > dominant.count {
+				dominant = current
+			}
+		}
+	}
+
+	if dominant == nil {
+		return "#000000"
+	}
+	return fmt.Sprintf("#%02x%02x%02x", dominant.r/dominant.count, dominant.g/dominant.count, dominant.b/dominant.count)
+}
+
+func (p *Picture) SetPlaceholder(placeholder Placeholder) {
+	p.BlurHash = placeholder.BlurHash
+	p.DominantColor = placeholder.DominantColor
+	p.Placeholder = placeholder.Image
+}
@@ -0,0 +1,101 @@
+package pictures
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/buckket/go-blurhash"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"strings"
+	"testing"
+)
+
+func TestNewPlaceholder(t *testing.T) {
+	tests := []struct {
+		name       string
+		width      int
+		height     int
+		wantWidth  int
+		wantHeight int
+		wantXComps int
+		wantYComps int
+	}{
+		{name: "landscape", width: 300, height: 200, wantWidth: 32, wantHeight: 21, wantXComps: 4, wantYComps: 3},
+		{name: "portrait", width: 200, height: 300, wantWidth: 21, wantHeight: 32, wantXComps: 3, wantYComps: 4},
+		{name: "square", width: 250, height: 250, wantWidth: 32, wantHeight: 32, wantXComps: 4, wantYComps: 3},
+		{name: "panoramic", width: 1200, height: 150, wantWidth: 32, wantHeight: 4, wantXComps: 4, wantYComps: 3},
+		{name: "smaller than a placeholder", width: 16, height: 8, wantWidth: 16, wantHeight: 8, wantXComps: 4, wantYComps: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			placeholder, err := NewPlaceholder(testImage(test.width, test.height))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			xComponents, yComponents, err := blurhash.Components(placeholder.BlurHash)
+			if err != nil || xComponents != test.wantXComps || yComponents != test.wantYComps {
+				t.Errorf("got a BlurHash of %dx%d components, error %v, want %dx%d", xComponents, yComponents, err, test.wantXComps, test.wantYComps)
+			}
+
+			encoded, found := strings.CutPrefix(placeholder.Image, "data:image/jpeg;base64,")
+			if !found {
+				t.Fatalf("got image %.40q, want a JPEG data URI", placeholder.Image)
+			}
+			data, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Width != test.wantWidth || config.Height != test.wantHeight || max(config.Width, config.Height) > configs.PlaceholderSize {
+				t.Errorf("got a %dx%d image, want %dx%d", config.Width, config.Height, test.wantWidth, test.wantHeight)
+			}
+		})
+	}
+}
+
+// paint returns an image of 10x10 pixels with n[i] pixels of colors[i], in order.
+func paint(colors []color.NRGBA, n []int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	pixel := 0
+	for i, c := range colors {
+		for j := 0; j < n[i]; j++ {
+			img.SetNRGBA(pixel%10, pixel/10, c)
+			pixel++
+		}
+	}
+	return img
+}
+
+func TestDominantColor(t *testing.T) {
+	red := color.NRGBA{R: 0xc0, G: 0x10, B: 0x10, A: 255}
+	blue := color.NRGBA{R: 0x10, G: 0x20, B: 0xe0, A: 255}
+	grey := color.NRGBA{R: 0x80, G: 0x80, B: 0x80, A: 255}
+
+	tests := []struct {
+		name string
+		img  *image.NRGBA
+		want string
+	}{
+		{name: "uniform", img: paint([]color.NRGBA{red}, []int{100}), want: "#c01010"},
+		{name: "majority", img: paint([]color.NRGBA{red, blue}, []int{30, 70}), want: "#1020e0"},
+		{name: "not the mean", img: paint([]color.NRGBA{red, blue, grey}, []int{40, 35, 25}), want: "#c01010"},
+		{name: "shades of a bucket", img: paint([]color.NRGBA{{R: 0xc0, G: 0x10, B: 0x10, A: 255}, {R: 0xc8, G: 0x18, B: 0x1e, A: 255}}, []int{50, 50}), want: "#c41417"},
+		{name: "shades outweigh a single colour", img: paint([]color.NRGBA{red, {R: 0x14, G: 0x24, B: 0xe4, A: 255}, blue}, []int{40, 30, 30}), want: "#1222e2"},
+		{name: "empty", img: image.NewNRGBA(image.Rect(0, 0, 0, 0)), want: "#000000"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := dominantColor(test.img); got != test.want {
+				t.Fatalf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,391 @@
+package pictures
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultPageLimit = 100
+const maxPageLimit = 1000
+
+type Filter struct {
+	Cameras        []string
+	Lenses         []string
+	Tags           []string
+	RatingMin      *int
+	CoversOnly     bool
+	IsoMin         *int
+	IsoMax         *int
+	ApertureMin    *float64
+	ApertureMax    *float64
+	From           *int64
+	To             *int64
+	Landscape      *bool
+	Panoramic      *bool
+	Favourite      *bool
+	TriggerWarning *bool
+}
+
+type Query struct {
+	Filter     Filter
+	Sort       string
+	Descending bool
+	Cursor     *Cursor
+	Limit      int
+}
+
+type Page struct {
+	Pictures   []Picture `json:"pictures"`
+	Total      int       `json:"total"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// Cursor is the position after the last picture of a page, it is handed to clients
+// as an opaque base64 token.
+type Cursor struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d"`
+	Value      any    `json:"v"`
+	UUID       string `json:"u"`
+}
+
+// sortFields maps the sortable fields to their value, either a float64 or a string.
+var sortFields = map[string]func(picture Picture) any{
+	"timestamp":    func(picture Picture) any { return float64(picture.Timestamp) },
+	"iso":          func(picture Picture) any { return float64(picture.Iso) },
+	"aperture":     func(picture Picture) any { return ApertureNumber(picture) },
+	"focal_length": func(picture Picture) any { return FocalLengthMillimeters(picture) },
+	"width":        func(picture Picture) any { return float64(picture.Width) },
+	"height":       func(picture Picture) any { return float64(picture.Height) },
+	"camera":       func(picture Picture) any { return picture.Camera },
+	"lens":         func(picture Picture) any { return picture.Lens },
+	"rating":       func(picture Picture) any { return float64(picture.Rating) },
+}
+
+func ParseFilter(c *gin.Context) (Filter, error) {
+	return ParseFilterValues(c.Request.URL.Query())
+}
+
+// ParseFilterValues reads a filter from query string values, for the callers without a
+// request such as the command line.
+func ParseFilterValues(values url.Values) (Filter, error) {
+	var filter Filter
+	var err error
+
+	filter.Cameras = values["camera"]
+	filter.Lenses = values["lens"]
+	filter.Tags = values["tag"]
+
+	if filter.RatingMin, err = queryInt(values, "rating_min"); err != nil {
+		return filter, err
+	}
+
+	if filter.IsoMin, err = queryInt(values, "iso_min"); err != nil {
+		return filter, err
+	}
+	if filter.IsoMax, err = queryInt(values, "iso_max"); err != nil {
+		return filter, err
+	}
+	if filter.ApertureMin, err = queryFloat(values, "aperture_min"); err != nil {
+		return filter, err
+	}
+	if filter.ApertureMax, err = queryFloat(values, "aperture_max"); err != nil {
+		return filter, err
+	}
+	if filter.From, err = queryDate(values, "from", false); err != nil {
+		return filter, err
+	}
+	if filter.To, err = queryDate(values, "to", true); err != nil {
+		return filter, err
+	}
+	if filter.Landscape, err = queryBool(values, "landscape"); err != nil {
+		return filter, err
+	}
+	if filter.Panoramic, err = queryBool(values, "panoramic"); err != nil {
+		return filter, err
+	}
+	if filter.Favourite, err = queryBool(values, "favourite"); err != nil {
+		return filter, err
+	}
+	if filter.TriggerWarning, err = queryBool(values, "trigger_warning"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// ParsePublicFilter is ParseFilter for the public listings, which show the cover of each
+// stack only unless ?versions=all.
+func ParsePublicFilter(c *gin.Context) (Filter, error) {
+	filter, err := ParseFilter(c)
+	filter.CoversOnly = c.Query("versions") != "all"
+	return filter, err
+}
+
+func ParseQuery(c *gin.Context) (Query, error) {
+	filter, err := ParsePublicFilter(c)
+	if err != nil {
+		return Query{}, err
+	}
+
+	query := Query{
+		Filter:     filter,
+		Sort:       strings.TrimPrefix(c.DefaultQuery("sort", "-timestamp"), "-"),
+		Descending: strings.HasPrefix(c.DefaultQuery("sort", "-timestamp"), "-"),
+		Limit:      defaultPageLimit,
+	}
+
+	if _, ok := sortFields[query.Sort]; !ok {
+		return query, fmt.Errorf("unknown sort field: %s", query.Sort)
+	}
+
+	if rawLimit, ok := c.GetQuery("limit"); ok {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		query.Limit = limit
+	}
+
+	if rawCursor := c.Query("cursor"); rawCursor != "" {
+		cursor, err := DecodeCursor(rawCursor)
+		if err != nil {
+			return query, err
+		}
+		if cursor.Sort != query.Sort || cursor.Descending != query.Descending {
+			return query, fmt.Errorf("cursor does not match the requested sort")
+		}
+		query.Cursor = &cursor
+	}
+
+	return query, nil
+}
+
+func (f Filter) Match(picture Picture) bool {
+	if len(f.Cameras) > 0 && !slices.Contains(f.Cameras, picture.Camera) {
+		return false
+	}
+	if len(f.Lenses) > 0 && !slices.Contains(f.Lenses, picture.Lens) {
+		return false
+	}
+	if f.CoversOnly && !picture.StackCover {
+		return false
+	}
+	// A picture must have every tag of the filter.
+	for _, tag := range f.Tags {
+		if !HasTag(picture, tag) {
+			return false
+		}
+	}
+	if f.RatingMin != nil && int(picture.Rating) < *f.RatingMin {
+		return false
+	}
+	if f.IsoMin != nil && picture.Iso < *f.IsoMin {
+		return false
+	}
+	if f.IsoMax != nil && picture.Iso > *f.IsoMax {
+		return false
+	}
+	if f.ApertureMin != nil && ApertureNumber(picture) < *f.ApertureMin {
+		return false
+	}
+	if f.ApertureMax != nil && ApertureNumber(picture) > *f.ApertureMax {
+		return false
+	}
+	if f.From != nil && int64(picture.Timestamp) < *f.From {
+		return false
+	}
+	if f.To != nil && int64(picture.Timestamp) > *f.To {
+		return false
+	}
+	if f.Landscape != nil && picture.Landscape != *f.Landscape {
+		return false
+	}
+	if f.Panoramic != nil && picture.Panoramic != *f.Panoramic {
+		return false
+	}
+	if f.Favourite != nil && picture.Favourite != *f.Favourite {
+		return false
+	}
+	if f.TriggerWarning != nil && picture.TriggerWarning != *f.TriggerWarning {
+		return false
+	}
+	return true
+}
+
+func (f Filter) Apply(pictures []Picture) []Picture {
+	matching := make([]Picture, 0, len(pictures))
+	for _, picture := range pictures {
+		if f.Match(picture) {
+			matching = append(matching, picture)
+		}
+	}
+	return matching
+}
+
+func (q Query) Apply(pictures []Picture) Page {
+	matching := q.Filter.Apply(pictures)
+	slices.SortStableFunc(matching, q.compare)
+
+	start := 0
+	if q.Cursor != nil {
+		start, _ = slices.BinarySearchFunc(matching, *q.Cursor, func(picture Picture, cursor Cursor) int {
+			return q.compareToCursor(picture, cursor)
+		})
+	}
+
+	end := min(start+q.Limit, len(matching))
+	page := Page{Pictures: matching[start:end], Total: len(matching)}
+
+	if end < len(matching) {
+		last := matching[end-1]
+		page.NextCursor = EncodeCursor(Cursor{
+			Sort:       q.Sort,
+			Descending: q.Descending,
+			Value:      sortFields[q.Sort](last),
+			UUID:       last.UUID,
+		})
+	}
+
+	return page
+}
+
+func (q Query) compare(a Picture, b Picture) int {
+	value := sortFields[q.Sort]
+	result := cmp.Or(compareValues(value(a), value(b)), cmp.Compare(a.UUID, b.UUID))
+	if q.Descending {
+		return -result
+	}
+	return result
+}
+
+// compareToCursor orders the picture against the cursor position, the picture the
+// cursor was made from compares as before the cursor so the next page starts after it.
+func (q Query) compareToCursor(picture Picture, cursor Cursor) int {
+	result := cmp.Or(compareValues(sortFields[q.Sort](picture), cursor.Value), cmp.Compare(picture.UUID, cursor.UUID))
+	if q.Descending {
+		result = -result
+	}
+	if result == 0 {
+		return -1
+	}
+	return result
+}
+
+func compareValues(a any, b any) int {
+	switch aValue := a.(type) {
+	case float64:
+		bValue, _ := b.(float64)
+		return cmp.Compare(aValue, bValue)
+	case string:
+		bValue, _ := b.(string)
+		return cmp.Compare(aValue, bValue)
+	}
+	return 0
+}
+
+func EncodeCursor(cursor Cursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(raw string) (Cursor, error) {
+	var cursor Cursor
+
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor, fmt.Errorf("invalid cursor")
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, fmt.Errorf("invalid cursor")
+	}
+
+	switch cursor.Value.(type) {
+	case float64, string:
+		return cursor, nil
+	default:
+		return cursor, fmt.Errorf("invalid cursor")
+	}
+}
+
+// ApertureNumber reads the f-number back from the "f/<number>" string stored on the picture.
+func ApertureNumber(picture Picture) float64 {
+	value, _ := strconv.ParseFloat(strings.TrimPrefix(picture.Aperture, "f/"), 64)
+	return value
+}
+
+// FocalLengthMillimeters reads the millimeters from the exiftool "50.0 mm" representation.
+func FocalLengthMillimeters(picture Picture) float64 {
+	value, _ := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(picture.FocalLength, "mm")), 64)
+	return value
+}
+
+func queryInt(values url.Values, key string) (*int, error) {
+	if !values.Has(key) {
+		return nil, nil
+	}
+	raw := values.Get(key)
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer", key)
+	}
+	return &value, nil
+}
+
+func queryFloat(values url.Values, key string) (*float64, error) {
+	if !values.Has(key) {
+		return nil, nil
+	}
+	raw := values.Get(key)
+	value, err := strconv.ParseFloat(strings.TrimPrefix(raw, "f/"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number", key)
+	}
+	return &value, nil
+}
+
+func queryBool(values url.Values, key string) (*bool, error) {
+	if !values.Has(key) {
+		return nil, nil
+	}
+	raw := values.Get(key)
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a boolean", key)
+	}
+	return &value, nil
+}
+
+// queryDate accepts a unix timestamp, an RFC 3339 date time or a plain date. A plain
+// date used as an upper bound covers the whole day.
+func queryDate(values url.Values, key string, endOfDay bool) (*int64, error) {
+	if !values.Has(key) {
+		return nil, nil
+	}
+	raw := values.Get(key)
+
+	if value, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return &value, nil
+	}
+	if datetime, err := time.Parse(time.RFC3339, raw); err == nil {
+		value := datetime.Unix()
+		return &value, nil
+	}
+	if date, err := time.Parse("2006-01-02", raw); err == nil {
+		if endOfDay {
+			date = date.AddDate(0, 0, 1).Add(-time.Second)
+		}
+		value := date.Unix()
+		return &value, nil
+	}
+
+	return nil, fmt.Errorf("%s must be a unix timestamp or a date", key)
+}
@@ -0,0 +1,175 @@
+package pictures
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func parseTestQuery(t *testing.T, values url.Values) (Query, error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/pictures/?"+values.Encode(), nil)
+	return ParseQuery(c)
+}
+
+// queryPictures are ten covers with ties on the camera and the ISO, their UUIDs in the
+// order of their timestamps.
+func queryPictures() []Picture {
+	var pictures []Picture
+	for i := 0; i < 10; i++ {
+		pictures = append(pictures, Picture{
+			UUID:       fmt.Sprintf("picture-%d", i),
+			Timestamp:  1000 + i,
+			Camera:     []string{"A", "B"}[i%2],
+			Iso:        []int{100, 200, 100, 6400, 200}[i%5],
+			StackCover: true,
+		})
+	}
+	return pictures
+}
+
+func pageUUIDs(pictures []Picture) []string {
+	uuids := make([]string, 0, len(pictures))
+	for _, picture := range pictures {
+		uuids = append(uuids, picture.UUID)
+	}
+	return uuids
+}
+
+func TestQueryPagination(t *testing.T) {
+	tests := []struct {
+		name  string
+		sort  string
+		limit int
+	}{
+		{name: "newest first", sort: "-timestamp", limit: 3},
+		{name: "oldest first", sort: "timestamp", limit: 4},
+		{name: "ties on camera", sort: "camera", limit: 3},
+		{name: "ties on iso descending", sort: "-iso", limit: 2},
+		{name: "single page", sort: "-timestamp", limit: 10},
+		{name: "one by one", sort: "iso", limit: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pictures := queryPictures()
+			all, err := parseTestQuery(t, url.Values{"sort": {test.sort}, "limit": {"1000"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := pageUUIDs(all.Apply(pictures).Pictures)
+
+			var got []string
+			values := url.Values{"sort": {test.sort}, "limit": {fmt.Sprint(test.limit)}}
+			for pages := 0; ; pages++ {
+				if pages > len(pictures) {
+					t.Fatal("the pages do not end")
+				}
+				query, err := parseTestQuery(t, values)
+				if err != nil {
+					t.Fatal(err)
+				}
+				page := query.Apply(pictures)
+				if page.Total != len(pictures) || len(page.Pictures) > test.limit {
+					t.Fatalf("page of %d pictures out of %d", len(page.Pictures), page.Total)
+				}
+				got = append(got, pageUUIDs(page.Pictures)...)
+				if page.NextCursor == "" {
+					break
+				}
+				values.Set("cursor", page.NextCursor)
+			}
+
+			if !slices.Equal(got, want) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestQueryPaginationAfterInsert(t *testing.T) {
+	pictures := queryPictures()
+	query, err := parseTestQuery(t, url.Values{"sort": {"-timestamp"}, "limit": {"3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := query.Apply(pictures)
+
+	// A newer picture is ingested before the second page is requested, it belongs to the
+	// first page and neither shifts nor repeats the next ones.
+	pictures = append(pictures, Picture{UUID: "newest", Timestamp: 2000, StackCover: true})
+	query, err = parseTestQuery(t, url.Values{"sort": {"-timestamp"}, "limit": {"3"}, "cursor": {first.NextCursor}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := query.Apply(pictures)
+
+	if got, want := pageUUIDs(second.Pictures), []string{"picture-6", "picture-5", "picture-4"}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestQueryFilter(t *testing.T) {
+	pictures := queryPictures()
+	pictures[3].StackCover = false
+
+	tests := []struct {
+		name   string
+		values url.Values
+		want   int
+	}{
+		{name: "covers", values: url.Values{}, want: 9},
+		{name: "all versions", values: url.Values{"versions": {"all"}}, want: 10},
+		{name: "camera", values: url.Values{"camera": {"A"}, "versions": {"all"}}, want: 5},
+		{name: "iso range", values: url.Values{"iso_min": {"200"}, "iso_max": {"6400"}, "versions": {"all"}}, want: 6},
+		{name: "cameras and iso", values: url.Values{"camera": {"A", "B"}, "iso_max": {"100"}}, want: 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := parseTestQuery(t, test.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page := query.Apply(pictures); page.Total != test.want || len(page.Pictures) != test.want {
+				t.Fatalf("got %d of %d pictures, want %d", len(page.Pictures), page.Total, test.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	cursor := EncodeCursor(Cursor{Sort: "timestamp", Descending: true, Value: 1000.0, UUID: "picture-0"})
+
+	tests := []struct {
+		name   string
+		values url.Values
+	}{
+		{name: "unknown sort", values: url.Values{"sort": {"checksum"}}},
+		{name: "limit zero", values: url.Values{"limit": {"0"}}},
+		{name: "limit too large", values: url.Values{"limit": {fmt.Sprint(maxPageLimit + 1)}}},
+		{name: "limit not a number", values: url.Values{"limit": {"ten"}}},
+		{name: "cursor of another sort", values: url.Values{"sort": {"iso"}, "cursor": {cursor}}},
+		{name: "cursor of another direction", values: url.Values{"sort": {"timestamp"}, "cursor": {cursor}}},
+		{name: "cursor not base64", values: url.Values{"cursor": {"!!!"}}},
+		{name: "cursor without value", values: url.Values{"cursor": {EncodeCursor(Cursor{Sort: "timestamp", Descending: true})}}},
+		{name: "invalid filter", values: url.Values{"iso_min": {"high"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseTestQuery(t, test.values); err == nil {
+				t.Fatalf("%v is accepted", test.values)
+			}
+		})
+	}
+
+	if _, err := parseTestQuery(t, url.Values{"cursor": {cursor}}); err != nil {
+		t.Fatalf("a cursor of the default sort is rejected: %v", err)
+	}
+}
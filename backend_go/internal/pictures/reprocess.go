@@ -0,0 +1,279 @@
+package pictures
+
+import (
+	"errors"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/evanespen/vanespen.art_2025/internal/catalog"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+var ErrUnknownRendition = errors.New("unknown rendition")
+var ErrReprocessRunning = errors.New("renditions are already being rebuilt")
+
+// ReprocessOptions selects the renditions Reprocess rebuilds and the pictures it
+// rebuilds them for.
+type ReprocessOptions struct {
+	// Renditions are the names of the renditions to rebuild, every one when empty.
+	Renditions []string `json:"renditions"`
+	// Force rebuilds the renditions even when they were made with the current version.
+	Force   bool   `json:"force"`
+	Filter  Filter `json:"-"`
+	Workers int    `json:"-"`
+}
+
+type ReprocessFailure struct {
+	UUID   string `json:"uuid"`
+	Reason string `json:"reason"`
+}
+
+type ReprocessProgress struct {
+	Total    int                `json:"total"`
+	Rebuilt  int                `json:"rebuilt"`
+	UpToDate int                `json:"up_to_date"`
+	Failures []ReprocessFailure `json:"failures"`
+}
+
+type ReprocessStatus struct {
+	Running    bool              `json:"running"`
+	StartedAt  *time.Time        `json:"started_at,omitempty"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+	Options    ReprocessOptions  `json:"options"`
+	Progress   ReprocessProgress `json:"progress"`
+	Error      string            `json:"error,omitempty"`
+}
+
+func (p ReprocessProgress) done() int {
+	return p.Rebuilt + p.UpToDate + len(p.Failures)
+}
+
+var reprocessStatus ReprocessStatus
+var reprocessMutex sync.Mutex
+
+func RenditionByName(name string) (Rendition, bool) {
+	for _, rendition := range Renditions {
+		if rendition.Name == name {
+			return rendition, true
+		}
+	}
+	return Rendition{}, false
+}
+
+// selectRenditions resolves the requested names.
+func selectRenditions(names []string) ([]Rendition, error) {
+	var selected []Rendition
+	for _, rendition := range Renditions {
+		if len(names) == 0 || slices.Contains(names, rendition.Name) {
+			selected = append(selected, rendition)
+		}
+	}
+
+	for _, name := range names {
+		if _, ok := RenditionByName(name); !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownRendition, name)
+		}
+	}
+	return selected, nil
+}
+
+// outdatedRenditions lists the selected renditions made with an older version or missing.
+func outdatedRenditions(picture Picture, selected []Rendition, force bool) []Rendition {
+	var outdated []Rendition
+	for _, rendition := range selected {
+		if !rendition.AppliesTo(picture) {
+			continue
+		}
+		if force || picture.RenditionVersions[rendition.Name] != rendition.Version {
+			outdated = append(outdated, rendition)
+		} else if _, err := os.Stat(rendition.Path(picture)); err != nil {
+			outdated = append(outdated, rendition)
+		}
+	}
+	return outdated
+}
+
+// Reprocess rebuilds from the full rendition the selected renditions of the pictures
+// matching the filter, with progress called after each picture. The full rendition
+// itself only gets its metadata rewritten. A picture is marked up to date as soon as its
+// renditions are rebuilt, so running Reprocess again resumes an interrupted run.
+func Reprocess(options ReprocessOptions, progress func(ReprocessProgress)) (ReprocessProgress, error) {
+	if progress == nil {
+		progress = func(ReprocessProgress) {}
+	}
+
+	selected, err := selectRenditions(options.Renditions)
+	if err != nil {
+		return ReprocessProgress{}, err
+	}
+
+	allPictures, err := repository.List()
+	if err != nil {
+		return ReprocessProgress{}, err
+	}
+	matching := options.Filter.Apply(allPictures)
+
+	state := ReprocessProgress{Total: len(matching), Failures: []ReprocessFailure{}}
+	var mutex sync.Mutex
+	report := func(update func()) {
+		mutex.Lock()
+		update()
+		snapshot := state
+		snapshot.Failures = slices.Clone(state.Failures)
+		mutex.Unlock()
+		progress(snapshot)
+	}
+
+	workers := options.Workers
+	if workers < 1 {
+		workers = configs.RenditionWorkers
+	}
+
+	work := make(chan Picture)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for picture := range work {
+				outdated := outdatedRenditions(picture, selected, options.Force)
+				if len(outdated) == 0 {
+					report(func() { state.UpToDate++ })
+					continue
+				}
+
+				if err := reprocessPicture(picture, outdated); err != nil {
+					fmt.Println(err)
+					report(func() {
+						state.Failures = append(state.Failures, ReprocessFailure{UUID: picture.UUID, Reason: err.Error()})
+					})
+					continue
+				}
+				report(func() { state.Rebuilt++ })
+			}
+		}()
+	}
+
+	for _, picture := range matching {
+		work <- picture
+	}
+	close(work)
+	wg.Wait()
+
+	return state, nil
+}
+
+func reprocessPicture(picture Picture, renditions []Rendition) error {
+	var resized []Rendition
+	for _, rendition := range renditions {
+		// The full rendition is the source of the others, encoding it again would lose quality.
+		if rendition.Divisor <= 1 && !rendition.Tiles {
+			if err := rendition.RewriteMetadata(picture); err != nil {
+				return fmt.Errorf("unable to rewrite the metadata of the %s rendition of %s: %w", rendition.Name, picture.UUID, err)
+			}
+			continue
+		}
+		resized = append(resized, rendition)
+	}
+
+	if len(resized) > 0 {
+		source, _ := RenditionByName("full")
+		img, release, err := openImage(source.Path(picture))
+		if err != nil {
+			return fmt.Errorf("unable to open the full rendition of %s: %w", picture.UUID, err)
+		}
+		err = saveRenditions(img, picture, resized)
+		release()
+		if err != nil {
+			return err
+		}
+	}
+
+	return markRenditions(picture, renditions)
+}
+
+// markRenditions records the versions of the rebuilt renditions on the picture as it is
+// now in the catalog, it may have been updated while its renditions were rebuilt.
+func markRenditions(picture Picture, renditions []Rendition) error {
+	var previous Picture
+	var updated Picture
+
+	err := repository.Transaction(func(tx Repository) error {
+		current, err := tx.Get(picture.UUID)
+		if err != nil {
+			return err
+		}
+		previous = current
+
+		versions := maps.Clone(current.RenditionVersions)
+		if versions == nil {
+			versions = make(map[string]int32)
+		}
+		for _, rendition := range renditions {
+			versions[rendition.Name] = rendition.Version
+		}
+		current.RenditionVersions = versions
+		updated = current
+
+		return tx.Update(current)
+	})
+	if errors.Is(err, catalog.ErrNotFound) {
+		// Deleted in the meantime, the renditions just written would be orphans.
+		removeRenditions(picture)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	publish(Event{Type: PictureUpdated, Picture: updated, Previous: &previous})
+	return nil
+}
+
+// StartReprocess runs Reprocess in the background, only one run at a time.
+func StartReprocess(options ReprocessOptions) (ReprocessStatus, error) {
+	if _, err := selectRenditions(options.Renditions); err != nil {
+		return ReprocessStatus{}, err
+	}
+
+	reprocessMutex.Lock()
+	defer reprocessMutex.Unlock()
+
+	if reprocessStatus.Running {
+		return reprocessStatus, ErrReprocessRunning
+	}
+	startedAt := time.Now()
+	reprocessStatus = ReprocessStatus{Running: true, StartedAt: &startedAt, Options: options, Progress: ReprocessProgress{Failures: []ReprocessFailure{}}}
+
+	go func() {
+		progress, err := Reprocess(options, func(progress ReprocessProgress) {
+			reprocessMutex.Lock()
+			defer reprocessMutex.Unlock()
+			// The workers report concurrently, an older snapshot may arrive last.
+			if progress.done() >= reprocessStatus.Progress.done() {
+				reprocessStatus.Progress = progress
+			}
+		})
+
+		reprocessMutex.Lock()
+		defer reprocessMutex.Unlock()
+		finishedAt := time.Now()
+		reprocessStatus.Running = false
+		reprocessStatus.FinishedAt = &finishedAt
+		reprocessStatus.Progress = progress
+		if err != nil {
+			reprocessStatus.Error = err.Error()
+		}
+	}()
+
+	return reprocessStatus, nil
+}
+
+func GetReprocessStatus() ReprocessStatus {
+	reprocessMutex.Lock()
+	defer reprocessMutex.Unlock()
+	return reprocessStatus
+}
@@ -0,0 +1,99 @@
+package pictures
+
+import (
+	"maps"
+	"os"
+	"testing"
+)
+
+// currentVersions are the versions of every rendition of a picture which is not a panorama.
+func currentVersions() map[string]int32 {
+	versions := make(map[string]int32)
+	for _, rendition := range Renditions {
+		if !rendition.Tiles {
+			versions[rendition.Name] = rendition.Version
+		}
+	}
+	return versions
+}
+
+func TestReprocessResumes(t *testing.T) {
+	useTestCatalog(t)
+
+	outdated := currentVersions()
+	outdated["half"]--
+	pictures := []Picture{
+		{UUID: "current", Camera: "first", RenditionVersions: currentVersions()},
+		{UUID: "outdated", Camera: "first", RenditionVersions: outdated},
+		{UUID: "never-built", Camera: "second"},
+		{UUID: "missing-file", Camera: "second", RenditionVersions: currentVersions()},
+		{UUID: "without-source", Camera: "second"},
+	}
+	insertTestPictures(t, pictures...)
+	for _, picture := range pictures[:4] {
+		picture.Ext = ".jpg"
+		writeFullRendition(t, picture, 60, 40)
+		for _, rendition := range Renditions[1:4] {
+			if picture.UUID == "missing-file" && rendition.Name == "thumb" {
+				continue
+			}
+			if err := os.WriteFile(rendition.Path(picture), []byte("rendition"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Each run starts from the catalog left by the previous ones.
+	runs := []struct {
+		name         string
+		options      ReprocessOptions
+		bump         string
+		wantRebuilt  int
+		wantUpToDate int
+		wantFailures int
+	}{
+		{name: "interrupted after the first camera", options: ReprocessOptions{Filter: Filter{Cameras: []string{"first"}}}, wantRebuilt: 1, wantUpToDate: 1},
+		{name: "resumed", wantRebuilt: 2, wantUpToDate: 2, wantFailures: 1},
+		{name: "run again", wantUpToDate: 4, wantFailures: 1},
+		{name: "rendition version bumped", bump: "thumb", wantRebuilt: 4, wantFailures: 1},
+		{name: "other rendition selected", bump: "tiny", options: ReprocessOptions{Renditions: []string{"half"}}, wantUpToDate: 4, wantFailures: 1},
+		{name: "bumped rendition selected", options: ReprocessOptions{Renditions: []string{"tiny"}}, wantRebuilt: 4, wantFailures: 1},
+		{name: "forced", options: ReprocessOptions{Force: true, Filter: Filter{Cameras: []string{"first"}}}, wantRebuilt: 2},
+	}
+
+	for _, run := range runs {
+		if run.bump != "" {
+			for i := range Renditions {
+				if Renditions[i].Name == run.bump {
+					rendition := &Renditions[i]
+					rendition.Version++
+					t.Cleanup(func() { rendition.Version-- })
+				}
+			}
+		}
+
+		progress, err := Reprocess(run.options, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if progress.Rebuilt != run.wantRebuilt || progress.UpToDate != run.wantUpToDate || len(progress.Failures) != run.wantFailures {
+			t.Fatalf("%s: got %d rebuilt, %d up to date and %d failures, want %d, %d and %d", run.name,
+				progress.Rebuilt, progress.UpToDate, len(progress.Failures), run.wantRebuilt, run.wantUpToDate, run.wantFailures)
+		}
+		if run.wantFailures > 0 && progress.Failures[0].UUID != "without-source" {
+			t.Fatalf("%s: got failures %v", run.name, progress.Failures)
+		}
+	}
+
+	for _, picture := range pictures[:4] {
+		stored, _ := repository.Get(picture.UUID)
+		if !maps.Equal(stored.RenditionVersions, currentVersions()) {
+			t.Errorf("%s: got versions %v, want %v", picture.UUID, stored.RenditionVersions, currentVersions())
+		}
+		for _, rendition := range Renditions[:4] {
+			if _, err := os.Stat(rendition.Path(stored)); err != nil {
+				t.Errorf("%s: %v", picture.UUID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package pictures
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/disintegration/imaging"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"image"
+	"math/bits"
+	"slices"
+	"strconv"
+)
+
+const (
+	NearDuplicateFlag   = "flag"
+	NearDuplicateReject = "reject"
+	NearDuplicateOff    = "off"
+)
+
+type NearDuplicateError struct {
+	ExistingUUID string
+	Distance     int
+}
+
+func (e *NearDuplicateError) Error() string {
+	return fmt.Sprintf("picture is a near duplicate of %s (distance %d)", e.ExistingUUID, e.Distance)
+}
+
+// Similarity is a picture close to another one, Distance is the number of bits their
+// perceptual hashes differ by.
+type Similarity struct {
+	UUID     string `json:"uuid"`
+	Distance int    `json:"distance"`
+}
+
+type SimilarCluster struct {
+	Pictures []Picture `json:"pictures"`
+	// MaxDistance is the largest distance between two pictures linked in the cluster.
+	MaxDistance int `json:"max_distance"`
+}
+
+// DifferenceHash returns the dHash of img as 16 hexadecimal digits: the image is reduced
+// to 9x8 grey pixels and each bit tells whether a pixel is brighter than its right
+// neighbour. Re-exports and light edits of an image keep most of the bits.
+func DifferenceHash(img image.Image) string {
+	small := imaging.Grayscale(imaging.Resize(img, 9, 8, imaging.Box))
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			left := small.Pix[y*small.Stride+x*4]
+			right := small.Pix[y*small.Stride+(x+1)*4]
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+	return fmt.Sprintf("%016x", hash)
+}
+
+// HashDistance counts the bits differing between two perceptual hashes, ok is false
+// when one of them is missing.
+func HashDistance(a string, b string) (int, bool) {
+	first, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		return 0, false
+	}
+	second, err := strconv.ParseUint(b, 16, 64)
+	if err != nil {
+		return 0, false
+	}
+	return bits.OnesCount64(first ^ second), true
+}
+
+// similarTo lists the pictures within threshold of hash, closest first.
+func similarTo(pictures []Picture, hash string, exclude string, threshold int) []Similarity {
+	var similar []Similarity
+	for _, picture := range pictures {
+		if picture.UUID == exclude {
+			continue
+		}
+		if distance, ok := HashDistance(hash, picture.PerceptualHash); ok && distance <= threshold {
+			similar = append(similar, Similarity{UUID: picture.UUID, Distance: distance})
+		}
+	}
+	slices.SortStableFunc(similar, func(a Similarity, b Similarity) int {
+		return cmp.Compare(a.Distance, b.Distance)
+	})
+	return similar
+}
+
+// otherFrames leaves out of pictures the other versions of the frame of picture, its
+// edits are expected to look like it.
+func otherFrames(pictures []Picture, picture Picture) []Picture {
+	key := StackKey(picture)
+	return slices.DeleteFunc(slices.Clone(pictures), func(other Picture) bool {
+		return (picture.Stack != "" && other.Stack == picture.Stack) || (key != "" && StackKey(other) == key)
+	})
+}
+
+// SimilarPictures lists the pictures close to picture, closest first, apart from the
+// other versions of its frame.
+func SimilarPictures(picture Picture) ([]Similarity, error) {
+	allPictures, err := repository.List()
+	if err != nil {
+		return nil, err
+	}
+	return similarTo(otherFrames(allPictures, picture), picture.PerceptualHash, picture.UUID, configs.NearDuplicateThreshold), nil
+}
+
+// findNearDuplicate returns a NearDuplicateError when near duplicates are rejected and
+// one is in the catalog, other than a version of the frame of picture.
+func findNearDuplicate(r Repository, picture Picture) error {
+	if configs.NearDuplicatePolicy != NearDuplicateReject {
+		return nil
+	}
+
+	allPictures, err := r.List()
+	if err != nil {
+		return err
+	}
+	if similar := similarTo(otherFrames(allPictures, picture), picture.PerceptualHash, "", configs.NearDuplicateThreshold); len(similar) > 0 {
+		return &NearDuplicateError{ExistingUUID: similar[0].UUID, Distance: similar[0].Distance}
+	}
+	return nil
+}
+
+// Clusters groups the pictures linked by chains of perceptual hashes within threshold
+// of each other, largest clusters first. Pictures without a similar one are left out.
+func Clusters(pictures []Picture, threshold int) []SimilarCluster {
+	parents := make([]int, len(pictures))
+	for i := range parents {
+		parents[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if parents[i] != i {
+			parents[i] = root(parents[i])
+		}
+		return parents[i]
+	}
+
+	maxDistances := make(map[int]int)
+	linked := make(map[int]bool)
+	for i := range pictures {
+		for j := i + 1; j < len(pictures); j++ {
+			distance, ok := HashDistance(pictures[i].PerceptualHash, pictures[j].PerceptualHash)
+			if !ok || distance > threshold {
+				continue
+			}
+
+			a, b := root(i), root(j)
+			if a != b {
+				parents[b] = a
+				maxDistances[a] = max(maxDistances[a], maxDistances[b])
+			}
+			maxDistances[a] = max(maxDistances[a], distance)
+			linked[i] = true
+			linked[j] = true
+		}
+	}
+
+	members := make(map[int][]Picture)
+	var roots []int
+	for i, picture := range pictures {
+		if !linked[i] {
+			continue
+		}
+		r := root(i)
+		if members[r] == nil {
+			roots = append(roots, r)
+		}
+		members[r] = append(members[r], picture)
+	}
+
+	clusters := make([]SimilarCluster, 0, len(roots))
+	for _, r := range roots {
+		clusters = append(clusters, SimilarCluster{Pictures: members[r], MaxDistance: maxDistances[r]})
+	}
+	slices.SortStableFunc(clusters, func(a SimilarCluster, b SimilarCluster) int {
+		return cmp.Compare(len(b.Pictures), len(a.Pictures))
+	})
+	return clusters
+}
@@ -0,0 +1,149 @@
+package pictures
+
+import (
+	"bytes"
+	"github.com/disintegration/imaging"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// blocksImage returns an image of 9x8 blocks of random greys, each of 32x32 pixels.
+func blocksImage(seed int64) image.Image {
+	random := rand.New(rand.NewSource(seed))
+	img := image.NewNRGBA(image.Rect(0, 0, 9*32, 8*32))
+	for row := 0; row < 8; row++ {
+		for column := 0; column < 9; column++ {
+			grey := uint8(random.Intn(256))
+			for y := row * 32; y < (row+1)*32; y++ {
+				for x := column * 32; x < (column+1)*32; x++ {
+					img.SetNRGBA(x, y, color.NRGBA{R: grey, G: grey, B: grey, A: 255})
+				}
+			}
+		}
+	}
+	return img
+}
+
+func TestDifferenceHash(t *testing.T) {
+	original := blocksImage(1)
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, original, &jpeg.Options{Quality: 60}); err != nil {
+		t.Fatal(err)
+	}
+	reencoded, err := jpeg.Decode(&encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		img         image.Image
+		wantSimilar bool
+	}{
+		{name: "identical", img: blocksImage(1), wantSimilar: true},
+		{name: "resized", img: imaging.Resize(original, 120, 0, imaging.Lanczos), wantSimilar: true},
+		{name: "re-encoded", img: reencoded, wantSimilar: true},
+		{name: "unrelated", img: blocksImage(2), wantSimilar: false},
+		{name: "mirrored", img: imaging.FlipH(original), wantSimilar: false},
+	}
+
+	hash := DifferenceHash(original)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			distance, ok := HashDistance(hash, DifferenceHash(test.img))
+			if !ok {
+				t.Fatalf("the hashes %s and %s are not comparable", hash, DifferenceHash(test.img))
+			}
+			if similar := distance <= configs.NearDuplicateThreshold; similar != test.wantSimilar {
+				t.Fatalf("got distance %d, want it within %d: %v", distance, configs.NearDuplicateThreshold, test.wantSimilar)
+			}
+			if test.name == "identical" && distance != 0 {
+				t.Fatalf("got distance %d between identical images", distance)
+			}
+		})
+	}
+}
+
+func TestHashDistance(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		want   int
+		wantOk bool
+	}{
+		{a: "0123456789abcdef", b: "0123456789abcdef", want: 0, wantOk: true},
+		{a: "0000000000000000", b: "ffffffffffffffff", want: 64, wantOk: true},
+		{a: "0000000000000000", b: "0000000000000003", want: 2, wantOk: true},
+		{a: "8000000000000000", b: "0000000000000001", want: 2, wantOk: true},
+		{a: "", b: "0000000000000000", wantOk: false},
+		{a: "0000000000000000", b: "not a hash", wantOk: false},
+	}
+
+	for _, test := range tests {
+		got, ok := HashDistance(test.a, test.b)
+		if ok != test.wantOk || (ok && got != test.want) {
+			t.Errorf("HashDistance(%q, %q) = %d, %v, want %d, %v", test.a, test.b, got, ok, test.want, test.wantOk)
+		}
+	}
+}
+
+func TestSimilarToThreshold(t *testing.T) {
+	pictures := []Picture{
+		{UUID: "eleven bits", PerceptualHash: "00000000000007ff"},
+		{UUID: "ten bits", PerceptualHash: "00000000000003ff"},
+		{UUID: "itself", PerceptualHash: "0000000000000000"},
+		{UUID: "one bit", PerceptualHash: "0000000000000001"},
+		{UUID: "without hash"},
+	}
+
+	similar := similarTo(pictures, "0000000000000000", "itself", 10)
+	want := []Similarity{{UUID: "one bit", Distance: 1}, {UUID: "ten bits", Distance: 10}}
+	if !slices.Equal(similar, want) {
+		t.Fatalf("got %v, want %v", similar, want)
+	}
+}
+
+func TestClusters(t *testing.T) {
+	// A and C are 12 bits apart, they are only linked through B, 6 bits from both.
+	a := Picture{UUID: "a", PerceptualHash: "0000000000000000"}
+	b := Picture{UUID: "b", PerceptualHash: "000000000000003f"}
+	c := Picture{UUID: "c", PerceptualHash: "0000000000000fff"}
+	d := Picture{UUID: "d", PerceptualHash: "0000ffff0000ffff"}
+	e := Picture{UUID: "e", PerceptualHash: "0000ffff0000fff8"}
+	alone := Picture{UUID: "alone", PerceptualHash: "ffffffff00000000"}
+	withoutHash := Picture{UUID: "without hash"}
+
+	tests := []struct {
+		name     string
+		pictures []Picture
+		want     [][]string
+		wantMax  []int
+	}{
+		{name: "chain in order", pictures: []Picture{a, b, c, d, e, alone, withoutHash}, want: [][]string{{"a", "b", "c"}, {"d", "e"}}, wantMax: []int{6, 3}},
+		{name: "chain linked last", pictures: []Picture{d, c, alone, a, e, b}, want: [][]string{{"c", "a", "b"}, {"d", "e"}}, wantMax: []int{6, 3}},
+		{name: "pair before the chain", pictures: []Picture{e, d, a, c, b}, want: [][]string{{"a", "c", "b"}, {"e", "d"}}, wantMax: []int{6, 3}},
+		{name: "nothing similar", pictures: []Picture{a, d, alone, withoutHash}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clusters := Clusters(test.pictures, configs.NearDuplicateThreshold)
+			if len(clusters) != len(test.want) {
+				t.Fatalf("got %d clusters, want %d", len(clusters), len(test.want))
+			}
+			for i, cluster := range clusters {
+				var got []string
+				for _, picture := range cluster.Pictures {
+					got = append(got, picture.UUID)
+				}
+				if !slices.Equal(got, test.want[i]) || cluster.MaxDistance != test.wantMax[i] {
+					t.Errorf("got cluster %v of max distance %d, want %v of %d", got, cluster.MaxDistance, test.want[i], test.wantMax[i])
+				}
+			}
+		})
+	}
+}
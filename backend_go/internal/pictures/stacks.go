@@ -0,0 +1,298 @@
+package pictures
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/internal/catalog"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var ErrSameStack = errors.New("picture is already in this stack")
+
+// variantSuffix matches the suffixes Lightroom and Photoshop add to the exports of a
+// frame: DSC_0221-Edit.jpg, DSC_0221-Edit-2.jpg and DSC_0221-HDR-Pano.jpg all come from
+// DSC_0221.
+var variantSuffix = regexp.MustCompile(`(?i)(-(edit|pano|hdr|enhanced(-nr|-sr)?)(-\d+)?)+$`)
+
+// sourceFrame returns the stem of the frame filename was exported from, and whether it
+// is an edited version of that frame.
+func sourceFrame(filename string) (string, bool) {
+	stem := strings.TrimSuffix(filename, path.Ext(filename))
+	frame := variantSuffix.ReplaceAllString(stem, "")
+	return frame, frame != stem
+}
+
+// uploadFilename keeps the base name of a file uploaded or dropped in a folder.
+func uploadFilename(filename string) string {
+	return path.Base(filepath.ToSlash(filename))
+}
+
+// StackKey identifies the frame a picture comes from: the stem of its filename and the
+// time it was shot. It is empty when either is unknown, the stems alone repeat as the
+// camera counters roll over.
+func StackKey(picture Picture) string {
+	if picture.Filename == "" || picture.Timestamp <= 0 {
+		return ""
+	}
+	frame, _ := sourceFrame(picture.Filename)
+	return strings.ToLower(frame) + "@" + strconv.Itoa(picture.Timestamp)
+}
+
+func isEdit(picture Picture) bool {
+	_, edit := sourceFrame(picture.Filename)
+	return edit
+}
+
+// findStack returns the stack holding the other versions of the frame of picture, empty
+// when it is the first one.
+func findStack(pictures []Picture, picture Picture) string {
+	key := StackKey(picture)
+	if key == "" {
+		return ""
+	}
+	for _, other := range pictures {
+		if other.UUID != picture.UUID && StackKey(other) == key {
+			return other.Stack
+		}
+	}
+	return ""
+}
+
+// StackMembers lists the pictures of a stack, cover first then by filename.
+func StackMembers(pictures []Picture, stack string) []Picture {
+	var members []Picture
+	for _, picture := range pictures {
+		if picture.Stack == stack {
+			members = append(members, picture)
+		}
+	}
+	slices.SortFunc(members, func(a Picture, b Picture) int {
+		if a.StackCover != b.StackCover {
+			if a.StackCover {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(cmp.Compare(a.Filename, b.Filename), cmp.Compare(a.UUID, b.UUID))
+	})
+	return members
+}
+
+// joinStack puts a new picture in the stack of the other versions of its frame, or in
+// a stack of its own, and returns the other members of the stack. The picture is the
+// cover of a new stack, and an edit takes the cover of a stack covered by an unedited
+// frame, setCover must then be called once the picture is inserted.
+func joinStack(tx Repository, picture *Picture) ([]Picture, error) {
+	allPictures, err := tx.List()
+	if err != nil {
+		return nil, err
+	}
+
+	picture.Stack = findStack(allPictures, *picture)
+	if picture.Stack == "" {
+		picture.Stack = picture.UUID
+		picture.StackCover = true
+		return nil, nil
+	}
+
+	members := StackMembers(allPictures, picture.Stack)
+	cover := members[0]
+	picture.StackCover = !cover.StackCover || (isEdit(*picture) && !isEdit(cover))
+	return members, nil
+}
+
+// setCover makes cover the cover of its stack and updates the other members of the
+// stack. It returns the members as they were and as they are for the changed ones.
+func setCover(tx Repository, members []Picture, cover string) ([]Picture, []Picture, error) {
+	var previous, updated []Picture
+	for _, member := range members {
+		if member.StackCover == (member.UUID == cover) {
+			continue
+		}
+		changed := member
+		changed.StackCover = member.UUID == cover
+		if err := tx.Update(changed); err != nil {
+			return nil, nil, err
+		}
+		previous = append(previous, member)
+		updated = append(updated, changed)
+	}
+	return previous, updated, nil
+}
+
+// electCover gives a stack left without cover a new one, the first of its members.
+func electCover(tx Repository, stack string) ([]Picture, []Picture, error) {
+	allPictures, err := tx.List()
+	if err != nil {
+		return nil, nil, err
+	}
+	members := StackMembers(allPictures, stack)
+	if len(members) == 0 || members[0].StackCover {
+		return nil, nil, nil
+	}
+	return setCover(tx, members, members[0].UUID)
+}
+
+func publishUpdates(previous []Picture, updated []Picture) {
+	for i := range updated {
+		publish(Event{Type: PictureUpdated, Picture: updated[i], Previous: &previous[i]})
+	}
+}
+
+// SetStackCover makes the picture the version of its stack shown in the listings.
+func SetStackCover(pictureUUID string) ([]Picture, error) {
+	var previous, updated, members []Picture
+	err := repository.Transaction(func(tx Repository) error {
+		picture, err := tx.Get(pictureUUID)
+		if err != nil {
+			return err
+		}
+		allPictures, err := tx.List()
+		if err != nil {
+			return err
+		}
+		if previous, updated, err = setCover(tx, StackMembers(allPictures, picture.Stack), pictureUUID); err != nil {
+			return err
+		}
+		allPictures, err = tx.List()
+		members = StackMembers(allPictures, picture.Stack)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	publishUpdates(previous, updated)
+	return members, nil
+}
+
+// MoveToStack moves the picture to the stack of target, or to a stack of its own when
+// target is empty. It joins the stack as a version, its former stack gets a new cover
+// if it was the cover.
+func MoveToStack(pictureUUID string, target string) ([]Picture, error) {
+	var previous, updated, members []Picture
+	err := repository.Transaction(func(tx Repository) error {
+		picture, err := tx.Get(pictureUUID)
+		if err != nil {
+			return err
+		}
+
+		allPictures, err := tx.List()
+		if err != nil {
+			return err
+		}
+
+		moved := picture
+		if target == "" {
+			if len(StackMembers(allPictures, picture.Stack)) == 1 {
+				return ErrSameStack
+			}
+			// The stack keeps its identifier when it was made from the picture.
+			moved.Stack, moved.StackCover = picture.UUID, true
+			if picture.Stack == picture.UUID {
+				moved.Stack = uuid.New().String()
+			}
+		} else {
+			targetPicture, err := tx.Get(target)
+			if err != nil {
+				return fmt.Errorf("target picture %s: %w", target, err)
+			}
+			if targetPicture.Stack == picture.Stack {
+				return ErrSameStack
+			}
+			moved.Stack, moved.StackCover = targetPicture.Stack, false
+		}
+		if err := tx.Update(moved); err != nil {
+			return err
+		}
+		previous, updated = []Picture{picture}, []Picture{moved}
+
+		electedPrevious, elected, err := electCover(tx, picture.Stack)
+		if err != nil {
+			return err
+		}
+		previous, updated = append(previous, electedPrevious...), append(updated, elected...)
+
+		allPictures, err = tx.List()
+		members = StackMembers(allPictures, moved.Stack)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	publishUpdates(previous, updated)
+	return members, nil
+}
+
+// GetPictureStack lists every version of the stack of a picture, cover first.
+func GetPictureStack(c *gin.Context) {
+	picture, err := repository.Get(c.Param("uuid"))
+	if errors.Is(err, catalog.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "picture not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
+
+	allPictures, err := repository.List()
+	if err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
+	members, err := PublicPictures(StackMembers(allPictures, picture.Stack))
+	if err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, members)
+}
+
+type MoveToStackPayload struct {
+	// Stack is the UUID of a picture of the destination stack, empty to take the picture
+	// out of its stack.
+	Stack string `json:"stack"`
+}
+
+func PutPictureStack(c *gin.Context) {
+	var payload MoveToStackPayload
+	if err := c.BindJSON(&payload); err != nil {
+		return
+	}
+
+	members, err := MoveToStack(c.Param("uuid"), payload.Stack)
+	respondWithStack(c, members, err)
+}
+
+func PutStackCover(c *gin.Context) {
+	members, err := SetStackCover(c.Param("uuid"))
+	respondWithStack(c, members, err)
+}
+
+func respondWithStack(c *gin.Context, members []Picture, err error) {
+	switch {
+	case err == nil:
+		c.IndentedJSON(http.StatusOK, members)
+	case errors.Is(err, ErrSameStack):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, catalog.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		fmt.Println(err)
+		c.Status(http.StatusInternalServerError)
+	}
+}
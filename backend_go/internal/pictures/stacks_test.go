@@ -0,0 +1,199 @@
+package pictures
+
+import (
+	"errors"
+	"github.com/evanespen/vanespen.art_2025/internal/catalog"
+	"slices"
+	"testing"
+)
+
+func TestStackKey(t *testing.T) {
+	tests := []struct {
+		filename  string
+		timestamp int
+		want      string
+	}{
+		{filename: "DSC_0221.jpg", timestamp: 1000, want: "dsc_0221@1000"},
+		{filename: "DSC_0221-Edit.jpg", timestamp: 1000, want: "dsc_0221@1000"},
+		{filename: "DSC_0221-Edit-2.jpg", timestamp: 1000, want: "dsc_0221@1000"},
+		{filename: "DSC_0221-HDR-Pano.jpg", timestamp: 1000, want: "dsc_0221@1000"},
+		{filename: "dsc_0221-enhanced-NR.tif", timestamp: 1000, want: "dsc_0221@1000"},
+		{filename: "DSC_0221-Copy.jpg", timestamp: 1000, want: "dsc_0221-copy@1000"},
+		{filename: "Edit.jpg", timestamp: 1000, want: "edit@1000"},
+		{filename: "DSC_0221.jpg", timestamp: 2000, want: "dsc_0221@2000"},
+		{filename: "DSC_0221.jpg", timestamp: 0, want: ""},
+		{filename: "", timestamp: 1000, want: ""},
+	}
+
+	for _, test := range tests {
+		if got := StackKey(Picture{Filename: test.filename, Timestamp: test.timestamp}); got != test.want {
+			t.Errorf("StackKey(%q at %d) = %q, want %q", test.filename, test.timestamp, got, test.want)
+		}
+	}
+}
+
+func TestJoinStack(t *testing.T) {
+	original := Picture{UUID: "original", Filename: "DSC_0221.jpg", Timestamp: 1000, Stack: "original", StackCover: true}
+	uncovered := Picture{UUID: "original", Filename: "DSC_0221.jpg", Timestamp: 1000, Stack: "original"}
+	coveredEdit := Picture{UUID: "edit", Filename: "DSC_0221-Edit.jpg", Timestamp: 1000, Stack: "original", StackCover: true}
+
+	tests := []struct {
+		name      string
+		existing  []Picture
+		picture   Picture
+		wantStack string
+		wantCover bool
+	}{
+		{name: "first version", picture: original, wantStack: "original", wantCover: true},
+		{name: "unknown timestamp", existing: []Picture{original}, picture: Picture{UUID: "new", Filename: "DSC_0221.jpg"}, wantStack: "new", wantCover: true},
+		{name: "same stem another time", existing: []Picture{original}, picture: Picture{UUID: "new", Filename: "DSC_0221.jpg", Timestamp: 2000}, wantStack: "new", wantCover: true},
+		{name: "edit of a covered original", existing: []Picture{original}, picture: Picture{UUID: "new", Filename: "DSC_0221-Edit.jpg", Timestamp: 1000}, wantStack: "original", wantCover: true},
+		{name: "original of a covered edit", existing: []Picture{uncovered, coveredEdit}, picture: Picture{UUID: "new", Filename: "DSC_0221.jpg", Timestamp: 1000}, wantStack: "original"},
+		{name: "second edit", existing: []Picture{uncovered, coveredEdit}, picture: Picture{UUID: "new", Filename: "DSC_0221-Edit-2.jpg", Timestamp: 1000}, wantStack: "original"},
+		{name: "stack without cover", existing: []Picture{uncovered}, picture: Picture{UUID: "new", Filename: "DSC_0221.jpg", Timestamp: 1000}, wantStack: "original", wantCover: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx := catalog.NewMemoryRepository[Picture]()
+			for _, picture := range test.existing {
+				if err := tx.Insert(picture); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			picture := test.picture
+			members, err := joinStack(tx, &picture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if picture.Stack != test.wantStack || picture.StackCover != test.wantCover {
+				t.Fatalf("joined stack %q as cover %t, want %q as cover %t", picture.Stack, picture.StackCover, test.wantStack, test.wantCover)
+			}
+			if picture.Stack != picture.UUID && len(members) != len(test.existing) {
+				t.Fatalf("got %d other members, want %d", len(members), len(test.existing))
+			}
+		})
+	}
+}
+
+// insertTestStack inserts a stack of three versions covered by the first one.
+func insertTestStack(t *testing.T) {
+	t.Helper()
+	insertTestPictures(t,
+		Picture{UUID: "a", Filename: "DSC_0001.jpg", Stack: "a", StackCover: true},
+		Picture{UUID: "b", Filename: "DSC_0001-Edit.jpg", Stack: "a"},
+		Picture{UUID: "c", Filename: "DSC_0001-Edit-2.jpg", Stack: "a"},
+		Picture{UUID: "d", Filename: "DSC_0002.jpg", Stack: "d", StackCover: true},
+	)
+}
+
+// stackCovers lists the stacks of the catalog and their covers, a stack without cover
+// has an empty one and a stack with several covers has them all.
+func stackCovers(t *testing.T) map[string][]string {
+	t.Helper()
+	allPictures, err := repository.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	covers := make(map[string][]string)
+	for _, picture := range allPictures {
+		if _, found := covers[picture.Stack]; !found {
+			covers[picture.Stack] = []string{}
+		}
+		if picture.StackCover {
+			covers[picture.Stack] = append(covers[picture.Stack], picture.UUID)
+		}
+	}
+	return covers
+}
+
+func TestSetStackCover(t *testing.T) {
+	tests := []struct {
+		name    string
+		picture string
+		wantErr error
+		want    []string
+	}{
+		{name: "another version", picture: "c", want: []string{"c", "b", "a"}},
+		{name: "current cover", picture: "a", want: []string{"a", "c", "b"}},
+		{name: "single version", picture: "d", want: []string{"d"}},
+		{name: "unknown", picture: "z", wantErr: catalog.ErrNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestCatalog(t)
+			insertTestStack(t)
+
+			members, err := SetStackCover(test.picture)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			if got := pageUUIDs(members); test.wantErr == nil && !slices.Equal(got, test.want) {
+				t.Fatalf("got members %v, want %v", got, test.want)
+			}
+			for stack, covers := range stackCovers(t) {
+				if len(covers) != 1 {
+					t.Errorf("stack %s has covers %v", stack, covers)
+				}
+			}
+		})
+	}
+}
+
+func TestMoveToStack(t *testing.T) {
+	tests := []struct {
+		name       string
+		picture    string
+		target     string
+		wantErr    error
+		wantStack  string
+		wantCovers map[string]string
+	}{
+		{name: "version to another stack", picture: "b", target: "d", wantStack: "d", wantCovers: map[string]string{"a": "a", "d": "d"}},
+		{name: "cover to another stack", picture: "a", target: "d", wantStack: "d", wantCovers: map[string]string{"a": "c", "d": "d"}},
+		{name: "version out of its stack", picture: "c", wantStack: "c", wantCovers: map[string]string{"a": "a", "c": "c", "d": "d"}},
+		{name: "cover out of its stack", picture: "a", wantCovers: map[string]string{"a": "c", "d": "d"}},
+		{name: "single version out of its stack", picture: "d", wantErr: ErrSameStack},
+		{name: "same stack", picture: "b", target: "c", wantErr: ErrSameStack},
+		{name: "unknown target", picture: "b", target: "z", wantErr: catalog.ErrNotFound},
+		{name: "unknown picture", picture: "z", target: "a", wantErr: catalog.ErrNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestCatalog(t)
+			insertTestStack(t)
+
+			_, err := MoveToStack(test.picture, test.target)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			moved, err := repository.Get(test.picture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.wantStack != "" && moved.Stack != test.wantStack {
+				t.Errorf("moved to stack %q, want %q", moved.Stack, test.wantStack)
+			}
+			covers := stackCovers(t)
+			// A picture taken out of the stack made from it gets a stack of a new identifier.
+			if test.wantStack == "" {
+				test.wantCovers[moved.Stack] = moved.UUID
+			}
+			if len(covers) != len(test.wantCovers) {
+				t.Errorf("got stacks %v, want %v", covers, test.wantCovers)
+			}
+			for stack, cover := range test.wantCovers {
+				if !slices.Equal(covers[stack], []string{cover}) {
+					t.Errorf("stack %s has covers %v, want %s", stack, covers[stack], cover)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package pictures
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const maxTagLength = 100
+
+// NormalizeTags trims the tags and drops the empty ones and the duplicates, tags
+// differing only by case are the same tag and the first spelling is kept.
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || HasTag(Picture{Tags: normalized}, tag) {
+			continue
+		}
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+func HasTag(picture Picture, tag string) bool {
+	return slices.ContainsFunc(picture.Tags, func(pictureTag string) bool {
+		return strings.EqualFold(pictureTag, tag)
+	})
+}
+
+// TagCounts counts the pictures by tag, under the spelling of the first picture met.
+func TagCounts(pictures []Picture) map[string]int {
+	spellings := make(map[string]string)
+	counts := make(map[string]int)
+	for _, picture := range pictures {
+		for _, tag := range picture.Tags {
+			key := strings.ToLower(tag)
+			if _, ok := spellings[key]; !ok {
+				spellings[key] = tag
+			}
+			counts[spellings[key]]++
+		}
+	}
+	return counts
+}
+
+// GetTags lists the tags of the pictures matching the filter with their number of
+// pictures, most used first.
+func GetTags(c *gin.Context) {
+	filter, err := ParsePublicFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	allPictures, err := repository.List()
+	if err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, FacetsByCount(TagCounts(filter.Apply(allPictures))))
+}
@@ -0,0 +1,97 @@
+package pictures
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{name: "empty", tags: nil, want: []string{}},
+		{name: "trimmed", tags: []string{" alps ", "\tibex"}, want: []string{"alps", "ibex"}},
+		{name: "blank dropped", tags: []string{"", "  ", "alps"}, want: []string{"alps"}},
+		{name: "duplicates dropped", tags: []string{"alps", "ibex", "alps"}, want: []string{"alps", "ibex"}},
+		{name: "first spelling kept", tags: []string{"Ibex", "ibex", "IBEX "}, want: []string{"Ibex"}},
+		{name: "order kept", tags: []string{"winter", "alps", "Winter"}, want: []string{"winter", "alps"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := NormalizeTags(test.tags); !slices.Equal(got, test.want) {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTagCounts(t *testing.T) {
+	pictures := []Picture{
+		{UUID: "a", Tags: []string{"Ibex", "alps"}},
+		{UUID: "b", Tags: []string{"ibex"}},
+		{UUID: "c", Tags: []string{"ALPS", "winter"}},
+		{UUID: "d"},
+	}
+	want := map[string]int{"Ibex": 2, "alps": 2, "winter": 1}
+	if got := TagCounts(pictures); !maps.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestGetTagsAfterRenames(t *testing.T) {
+	useTestCatalog(t)
+	insertTestPictures(t,
+		Picture{UUID: "a", StackCover: true, Tags: []string{"ibex", "alps"}, OriginalValues: map[string]string{}},
+		Picture{UUID: "b", StackCover: true, Tags: []string{"ibex"}, Camera: "R6", OriginalValues: map[string]string{}},
+		Picture{UUID: "a-edit", Stack: "a", Tags: []string{"ibex", "edit"}, OriginalValues: map[string]string{}},
+	)
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/tags", GetTags)
+
+	// Each rename applies to the catalog left by the previous one.
+	steps := []struct {
+		name    string
+		picture string
+		tags    []string
+		query   string
+		want    []FacetCount
+	}{
+		{name: "before any rename", want: []FacetCount{{"ibex", 2}, {"alps", 1}}},
+		{name: "every version", query: "?versions=all", want: []FacetCount{{"ibex", 3}, {"alps", 1}, {"edit", 1}}},
+		{name: "respelled", picture: "a", tags: []string{"Alpine ibex", "alps"}, want: []FacetCount{{"Alpine ibex", 1}, {"alps", 1}, {"ibex", 1}}},
+		{name: "renamed on every picture", picture: "b", tags: []string{"alpine IBEX"}, want: []FacetCount{{"Alpine ibex", 2}, {"alps", 1}}},
+		{name: "duplicate spellings", picture: "b", tags: []string{"Alps", " alps", "alpine ibex"}, want: []FacetCount{{"Alpine ibex", 2}, {"alps", 2}}},
+		{name: "filtered", query: "?camera=R6", want: []FacetCount{{"Alps", 1}, {"alpine ibex", 1}}},
+		{name: "removed", picture: "a", tags: []string{}, want: []FacetCount{{"Alps", 1}, {"alpine ibex", 1}}},
+	}
+
+	for _, step := range steps {
+		if step.picture != "" {
+			if _, err := UpdatePicture(step.picture, PicturePatch{Tags: &step.tags}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, httptest.NewRequest("GET", "/tags"+step.query, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d", step.name, recorder.Code)
+		}
+		var got []FacetCount
+		if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, step.want) {
+			t.Fatalf("%s: got %v, want %v", step.name, got, step.want)
+		}
+	}
+}
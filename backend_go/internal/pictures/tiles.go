@@ -0,0 +1,126 @@
+package pictures
+
+import (
+	"errors"
+	"fmt"
+	"github.com/disintegration/imaging"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/evanespen/vanespen.art_2025/internal/catalog"
+	"github.com/evanespen/vanespen.art_2025/internal/cdn"
+	"github.com/gin-gonic/gin"
+	"image"
+	"net/http"
+	"os"
+	"path"
+)
+
+// saveTiles writes the tile pyramid of img next to the tiles of picture then swaps it
+// with them, an interrupted write never leaves a partial pyramid behind.
+func (r Rendition) saveTiles(img image.Image, picture Picture) error {
+	target := r.Path(picture)
+	temporary := path.Join(r.Dir, ".tmp-"+picture.UUID)
+	_ = os.RemoveAll(temporary)
+	if err := writeTiles(img, temporary); err != nil {
+		_ = os.RemoveAll(temporary)
+		return err
+	}
+
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	return os.Rename(temporary, target)
+}
+
+// writeTiles writes the Deep Zoom pyramid of img in dir, each level resized from the
+// one above.
+func writeTiles(img image.Image, dir string) error {
+	pyramid := cdn.NewPyramid(img.Bounds().Dx(), img.Bounds().Dy())
+
+	levelImage := img
+	for level := pyramid.MaxLevel(); level >= 0; level-- {
+		width, height := pyramid.LevelSize(level)
+		if level < pyramid.MaxLevel() {
+			levelImage = imaging.Resize(levelImage, width, height, imaging.Lanczos)
+		}
+		if err := os.MkdirAll(path.Dir(cdn.TilePath(dir, level, 0, 0)), 0755); err != nil {
+			return err
+		}
+
+		columns, rows := pyramid.Tiles(level)
+		for column := range columns {
+			for row := range rows {
+				bounds := pyramid.TileBounds(level, column, row).Add(levelImage.Bounds().Min)
+				tile := imaging.Crop(levelImage, bounds)
+				if err := imaging.Save(tile, cdn.TilePath(dir, level, column, row), imaging.JPEGQuality(configs.RenditionQuality)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	descriptor, err := pyramid.DZI()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(dir, cdn.DZIFile), descriptor, 0644)
+}
+
+type TilesManifest struct {
+	UUID     string `json:"uuid"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	TileSize int    `json:"tile_size"`
+	Overlap  int    `json:"overlap"`
+	Format   string `json:"format"`
+	MaxLevel int    `json:"max_level"`
+	// DZI is the URL of the Deep Zoom descriptor, IIIF the one of the IIIF info.json, both
+	// under the version of the tiles.
+	DZI  string `json:"dzi"`
+	IIIF string `json:"iiif"`
+}
+
+// GetPictureTiles gives a zoomable viewer the pyramid of a tiled picture and the URLs of
+// its descriptors, the pictures without tiles get a 404.
+func GetPictureTiles(c *gin.Context) {
+	picture, err := repository.Get(c.Param("uuid"))
+	if errors.Is(err, catalog.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "picture not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
+
+	pyramid, err := cdn.ReadPyramid(picture.UUID)
+	if errors.Is(err, cdn.ErrNoTiles) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
+
+	version, err := cdn.TilesVersion(picture.UUID)
+	if err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
+
+	tiles := cdn.TilesURL(picture.UUID, version)
+	c.IndentedJSON(http.StatusOK, TilesManifest{
+		UUID:     picture.UUID,
+		Width:    pyramid.Width,
+		Height:   pyramid.Height,
+		TileSize: pyramid.TileSize,
+		Overlap:  0,
+		Format:   cdn.TileFormat,
+		MaxLevel: pyramid.MaxLevel(),
+		DZI:      tiles + cdn.DZIFile,
+		IIIF:     tiles + "iiif/info.json",
+	})
+}
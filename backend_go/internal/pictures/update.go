@@ -0,0 +1,179 @@
+package pictures
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidPatch = errors.New("invalid picture update")
+
+const maxDescriptionLength = 5000
+const maxTitleLength = 500
+
+var aperturePattern = regexp.MustCompile(`^f/\d+(\.\d+)?$`)
+var focalLengthPattern = regexp.MustCompile(`^\d+(\.\d+)? mm$`)
+
+// PicturePatch lists the editable fields of a picture, nil fields are left unchanged.
+// Camera, Mode, Aperture, Iso, Speed, FocalLength, Lens and Timestamp are extracted from
+// the EXIF data at ingest and can be corrected when the camera got them wrong. Tags
+// replace the tags of the picture.
+type PicturePatch struct {
+	Favourite      *bool   `json:"favourite"`
+	TriggerWarning *bool   `json:"trigger_warning"`
+	Description    *string `json:"description"`
+	Camera         *string `json:"camera"`
+	Mode           *string `json:"mode"`
+	Aperture       *string `json:"aperture"`
+	Iso            *int    `json:"iso"`
+	Speed          *string `json:"speed"`
+	FocalLength    *string `json:"focal_length"`
+	Lens           *string `json:"lens"`
+	Timestamp      *int    `json:"timestamp"`
+
+	Title  *string   `json:"title"`
+	Tags   *[]string `json:"tags"`
+	Rating *int      `json:"rating"`
+
+	// LocationPrivacy sets the privacy level of the picture, or removes it when empty.
+	LocationPrivacy *string `json:"location_privacy"`
+}
+
+func (p PicturePatch) Validate() error {
+	if p.Description != nil && len(*p.Description) > maxDescriptionLength {
+		return fmt.Errorf("%w: description is longer than %d characters", ErrInvalidPatch, maxDescriptionLength)
+	}
+	if p.Title != nil && len(*p.Title) > maxTitleLength {
+		return fmt.Errorf("%w: title is longer than %d characters", ErrInvalidPatch, maxTitleLength)
+	}
+	if p.Tags != nil {
+		for _, tag := range *p.Tags {
+			if len(tag) > maxTagLength {
+				return fmt.Errorf("%w: tags cannot be longer than %d characters", ErrInvalidPatch, maxTagLength)
+			}
+		}
+	}
+	if p.Rating != nil && (*p.Rating < 0 || *p.Rating > 5) {
+		return fmt.Errorf("%w: rating must be between 0 and 5", ErrInvalidPatch)
+	}
+	if p.LocationPrivacy != nil && *p.LocationPrivacy != "" && !IsLocationPrivacy(*p.LocationPrivacy) {
+		return fmt.Errorf("%w: location_privacy must be one of %s", ErrInvalidPatch, strings.Join(LocationPrivacyLevels, ", "))
+	}
+	for field, value := range map[string]*string{"camera": p.Camera, "mode": p.Mode, "speed": p.Speed, "lens": p.Lens} {
+		if value != nil && strings.TrimSpace(*value) == "" {
+			return fmt.Errorf("%w: %s cannot be empty", ErrInvalidPatch, field)
+		}
+	}
+	if p.Aperture != nil && !aperturePattern.MatchString(*p.Aperture) {
+		return fmt.Errorf("%w: aperture must look like f/2.8", ErrInvalidPatch)
+	}
+	if p.FocalLength != nil && !focalLengthPattern.MatchString(*p.FocalLength) {
+		return fmt.Errorf("%w: focal_length must look like 50.0 mm", ErrInvalidPatch)
+	}
+	if p.Iso != nil && (*p.Iso <= 0 || *p.Iso > math.MaxInt32) {
+		return fmt.Errorf("%w: iso must be between 1 and %d", ErrInvalidPatch, math.MaxInt32)
+	}
+	if p.Timestamp != nil && *p.Timestamp <= 0 {
+		return fmt.Errorf("%w: timestamp must be a positive unix timestamp", ErrInvalidPatch)
+	}
+	return nil
+}
+
+func (p PicturePatch) Apply(picture Picture) Picture {
+	corrected := picture
+	corrected.OriginalValues = make(map[string]string, len(picture.OriginalValues))
+	for field, value := range picture.OriginalValues {
+		corrected.OriginalValues[field] = value
+	}
+
+	if p.Favourite != nil {
+		corrected.Favourite = *p.Favourite
+	}
+	if p.TriggerWarning != nil {
+		corrected.TriggerWarning = *p.TriggerWarning
+	}
+	if p.Description != nil {
+		corrected.Description = *p.Description
+	}
+	if p.Title != nil {
+		corrected.Title = strings.TrimSpace(*p.Title)
+	}
+	if p.Tags != nil {
+		corrected.Tags = NormalizeTags(*p.Tags)
+	}
+	if p.Rating != nil {
+		corrected.Rating = int32(*p.Rating)
+	}
+	if p.LocationPrivacy != nil {
+		corrected.LocationPrivacy = *p.LocationPrivacy
+	}
+
+	correctString(&corrected, "camera", &corrected.Camera, p.Camera)
+	correctString(&corrected, "mode", &corrected.Mode, p.Mode)
+	correctString(&corrected, "aperture", &corrected.Aperture, p.Aperture)
+	correctString(&corrected, "speed", &corrected.Speed, p.Speed)
+	correctString(&corrected, "focal_length", &corrected.FocalLength, p.FocalLength)
+	correctString(&corrected, "lens", &corrected.Lens, p.Lens)
+
+	if p.Iso != nil {
+		corrected.Iso = correct(&corrected, "iso", corrected.Iso, *p.Iso)
+	}
+	if p.Timestamp != nil {
+		corrected.Timestamp = correct(&corrected, "timestamp", corrected.Timestamp, *p.Timestamp)
+	}
+
+	return corrected
+}
+
+func correctString(picture *Picture, field string, current *string, value *string) {
+	if value == nil {
+		return
+	}
+	recordOriginal(picture, field, *current, *value)
+	*current = *value
+}
+
+func correct(picture *Picture, field string, current int, value int) int {
+	recordOriginal(picture, field, strconv.Itoa(current), strconv.Itoa(value))
+	return value
+}
+
+// recordOriginal remembers the extracted value the first time a field is corrected, and
+// forgets it when the field is set back to that value.
+func recordOriginal(picture *Picture, field string, current string, value string) {
+	original, corrected := picture.OriginalValues[field]
+	if !corrected {
+		original = current
+	}
+
+	if value == original {
+		delete(picture.OriginalValues, field)
+	} else {
+		picture.OriginalValues[field] = original
+	}
+}
+
+func UpdatePicture(pictureUUID string, patch PicturePatch) (Picture, error) {
+	if err := patch.Validate(); err != nil {
+		return Picture{}, err
+	}
+
+	var previous, updated Picture
+	err := repository.Transaction(func(tx Repository) error {
+		var err error
+		if previous, err = tx.Get(pictureUUID); err != nil {
+			return err
+		}
+		updated = patch.Apply(previous)
+		return tx.Update(updated)
+	})
+	if err != nil {
+		return Picture{}, err
+	}
+
+	publish(Event{Type: PictureUpdated, Picture: updated, Previous: &previous})
+	return updated, nil
+}
@@ -0,0 +1,109 @@
+package pictures
+
+import (
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+)
+
+func ref[T any](value T) *T {
+	return &value
+}
+
+func TestPicturePatchValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   PicturePatch
+		wantErr error
+	}{
+		{name: "empty", patch: PicturePatch{}},
+		{name: "every field", patch: PicturePatch{
+			Favourite: ref(true), Description: ref("description"), Camera: ref("Canon EOS R6"), Mode: ref("manual"),
+			Aperture: ref("f/2.8"), Iso: ref(400), Speed: ref("1/250"), FocalLength: ref("50.0 mm"), Lens: ref("RF 50mm"),
+			Timestamp: ref(1700000000), Title: ref("title"), Tags: ref([]string{"alps"}), Rating: ref(5), LocationPrivacy: ref(LocationCoarse),
+		}},
+		{name: "whole aperture", patch: PicturePatch{Aperture: ref("f/8")}},
+		{name: "location privacy removed", patch: PicturePatch{LocationPrivacy: ref("")}},
+		{name: "rating of zero", patch: PicturePatch{Rating: ref(0)}},
+		{name: "description too long", patch: PicturePatch{Description: ref(strings.Repeat("a", maxDescriptionLength+1))}, wantErr: ErrInvalidPatch},
+		{name: "title too long", patch: PicturePatch{Title: ref(strings.Repeat("a", maxTitleLength+1))}, wantErr: ErrInvalidPatch},
+		{name: "tag too long", patch: PicturePatch{Tags: ref([]string{"alps", strings.Repeat("a", maxTagLength+1)})}, wantErr: ErrInvalidPatch},
+		{name: "rating too high", patch: PicturePatch{Rating: ref(6)}, wantErr: ErrInvalidPatch},
+		{name: "negative rating", patch: PicturePatch{Rating: ref(-1)}, wantErr: ErrInvalidPatch},
+		{name: "unknown location privacy", patch: PicturePatch{LocationPrivacy: ref("blurred")}, wantErr: ErrInvalidPatch},
+		{name: "empty camera", patch: PicturePatch{Camera: ref(" ")}, wantErr: ErrInvalidPatch},
+		{name: "empty lens", patch: PicturePatch{Lens: ref("")}, wantErr: ErrInvalidPatch},
+		{name: "aperture without f/", patch: PicturePatch{Aperture: ref("2.8")}, wantErr: ErrInvalidPatch},
+		{name: "focal length without unit", patch: PicturePatch{FocalLength: ref("50")}, wantErr: ErrInvalidPatch},
+		{name: "iso of zero", patch: PicturePatch{Iso: ref(0)}, wantErr: ErrInvalidPatch},
+		{name: "iso too high", patch: PicturePatch{Iso: ref(1 << 40)}, wantErr: ErrInvalidPatch},
+		{name: "negative timestamp", patch: PicturePatch{Timestamp: ref(-1)}, wantErr: ErrInvalidPatch},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.patch.Validate(); !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestPicturePatchOriginalValues(t *testing.T) {
+	ingested := Picture{UUID: "picture", Camera: "Canon EOS R6", Iso: 100, Aperture: "f/4", OriginalValues: make(map[string]string)}
+
+	// Each patch applies to the picture left by the previous one.
+	steps := []struct {
+		name          string
+		patch         PicturePatch
+		wantCamera    string
+		wantIso       int
+		wantOriginals map[string]string
+	}{
+		{name: "not an EXIF field", patch: PicturePatch{Title: ref("title")}, wantCamera: "Canon EOS R6", wantIso: 100, wantOriginals: map[string]string{}},
+		{name: "same value", patch: PicturePatch{Camera: ref("Canon EOS R6")}, wantCamera: "Canon EOS R6", wantIso: 100, wantOriginals: map[string]string{}},
+		{name: "corrected", patch: PicturePatch{Camera: ref("Canon EOS R5")}, wantCamera: "Canon EOS R5", wantIso: 100, wantOriginals: map[string]string{"camera": "Canon EOS R6"}},
+		{name: "corrected again", patch: PicturePatch{Camera: ref("Canon EOS R7")}, wantCamera: "Canon EOS R7", wantIso: 100, wantOriginals: map[string]string{"camera": "Canon EOS R6"}},
+		{name: "another field", patch: PicturePatch{Iso: ref(400)}, wantCamera: "Canon EOS R7", wantIso: 400, wantOriginals: map[string]string{"camera": "Canon EOS R6", "iso": "100"}},
+		{name: "both corrected again", patch: PicturePatch{Camera: ref("Canon EOS R8"), Iso: ref(800)}, wantCamera: "Canon EOS R8", wantIso: 800, wantOriginals: map[string]string{"camera": "Canon EOS R6", "iso": "100"}},
+		{name: "set back to the original", patch: PicturePatch{Camera: ref("Canon EOS R6")}, wantCamera: "Canon EOS R6", wantIso: 800, wantOriginals: map[string]string{"iso": "100"}},
+		{name: "corrected after being set back", patch: PicturePatch{Camera: ref("Canon EOS R5")}, wantCamera: "Canon EOS R5", wantIso: 800, wantOriginals: map[string]string{"camera": "Canon EOS R6", "iso": "100"}},
+		{name: "all set back", patch: PicturePatch{Camera: ref("Canon EOS R6"), Iso: ref(100)}, wantCamera: "Canon EOS R6", wantIso: 100, wantOriginals: map[string]string{}},
+	}
+
+	picture := ingested
+	for _, step := range steps {
+		previous := maps.Clone(picture.OriginalValues)
+		corrected := step.patch.Apply(picture)
+		if corrected.Camera != step.wantCamera || corrected.Iso != step.wantIso || corrected.Aperture != "f/4" {
+			t.Fatalf("%s: got camera %q, iso %d, aperture %q", step.name, corrected.Camera, corrected.Iso, corrected.Aperture)
+		}
+		if !maps.Equal(corrected.OriginalValues, step.wantOriginals) {
+			t.Fatalf("%s: got original values %v, want %v", step.name, corrected.OriginalValues, step.wantOriginals)
+		}
+		if !maps.Equal(picture.OriginalValues, previous) {
+			t.Fatalf("%s: the original values of the patched picture are modified", step.name)
+		}
+		picture = corrected
+	}
+}
+
+func TestUpdatePicture(t *testing.T) {
+	useTestCatalog(t)
+	insertTestPictures(t, Picture{UUID: "picture", Camera: "Canon EOS R6", OriginalValues: make(map[string]string)})
+
+	if _, err := UpdatePicture("picture", PicturePatch{Camera: ref("Canon EOS R5"), Rating: ref(6)}); !errors.Is(err, ErrInvalidPatch) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidPatch)
+	}
+	if stored, _ := repository.Get("picture"); stored.Camera != "Canon EOS R6" || len(stored.OriginalValues) != 0 {
+		t.Fatalf("the rejected patch is stored: %+v", stored)
+	}
+
+	if _, err := UpdatePicture("picture", PicturePatch{Camera: ref("Canon EOS R5")}); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := repository.Get("picture"); stored.Camera != "Canon EOS R5" || stored.OriginalValues["camera"] != "Canon EOS R6" {
+		t.Fatalf("got camera %q and original values %v", stored.Camera, stored.OriginalValues)
+	}
+}
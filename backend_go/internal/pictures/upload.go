@@ -0,0 +1,98 @@
+package pictures
+
+import (
+	"errors"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"net/http"
+)
+
+type UploadStatus string
+
+const (
+	UploadCreated   UploadStatus = "created"
+	UploadDuplicate UploadStatus = "duplicate"
+	UploadRejected  UploadStatus = "rejected"
+	UploadFailed    UploadStatus = "failed"
+)
+
+// Stage is the progress of a file through the ingest pipeline, stored and failed are final.
+type Stage string
+
+const (
+	StageQueued    Stage = "queued"
+	StageStashed   Stage = "stashed"
+	StageExtracted Stage = "extracted"
+	StageResized   Stage = "resized"
+	StageStored    Stage = "stored"
+	StageFailed    Stage = "failed"
+)
+
+// UploadResult reports what happened to one uploaded file. UUID is the created picture
+// or, for a duplicate, the picture already in the catalog. SimilarTo flags the near
+// duplicates of a created picture.
+type UploadResult struct {
+	Filename  string       `json:"filename"`
+	Status    UploadStatus `json:"status"`
+	UUID      string       `json:"uuid,omitempty"`
+	Reason    string       `json:"reason,omitempty"`
+	Picture   *Picture     `json:"picture,omitempty"`
+	SimilarTo []Similarity `json:"similar_to,omitempty"`
+}
+
+func Ingest(imagePath string, filename string) UploadResult {
+	picture, err := Handle(imagePath, filename)
+	return NewUploadResult(filename, picture, err)
+}
+
+func NewUploadResult(filename string, picture Picture, err error) UploadResult {
+	result := UploadResult{Filename: filename}
+
+	var duplicateError *DuplicateError
+	var nearDuplicateError *NearDuplicateError
+	switch {
+	case err == nil:
+		result.Status = UploadCreated
+		result.UUID = picture.UUID
+		result.Picture = &picture
+		if configs.NearDuplicatePolicy == NearDuplicateFlag {
+			result.SimilarTo, _ = SimilarPictures(picture)
+		}
+	case errors.As(err, &duplicateError):
+		result.Status = UploadDuplicate
+		result.UUID = duplicateError.ExistingUUID
+		result.Reason = err.Error()
+	case errors.As(err, &nearDuplicateError):
+		result.Status = UploadDuplicate
+		result.UUID = nearDuplicateError.ExistingUUID
+		result.Reason = err.Error()
+	case errors.Is(err, ErrUnsupportedImage):
+		result.Status = UploadRejected
+		result.Reason = err.Error()
+	default:
+		result.Status = UploadFailed
+		result.Reason = err.Error()
+	}
+
+	return result
+}
+
+// UploadStatusCode is the status of the whole upload: the status shared by every
+// file, or 207 Multi-Status when they differ.
+func UploadStatusCode(results []UploadResult) int {
+	codes := map[UploadStatus]int{
+		UploadCreated:   http.StatusCreated,
+		UploadDuplicate: http.StatusConflict,
+		UploadRejected:  http.StatusUnprocessableEntity,
+		UploadFailed:    http.StatusInternalServerError,
+	}
+
+	if len(results) == 0 {
+		return http.StatusBadRequest
+	}
+	for _, result := range results[1:] {
+		if result.Status != results[0].Status {
+			return http.StatusMultiStatus
+		}
+	}
+	return codes[results[0].Status]
+}
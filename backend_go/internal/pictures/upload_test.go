@@ -0,0 +1,70 @@
+package pictures
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestUploadStatusCode(t *testing.T) {
+	created := UploadResult{Filename: "a.jpg", Status: UploadCreated}
+	duplicate := UploadResult{Filename: "b.jpg", Status: UploadDuplicate}
+	rejected := UploadResult{Filename: "c.txt", Status: UploadRejected}
+	failed := UploadResult{Filename: "d.jpg", Status: UploadFailed}
+
+	tests := []struct {
+		name    string
+		results []UploadResult
+		want    int
+	}{
+		{name: "nothing uploaded", results: nil, want: http.StatusBadRequest},
+		{name: "created", results: []UploadResult{created}, want: http.StatusCreated},
+		{name: "all created", results: []UploadResult{created, created, created}, want: http.StatusCreated},
+		{name: "all duplicates", results: []UploadResult{duplicate, duplicate}, want: http.StatusConflict},
+		{name: "all rejected", results: []UploadResult{rejected, rejected}, want: http.StatusUnprocessableEntity},
+		{name: "all failed", results: []UploadResult{failed}, want: http.StatusInternalServerError},
+		{name: "created and duplicate", results: []UploadResult{created, duplicate}, want: http.StatusMultiStatus},
+		{name: "created and rejected", results: []UploadResult{created, created, rejected}, want: http.StatusMultiStatus},
+		{name: "rejected then created", results: []UploadResult{rejected, created}, want: http.StatusMultiStatus},
+		{name: "client errors of both kinds", results: []UploadResult{duplicate, rejected}, want: http.StatusMultiStatus},
+		{name: "every status", results: []UploadResult{failed, created, duplicate, rejected}, want: http.StatusMultiStatus},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := UploadStatusCode(test.results); got != test.want {
+				t.Fatalf("got status %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewUploadResult(t *testing.T) {
+	useTestCatalog(t)
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus UploadStatus
+		wantUUID   string
+	}{
+		{name: "created", wantStatus: UploadCreated, wantUUID: "picture"},
+		{name: "duplicate", err: &DuplicateError{ExistingUUID: "existing"}, wantStatus: UploadDuplicate, wantUUID: "existing"},
+		{name: "near duplicate", err: &NearDuplicateError{ExistingUUID: "similar", Distance: 3}, wantStatus: UploadDuplicate, wantUUID: "similar"},
+		{name: "unsupported", err: fmt.Errorf("%w: text/plain", ErrUnsupportedImage), wantStatus: UploadRejected},
+		{name: "failed", err: errors.New("disk full"), wantStatus: UploadFailed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := NewUploadResult("photo.jpg", Picture{UUID: "picture"}, test.err)
+			if result.Status != test.wantStatus || result.UUID != test.wantUUID || result.Filename != "photo.jpg" {
+				t.Fatalf("got %+v, want status %s and UUID %q", result, test.wantStatus, test.wantUUID)
+			}
+			if (result.Picture != nil) != (test.err == nil) || (result.Reason == "") != (test.err == nil) {
+				t.Fatalf("got picture %v and reason %q for error %v", result.Picture, result.Reason, test.err)
+			}
+		})
+	}
+}
@@ -8,6 +8,14 @@ import (
 	"time"
 )
 
+const passwordCost = 12
+
+// HashPassword returns the bcrypt hash to set as configs.PasswordHash.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	return string(hash), err
+}
+
 func Authenticate(password string) (string, error) {
 	err := bcrypt.CompareHashAndPassword([]byte(configs.PasswordHash), []byte(password))
 	if err != nil {
@@ -0,0 +1,166 @@
+package species
+
+import (
+	"errors"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/internal/catalog"
+	"github.com/evanespen/vanespen.art_2025/internal/pictures"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// SpeciesDetail is a species along with its pictures rather than their UUIDs.
+type SpeciesDetail struct {
+	Species
+	Pictures []pictures.Picture `json:"pictures"`
+}
+
+type AssignPayload struct {
+	Species []string `json:"species"`
+}
+
+func respondWithError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidSpecies):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrNameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, catalog.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "species not found"})
+	default:
+		fmt.Println(err)
+		c.Status(http.StatusInternalServerError)
+	}
+}
+
+func GetAllSpecies(c *gin.Context) {
+	allSpecies, err := repository.List()
+	if err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
+
+	slices.SortFunc(allSpecies, func(a Species, b Species) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	c.IndentedJSON(http.StatusOK, allSpecies)
+}
+
+// GetOneSpecies accepts the UUID or the name of the species.
+func GetOneSpecies(c *gin.Context) {
+	species, err := Find(c.Param("uuid"))
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	detail := SpeciesDetail{Species: species, Pictures: make([]pictures.Picture, 0, len(species.Pictures))}
+	for _, pictureUUID := range species.Pictures {
+		picture, err := pictures.GetRepository().Get(pictureUUID)
+		if errors.Is(err, catalog.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			fmt.Println(err)
+			c.Status(500)
+			return
+		}
+		detail.Pictures = append(detail.Pictures, picture)
+	}
+	if detail.Pictures, err = pictures.PublicPictures(detail.Pictures); err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, detail)
+}
+
+func PostSpecies(c *gin.Context) {
+	var payload SpeciesPayload
+	if err := c.BindJSON(&payload); err != nil {
+		return
+	}
+
+	species, err := Create(payload)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, species)
+}
+
+func PutSpecies(c *gin.Context) {
+	var payload SpeciesPayload
+	if err := c.BindJSON(&payload); err != nil {
+		return
+	}
+
+	species, err := Update(c.Param("uuid"), payload)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, species)
+}
+
+func DeleteSpecies(c *gin.Context) {
+	if err := repository.Delete(c.Param("uuid")); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func GetPictureSpecies(c *gin.Context) {
+	assigned, err := ForPicture(c.Param("uuid"))
+	if err != nil {
+		fmt.Println(err)
+		c.Status(500)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, assigned)
+}
+
+// PutPictureSpecies replaces the species of a picture.
+func PutPictureSpecies(c *gin.Context) {
+	var payload AssignPayload
+	if err := c.BindJSON(&payload); err != nil {
+		return
+	}
+
+	pictureUUID := c.Param("uuid")
+	if _, err := pictures.GetRepository().Get(pictureUUID); errors.Is(err, catalog.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "picture not found"})
+		return
+	}
+
+	if err := AssignPicture(pictureUUID, payload.Species); err != nil {
+		if errors.Is(err, catalog.ErrNotFound) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		respondWithError(c, err)
+		return
+	}
+
+	GetPictureSpecies(c)
+}
+
+func BindRoutes(engine *gin.Engine, adminGroup *gin.RouterGroup) {
+	speciesRouter := engine.Group("/species")
+	speciesRouter.GET("/", GetAllSpecies)
+	speciesRouter.GET("/:uuid", GetOneSpecies)
+	engine.GET("/pictures/:uuid/species", GetPictureSpecies)
+	adminGroup.POST("/species", PostSpecies)
+	adminGroup.PUT("/species/:uuid", PutSpecies)
+	adminGroup.DELETE("/species/:uuid", DeleteSpecies)
+	adminGroup.PUT("/pictures/:uuid/species", PutPictureSpecies)
+}
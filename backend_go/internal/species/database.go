@@ -0,0 +1,199 @@
+package species
+
+import (
+	"errors"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/evanespen/vanespen.art_2025/internal/catalog"
+	"github.com/evanespen/vanespen.art_2025/internal/pictures"
+	"slices"
+	"strings"
+)
+
+const catalogName = "species"
+
+type Repository = catalog.Repository[Species]
+
+var repository Repository
+
+var ErrNameTaken = errors.New("a species with this name already exists")
+
+func init() {
+	pictures.Subscribe(func(event pictures.Event) {
+		if event.Type != pictures.PictureDeleted || repository == nil {
+			return
+		}
+		if err := RemovePicture(event.Picture.UUID); err != nil {
+			fmt.Println(err)
+		}
+	})
+	pictures.RegisterLocationPolicy(locationPolicy)
+}
+
+// locationPolicy applies to the pictures the privacy level of their species, the most
+// private one when they show several.
+func locationPolicy([]pictures.Picture) (map[string]string, error) {
+	levels := make(map[string]string)
+	if repository == nil {
+		return levels, nil
+	}
+
+	allSpecies, err := repository.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, species := range allSpecies {
+		if species.LocationPrivacy == "" {
+			continue
+		}
+		for _, pictureUUID := range species.Pictures {
+			levels[pictureUUID] = pictures.StricterPrivacy(levels[pictureUUID], species.LocationPrivacy)
+		}
+	}
+	return levels, nil
+}
+
+func OpenRepository() (Repository, error) {
+	return catalog.Open[Species](catalogName, configs.SpeciesDatabaseFile)
+}
+
+func Migrate(dryRun bool) (catalog.MigrationReport, error) {
+	return catalog.MigrateParquet[Species](catalogName, configs.SpeciesDatabaseFile, dryRun)
+}
+
+func SetRepository(r Repository) {
+	repository = r
+}
+
+func GetRepository() Repository {
+	return repository
+}
+
+func (s Species) GetUUID() string {
+	return s.UUID
+}
+
+// Find returns the species with the given uuid or, failing that, the given name.
+func Find(key string) (Species, error) {
+	species, err := repository.Get(key)
+	if !errors.Is(err, catalog.ErrNotFound) {
+		return species, err
+	}
+
+	allSpecies, err := repository.List()
+	if err != nil {
+		return Species{}, err
+	}
+	for _, species := range allSpecies {
+		if strings.EqualFold(species.Name, key) {
+			return species, nil
+		}
+	}
+	return Species{}, catalog.ErrNotFound
+}
+
+// checkName returns ErrNameTaken when another species than exceptUUID has this name.
+func checkName(r Repository, name string, exceptUUID string) error {
+	allSpecies, err := r.List()
+	if err != nil {
+		return err
+	}
+	for _, species := range allSpecies {
+		if species.UUID != exceptUUID && strings.EqualFold(species.Name, name) {
+			return ErrNameTaken
+		}
+	}
+	return nil
+}
+
+func Create(payload SpeciesPayload) (Species, error) {
+	species := NewSpecies()
+	if err := payload.Apply(species); err != nil {
+		return Species{}, err
+	}
+
+	err := repository.Transaction(func(tx Repository) error {
+		if err := checkName(tx, species.Name, ""); err != nil {
+			return err
+		}
+		return tx.Insert(*species)
+	})
+	return *species, err
+}
+
+func Update(speciesUUID string, payload SpeciesPayload) (Species, error) {
+	var updated Species
+
+	err := repository.Transaction(func(tx Repository) error {
+		species, err := tx.Get(speciesUUID)
+		if err != nil {
+			return err
+		}
+		if err := payload.Apply(&species); err != nil {
+			return err
+		}
+		if err := checkName(tx, species.Name, species.UUID); err != nil {
+			return err
+		}
+		updated = species
+		return tx.Update(species)
+	})
+	return updated, err
+}
+
+// ForPicture lists the species pictureUUID is assigned to.
+func ForPicture(pictureUUID string) ([]Species, error) {
+	allSpecies, err := repository.List()
+	if err != nil {
+		return nil, err
+	}
+
+	assigned := make([]Species, 0)
+	for _, species := range allSpecies {
+		if slices.Contains(species.Pictures, pictureUUID) {
+			assigned = append(assigned, species)
+		}
+	}
+	return assigned, nil
+}
+
+// AssignPicture makes speciesUUIDs the species of pictureUUID, it is removed from the
+// other species.
+func AssignPicture(pictureUUID string, speciesUUIDs []string) error {
+	return repository.Transaction(func(tx Repository) error {
+		for _, speciesUUID := range speciesUUIDs {
+			if _, err := tx.Get(speciesUUID); err != nil {
+				return fmt.Errorf("species %s: %w", speciesUUID, err)
+			}
+		}
+
+		allSpecies, err := tx.List()
+		if err != nil {
+			return err
+		}
+		for _, species := range allSpecies {
+			wanted := slices.Contains(speciesUUIDs, species.UUID)
+			if wanted == slices.Contains(species.Pictures, pictureUUID) {
+				continue
+			}
+
+			if wanted {
+				species.Pictures = append(slices.Clone(species.Pictures), pictureUUID)
+			} else {
+				species.Pictures = slices.DeleteFunc(slices.Clone(species.Pictures), func(uuid string) bool {
+					return uuid == pictureUUID
+				})
+			}
+			if err := tx.Update(species); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// RemovePicture drops pictureUUID from every species referencing it.
+func RemovePicture(pictureUUID string) error {
+	return AssignPicture(pictureUUID, nil)
+}
@@ -0,0 +1,269 @@
+package species
+
+import (
+	"errors"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/evanespen/vanespen.art_2025/internal/albums"
+	"github.com/evanespen/vanespen.art_2025/internal/catalog"
+	"github.com/evanespen/vanespen.art_2025/internal/pictures"
+	"slices"
+	"testing"
+)
+
+// useTestCatalog runs the test in an empty directory, with the species, the pictures
+// and the albums in memory.
+func useTestCatalog(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	previousSpecies, previousPictures, previousAlbums := repository, pictures.GetRepository(), albums.GetRepository()
+	SetRepository(catalog.NewMemoryRepository[Species]())
+	pictures.SetRepository(catalog.NewMemoryRepository[pictures.Picture]())
+	albums.SetRepository(catalog.NewMemoryRepository[albums.Album]())
+	t.Cleanup(func() {
+		SetRepository(previousSpecies)
+		pictures.SetRepository(previousPictures)
+		albums.SetRepository(previousAlbums)
+	})
+}
+
+func createTestSpecies(t *testing.T, payload SpeciesPayload) Species {
+	t.Helper()
+	if payload.ScientificName == "" {
+		payload.ScientificName = payload.Name
+	}
+	species, err := Create(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return species
+}
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload SpeciesPayload
+		wantErr error
+	}{
+		{name: "valid", payload: SpeciesPayload{Name: "Golden eagle", ScientificName: "Aquila chrysaetos", Threat: "lc", InfoPage: "https://en.wikipedia.org/wiki/Golden_eagle"}},
+		{name: "default threat", payload: SpeciesPayload{Name: "Golden eagle", ScientificName: "Aquila chrysaetos"}},
+		{name: "name taken", payload: SpeciesPayload{Name: " alpine IBEX ", ScientificName: "Capra ibex"}, wantErr: ErrNameTaken},
+		{name: "without name", payload: SpeciesPayload{Name: "  ", ScientificName: "Aquila chrysaetos"}, wantErr: ErrInvalidSpecies},
+		{name: "without scientific name", payload: SpeciesPayload{Name: "Golden eagle"}, wantErr: ErrInvalidSpecies},
+		{name: "unknown threat", payload: SpeciesPayload{Name: "Golden eagle", ScientificName: "Aquila chrysaetos", Threat: "XX"}, wantErr: ErrInvalidSpecies},
+		{name: "unknown location privacy", payload: SpeciesPayload{Name: "Golden eagle", ScientificName: "Aquila chrysaetos", LocationPrivacy: "blurred"}, wantErr: ErrInvalidSpecies},
+		{name: "info page not http", payload: SpeciesPayload{Name: "Golden eagle", ScientificName: "Aquila chrysaetos", InfoPage: "ftp://example.org/eagle"}, wantErr: ErrInvalidSpecies},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestCatalog(t)
+			createTestSpecies(t, SpeciesPayload{Name: "Alpine ibex", ScientificName: "Capra ibex"})
+
+			species, err := Create(test.payload)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+
+			allSpecies, _ := repository.List()
+			if test.wantErr != nil {
+				if len(allSpecies) != 1 {
+					t.Fatalf("got %d species, want the rejected one left out", len(allSpecies))
+				}
+				return
+			}
+			stored, err := repository.Get(species.UUID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Name != "Golden eagle" || (test.payload.Threat == "" && stored.Threat != "NE") || (test.payload.Threat != "" && stored.Threat != "LC") {
+				t.Fatalf("got species %+v", stored)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		payload SpeciesPayload
+		wantErr error
+	}{
+		{name: "renamed", target: "ibex", payload: SpeciesPayload{Name: "Ibex", ScientificName: "Capra ibex"}},
+		{name: "same name in another case", target: "ibex", payload: SpeciesPayload{Name: "ALPINE IBEX", ScientificName: "Capra ibex"}},
+		{name: "name of another species", target: "ibex", payload: SpeciesPayload{Name: "golden eagle", ScientificName: "Capra ibex"}, wantErr: ErrNameTaken},
+		{name: "invalid", target: "ibex", payload: SpeciesPayload{Name: "Ibex"}, wantErr: ErrInvalidSpecies},
+		{name: "unknown species", target: "unknown", payload: SpeciesPayload{Name: "Ibex", ScientificName: "Capra ibex"}, wantErr: catalog.ErrNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestCatalog(t)
+			ibex := createTestSpecies(t, SpeciesPayload{Name: "Alpine ibex", ScientificName: "Capra ibex"})
+			createTestSpecies(t, SpeciesPayload{Name: "Golden eagle", ScientificName: "Aquila chrysaetos"})
+			if err := AssignPicture("picture", []string{ibex.UUID}); err != nil {
+				t.Fatal(err)
+			}
+
+			target := test.target
+			if target == "ibex" {
+				target = ibex.UUID
+			}
+			if _, err := Update(target, test.payload); !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+
+			stored, _ := repository.Get(ibex.UUID)
+			wantName := "Alpine ibex"
+			if test.wantErr == nil {
+				wantName = test.payload.Name
+			}
+			if stored.Name != wantName || !slices.Equal(stored.Pictures, []string{"picture"}) {
+				t.Fatalf("got name %q and pictures %v, want %q and the assigned picture", stored.Name, stored.Pictures, wantName)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	useTestCatalog(t)
+	ibex := createTestSpecies(t, SpeciesPayload{Name: "Alpine ibex"})
+
+	for _, key := range []string{ibex.UUID, "Alpine ibex", "alpine IBEX"} {
+		if found, err := Find(key); err != nil || found.UUID != ibex.UUID {
+			t.Errorf("Find(%q) = %s, %v", key, found.UUID, err)
+		}
+	}
+	if _, err := Find("ibex"); !errors.Is(err, catalog.ErrNotFound) {
+		t.Errorf("got error %v finding an unknown species, want %v", err, catalog.ErrNotFound)
+	}
+}
+
+func TestAssignPicture(t *testing.T) {
+	useTestCatalog(t)
+	ibex := createTestSpecies(t, SpeciesPayload{Name: "Alpine ibex"})
+	eagle := createTestSpecies(t, SpeciesPayload{Name: "Golden eagle"})
+	chamois := createTestSpecies(t, SpeciesPayload{Name: "Chamois"})
+	if err := AssignPicture("other", []string{ibex.UUID}); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name    string
+		species []string
+		wantErr error
+		want    []string
+	}{
+		{name: "assigned", species: []string{ibex.UUID, eagle.UUID}, want: []string{ibex.UUID, eagle.UUID}},
+		{name: "assigned again", species: []string{ibex.UUID, eagle.UUID}, want: []string{ibex.UUID, eagle.UUID}},
+		{name: "replaced", species: []string{eagle.UUID, chamois.UUID}, want: []string{eagle.UUID, chamois.UUID}},
+		{name: "unknown species", species: []string{ibex.UUID, "unknown"}, wantErr: catalog.ErrNotFound, want: []string{eagle.UUID, chamois.UUID}},
+		{name: "unassigned", species: nil, want: nil},
+	}
+
+	for _, step := range steps {
+		if err := AssignPicture("picture", step.species); !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: got error %v, want %v", step.name, err, step.wantErr)
+		}
+
+		assigned, err := ForPicture("picture")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, species := range assigned {
+			got = append(got, species.UUID)
+		}
+		slices.Sort(got)
+		want := slices.Sorted(slices.Values(step.want))
+		if !slices.Equal(got, want) {
+			t.Fatalf("%s: got species %v, want %v", step.name, got, want)
+		}
+
+		stored, _ := repository.Get(ibex.UUID)
+		if !slices.Contains(stored.Pictures, "other") || slices.Contains(stored.Pictures, "picture") != slices.Contains(step.want, ibex.UUID) {
+			t.Fatalf("%s: got ibex pictures %v", step.name, stored.Pictures)
+		}
+	}
+}
+
+func TestDeletedPictureLeavesItsSpecies(t *testing.T) {
+	useTestCatalog(t)
+	for _, pictureUUID := range []string{"deleted", "kept"} {
+		if err := pictures.GetRepository().Insert(pictures.Picture{UUID: pictureUUID, Ext: ".jpg"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ibex := createTestSpecies(t, SpeciesPayload{Name: "Alpine ibex"})
+	eagle := createTestSpecies(t, SpeciesPayload{Name: "Golden eagle"})
+	for _, pictureUUID := range []string{"deleted", "kept"} {
+		if err := AssignPicture(pictureUUID, []string{ibex.UUID, eagle.UUID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pictures.DeletePicture("deleted"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, speciesUUID := range []string{ibex.UUID, eagle.UUID} {
+		stored, _ := repository.Get(speciesUUID)
+		if !slices.Equal(stored.Pictures, []string{"kept"}) {
+			t.Errorf("%s: got pictures %v, want only the picture kept", stored.Name, stored.Pictures)
+		}
+	}
+}
+
+func TestLocationPolicy(t *testing.T) {
+	useTestCatalog(t)
+	previousDefault := configs.LocationPrivacy
+	configs.LocationPrivacy = pictures.LocationExact
+	t.Cleanup(func() { configs.LocationPrivacy = previousDefault })
+
+	coarse := createTestSpecies(t, SpeciesPayload{Name: "Alpine ibex", LocationPrivacy: pictures.LocationCoarse})
+	hidden := createTestSpecies(t, SpeciesPayload{Name: "Bearded vulture", LocationPrivacy: pictures.LocationHidden})
+	unset := createTestSpecies(t, SpeciesPayload{Name: "Golden eagle"})
+	assignments := map[string][]string{
+		"coarse":         {coarse.UUID},
+		"coarse, hidden": {coarse.UUID, hidden.UUID},
+		"hidden, unset":  {hidden.UUID, unset.UUID},
+		"unset":          {unset.UUID},
+		"no species":     nil,
+	}
+	want := map[string]string{
+		"coarse":         pictures.LocationCoarse,
+		"coarse, hidden": pictures.LocationHidden,
+		"hidden, unset":  pictures.LocationHidden,
+		"unset":          pictures.LocationExact,
+		"no species":     pictures.LocationExact,
+	}
+
+	var all []pictures.Picture
+	for pictureUUID, speciesUUIDs := range assignments {
+		if err := AssignPicture(pictureUUID, speciesUUIDs); err != nil {
+			t.Fatal(err)
+		}
+		latitude, longitude := 45.5432, 6.1234
+		all = append(all, pictures.Picture{UUID: pictureUUID, Latitude: &latitude, Longitude: &longitude})
+	}
+
+	levels, err := locationPolicy(all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pictureUUID, level := range levels {
+		if want[pictureUUID] != level {
+			t.Errorf("%s: the policy gives %q, want %q", pictureUUID, level, want[pictureUUID])
+		}
+	}
+
+	public, err := pictures.PublicPictures(all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, picture := range public {
+		if picture.LocationPrivacy != want[picture.UUID] {
+			t.Errorf("%s: published as %q, want %q", picture.UUID, picture.LocationPrivacy, want[picture.UUID])
+		}
+	}
+}
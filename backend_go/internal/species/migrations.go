@@ -0,0 +1,14 @@
+package species
+
+import "github.com/evanespen/vanespen.art_2025/internal/catalog"
+
+func init() {
+	catalog.RegisterMigration(catalogName, catalog.Migration{
+		Version:     2,
+		Description: "add location_privacy, no level is set on the existing species",
+		Up: func(row catalog.Row) error {
+			row["location_privacy"] = ""
+			return nil
+		},
+	})
+}
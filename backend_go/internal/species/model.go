@@ -0,0 +1,86 @@
+package species
+
+import (
+	"errors"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/internal/pictures"
+	"github.com/google/uuid"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidSpecies = errors.New("invalid species")
+
+// ThreatCategories are the categories of the IUCN Red List, from extinct to not evaluated.
+var ThreatCategories = []string{"EX", "EW", "CR", "EN", "VU", "NT", "LC", "DD", "NE"}
+
+type Species struct {
+	UUID           string   `json:"uuid" parquet:"name=uuid, type=FIXED_LEN_BYTE_ARRAY, length=36, convertedtype=UTF8, encoding=DELTA_BYTE_ARRAY"`
+	Name           string   `json:"name" parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=DELTA_LENGTH_BYTE_ARRAY"`
+	ScientificName string   `json:"scientific_name" parquet:"name=scientific_name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=DELTA_LENGTH_BYTE_ARRAY"`
+	Threat         string   `json:"threat" parquet:"name=threat, type=BYTE_ARRAY, convertedtype=UTF8, encoding=DELTA_LENGTH_BYTE_ARRAY"`
+	InfoPage       string   `json:"info_page" parquet:"name=info_page, type=BYTE_ARRAY, convertedtype=UTF8, encoding=DELTA_LENGTH_BYTE_ARRAY"`
+	Description    string   `json:"description" parquet:"name=description, type=BYTE_ARRAY, convertedtype=UTF8, encoding=DELTA_LENGTH_BYTE_ARRAY"`
+	Pictures       []string `json:"pictures" parquet:"name=pictures, type=LIST, valuetype=FIXED_LEN_BYTE_ARRAY, valueconvertedtype=UTF8, valuelength=36"`
+
+	// LocationPrivacy is the privacy level applied to the position of the pictures of
+	// the species, for the sensitive ones. Empty sets no level.
+	LocationPrivacy string `json:"location_privacy" parquet:"name=location_privacy, type=BYTE_ARRAY, convertedtype=UTF8, encoding=DELTA_LENGTH_BYTE_ARRAY"`
+}
+
+// SpeciesPayload holds the fields of a species set by the admin endpoints, the pictures
+// are assigned separately.
+type SpeciesPayload struct {
+	Name           string `json:"name"`
+	ScientificName string `json:"scientific_name"`
+	Threat         string `json:"threat"`
+	InfoPage       string `json:"info_page"`
+	Description    string `json:"description"`
+
+	LocationPrivacy string `json:"location_privacy"`
+}
+
+func NewSpecies() *Species {
+	return &Species{
+		UUID:     uuid.New().String(),
+		Pictures: make([]string, 0),
+	}
+}
+
+// Apply validates the payload and sets its fields on the species, a missing threat
+// category defaults to not evaluated.
+func (p SpeciesPayload) Apply(species *Species) error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.ScientificName = strings.TrimSpace(p.ScientificName)
+	p.Threat = strings.ToUpper(strings.TrimSpace(p.Threat))
+	if p.Threat == "" {
+		p.Threat = "NE"
+	}
+
+	if p.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSpecies)
+	}
+	if p.ScientificName == "" {
+		return fmt.Errorf("%w: scientific_name is required", ErrInvalidSpecies)
+	}
+	if !slices.Contains(ThreatCategories, p.Threat) {
+		return fmt.Errorf("%w: threat must be one of %s", ErrInvalidSpecies, strings.Join(ThreatCategories, ", "))
+	}
+	if p.LocationPrivacy != "" && !pictures.IsLocationPrivacy(p.LocationPrivacy) {
+		return fmt.Errorf("%w: location_privacy must be one of %s", ErrInvalidSpecies, strings.Join(pictures.LocationPrivacyLevels, ", "))
+	}
+	if p.InfoPage != "" {
+		if page, err := url.Parse(p.InfoPage); err != nil || (page.Scheme != "http" && page.Scheme != "https") || page.Host == "" {
+			return fmt.Errorf("%w: info_page must be an http or https URL", ErrInvalidSpecies)
+		}
+	}
+
+	species.Name = p.Name
+	species.ScientificName = p.ScientificName
+	species.Threat = p.Threat
+	species.InfoPage = p.InfoPage
+	species.Description = p.Description
+	species.LocationPrivacy = p.LocationPrivacy
+	return nil
+}
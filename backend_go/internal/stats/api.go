@@ -0,0 +1,85 @@
+package stats
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// respond serves value with an ETag derived from its content so clients and proxies
+// can revalidate cheaply.
+func respond(c *gin.Context, value any, err error) {
+	if err != nil {
+		fmt.Println(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	body, err := json.MarshalIndent(value, "", "    ")
+	if err != nil {
+		fmt.Println(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(body))
+	c.Header("Cache-Control", "public, max-age=60")
+	c.Header("ETag", etag)
+
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+func GetStats(c *gin.Context) {
+	overview, err := GetOverview()
+	respond(c, overview, err)
+}
+
+func GetTimeline(c *gin.Context) {
+	timeline, err := withCatalogStats((*accumulator).timeline)
+	respond(c, timeline, err)
+}
+
+func GetEquipment(c *gin.Context) {
+	equipment, err := withCatalogStats((*accumulator).equipment)
+	respond(c, equipment, err)
+}
+
+func GetExposure(c *gin.Context) {
+	exposure, err := withCatalogStats((*accumulator).exposure)
+	respond(c, exposure, err)
+}
+
+func GetHours(c *gin.Context) {
+	hours, err := withCatalogStats(func(a *accumulator) Hours {
+		return a.hours
+	})
+	respond(c, hours, err)
+}
+
+func GetAlbums(c *gin.Context) {
+	sizes, err := GetAlbumSizes()
+	respond(c, sizes, err)
+}
+
+func GetStorageUsage(c *gin.Context) {
+	storage, err := GetStorage()
+	respond(c, storage, err)
+}
+
+func BindRoutes(engine *gin.Engine, adminGroup *gin.RouterGroup) {
+	statsRouter := engine.Group("/stats")
+	statsRouter.GET("/", GetStats)
+	statsRouter.GET("/timeline", GetTimeline)
+	statsRouter.GET("/equipment", GetEquipment)
+	statsRouter.GET("/exposure", GetExposure)
+	statsRouter.GET("/hours", GetHours)
+	statsRouter.GET("/albums", GetAlbums)
+	statsRouter.GET("/storage", GetStorageUsage)
+}
@@ -0,0 +1,68 @@
+package stats
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRespondETag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	value := map[string]int{"total": 1}
+	var failure error
+	engine := gin.New()
+	engine.GET("/stats", func(c *gin.Context) {
+		respond(c, value, failure)
+	})
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/stats", nil)
+		if ifNoneMatch != "" {
+			request.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	first := get("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Body.Len() == 0 {
+		t.Fatalf("got status %d, ETag %q and %d bytes", first.Code, etag, first.Body.Len())
+	}
+
+	tests := []struct {
+		name        string
+		total       int
+		ifNoneMatch string
+		wantStatus  int
+		wantETag    bool
+	}{
+		{name: "revalidated", total: 1, ifNoneMatch: etag, wantStatus: http.StatusNotModified, wantETag: true},
+		{name: "other ETag", total: 1, ifNoneMatch: `"other"`, wantStatus: http.StatusOK, wantETag: true},
+		{name: "changed", total: 2, ifNoneMatch: etag, wantStatus: http.StatusOK, wantETag: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value["total"] = test.total
+			recorder := get(test.ifNoneMatch)
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("got status %d, want %d", recorder.Code, test.wantStatus)
+			}
+			if (recorder.Header().Get("ETag") == etag) != test.wantETag {
+				t.Fatalf("got ETag %q, first one %q", recorder.Header().Get("ETag"), etag)
+			}
+			if test.wantStatus == http.StatusNotModified && recorder.Body.Len() != 0 {
+				t.Fatalf("got a body of %d bytes with a 304", recorder.Body.Len())
+			}
+		})
+	}
+
+	failure = errors.New("catalog unavailable")
+	if recorder := get(etag); recorder.Code != http.StatusInternalServerError || recorder.Header().Get("ETag") != "" {
+		t.Fatalf("got status %d and ETag %q on an error", recorder.Code, recorder.Header().Get("ETag"))
+	}
+}
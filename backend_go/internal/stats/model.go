@@ -0,0 +1,159 @@
+package stats
+
+import (
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/internal/pictures"
+	"math"
+	"strconv"
+	"time"
+)
+
+const topLimit = 10
+
+type Timeline struct {
+	Years  []pictures.FacetCount `json:"years"`
+	Months []pictures.FacetCount `json:"months"`
+}
+
+type Equipment struct {
+	Cameras []pictures.FacetCount `json:"cameras"`
+	Lenses  []pictures.FacetCount `json:"lenses"`
+}
+
+type Exposure struct {
+	FocalLengths []pictures.FacetCount `json:"focal_lengths"`
+	Apertures    []pictures.FacetCount `json:"apertures"`
+	Isos         []pictures.FacetCount `json:"isos"`
+}
+
+// Hours is the shooting-hour heatmap, indexed by weekday (0 is Sunday) then hour.
+type Hours [7][24]int
+
+type AlbumSize struct {
+	UUID     string `json:"uuid"`
+	Title    string `json:"title"`
+	Pictures int    `json:"pictures"`
+}
+
+type RenditionStorage struct {
+	Rendition string `json:"rendition"`
+	Files     int    `json:"files"`
+	Bytes     int64  `json:"bytes"`
+}
+
+type Overview struct {
+	Total     int                `json:"total"`
+	Timeline  Timeline           `json:"timeline"`
+	Equipment Equipment          `json:"equipment"`
+	Exposure  Exposure           `json:"exposure"`
+	Hours     Hours              `json:"hours"`
+	Albums    []AlbumSize        `json:"albums"`
+	Storage   []RenditionStorage `json:"storage"`
+}
+
+// accumulator holds the catalog aggregates as plain counters so pictures can be added
+// and removed without going through the whole catalog again.
+type accumulator struct {
+	seen         map[string]pictures.Picture
+	years        map[string]int
+	months       map[string]int
+	cameras      map[string]int
+	lenses       map[string]int
+	focalLengths map[string]int
+	apertures    map[string]int
+	isos         map[string]int
+	hours        Hours
+}
+
+func newAccumulator(all []pictures.Picture) *accumulator {
+	a := &accumulator{
+		seen:         make(map[string]pictures.Picture, len(all)),
+		years:        map[string]int{},
+		months:       map[string]int{},
+		cameras:      map[string]int{},
+		lenses:       map[string]int{},
+		focalLengths: map[string]int{},
+		apertures:    map[string]int{},
+		isos:         map[string]int{},
+	}
+	for _, picture := range all {
+		a.add(picture)
+	}
+	return a
+}
+
+func (a *accumulator) add(picture pictures.Picture) {
+	if _, ok := a.seen[picture.UUID]; ok {
+		return
+	}
+	a.seen[picture.UUID] = picture
+	a.count(picture, 1)
+}
+
+func (a *accumulator) remove(picture pictures.Picture) {
+	previous, ok := a.seen[picture.UUID]
+	if !ok {
+		return
+	}
+	delete(a.seen, picture.UUID)
+	a.count(previous, -1)
+}
+
+func (a *accumulator) count(picture pictures.Picture, delta int) {
+	datetime := time.Unix(int64(picture.Timestamp), 0).UTC()
+
+	increment(a.years, fmt.Sprintf("%04d", datetime.Year()), delta)
+	increment(a.months, fmt.Sprintf("%04d-%02d", datetime.Year(), datetime.Month()), delta)
+	increment(a.cameras, picture.Camera, delta)
+	increment(a.lenses, picture.Lens, delta)
+	increment(a.focalLengths, strconv.Itoa(int(math.Round(pictures.FocalLengthMillimeters(picture)))), delta)
+	increment(a.apertures, strconv.FormatFloat(pictures.ApertureNumber(picture), 'f', -1, 64), delta)
+	increment(a.isos, pictures.IsoBucket(picture), delta)
+	a.hours[datetime.Weekday()][datetime.Hour()] += delta
+}
+
+func increment(counts map[string]int, key string, delta int) {
+	counts[key] += delta
+	if counts[key] <= 0 {
+		delete(counts, key)
+	}
+}
+
+func (a *accumulator) total() int {
+	return len(a.seen)
+}
+
+func (a *accumulator) timeline() Timeline {
+	return Timeline{
+		Years:  pictures.FacetsByValue(a.years),
+		Months: pictures.FacetsByValue(a.months),
+	}
+}
+
+func (a *accumulator) equipment() Equipment {
+	return Equipment{
+		Cameras: top(pictures.FacetsByCount(a.cameras)),
+		Lenses:  top(pictures.FacetsByCount(a.lenses)),
+	}
+}
+
+func (a *accumulator) exposure() Exposure {
+	return Exposure{
+		FocalLengths: byNumericValue(a.focalLengths),
+		Apertures:    byNumericValue(a.apertures),
+		Isos:         pictures.FacetsInOrder(a.isos, pictures.IsoBucketLabels()),
+	}
+}
+
+func top(counts []pictures.FacetCount) []pictures.FacetCount {
+	return counts[:min(len(counts), topLimit)]
+}
+
+func byNumericValue(counts map[string]int) []pictures.FacetCount {
+	values := make([]string, 0, len(counts))
+	for value := range counts {
+		values = append(values, value)
+	}
+	sortNumerically(values)
+	return pictures.FacetsInOrder(counts, values)
+}
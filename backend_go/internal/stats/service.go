@@ -0,0 +1,162 @@
+package stats
+
+import (
+	"cmp"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/evanespen/vanespen.art_2025/internal/albums"
+	"github.com/evanespen/vanespen.art_2025/internal/pictures"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const storageTTL = 5 * time.Minute
+
+var mutex sync.Mutex
+var catalogStats *accumulator
+var storageStats []RenditionStorage
+var storageComputedAt time.Time
+
+var renditionDirs = map[string]string{
+	"full":  configs.FullResDir,
+	"half":  configs.HalfResDir,
+	"thumb": configs.ThumbResDir,
+	"tiny":  configs.TinyResDir,
+	"tiles": configs.TilesDir,
+}
+
+func init() {
+	pictures.Subscribe(handleEvent)
+}
+
+// handleEvent keeps the aggregates up to date once they have been computed, before
+// that the first request computes them from the whole catalog.
+func handleEvent(event pictures.Event) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	storageStats = nil
+
+	if catalogStats == nil {
+		return
+	}
+
+	switch event.Type {
+	case pictures.PictureCreated:
+		catalogStats.add(event.Picture)
+	case pictures.PictureUpdated:
+		if event.Previous != nil {
+			catalogStats.remove(*event.Previous)
+		}
+		catalogStats.add(event.Picture)
+	case pictures.PictureDeleted:
+		catalogStats.remove(event.Picture)
+	}
+}
+
+// withCatalogStats runs fn with the aggregates locked, computing them first if needed.
+func withCatalogStats[T any](fn func(a *accumulator) T) (T, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if catalogStats == nil {
+		all, err := pictures.GetRepository().List()
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		catalogStats = newAccumulator(all)
+	}
+
+	return fn(catalogStats), nil
+}
+
+func GetAlbumSizes() ([]AlbumSize, error) {
+	allAlbums, err := albums.GetRepository().List()
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make([]AlbumSize, 0, len(allAlbums))
+	for _, album := range allAlbums {
+		sizes = append(sizes, AlbumSize{UUID: album.UUID, Title: album.Title, Pictures: len(album.Pictures)})
+	}
+	slices.SortStableFunc(sizes, func(a AlbumSize, b AlbumSize) int {
+		return cmp.Compare(b.Pictures, a.Pictures)
+	})
+
+	return sizes, nil
+}
+
+// GetStorage walks the rendition directories, the result is kept until a picture
+// changes or storageTTL expires since files can also be touched outside the API.
+func GetStorage() ([]RenditionStorage, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if storageStats != nil && time.Since(storageComputedAt) < storageTTL {
+		return storageStats, nil
+	}
+
+	computed := make([]RenditionStorage, 0, len(renditionDirs))
+	for _, rendition := range []string{"full", "half", "thumb", "tiny", "tiles"} {
+		usage := RenditionStorage{Rendition: rendition}
+
+		err := filepath.WalkDir(renditionDirs[rendition], func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return nil
+			}
+			usage.Files++
+			usage.Bytes += info.Size()
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		computed = append(computed, usage)
+	}
+
+	storageStats = computed
+	storageComputedAt = time.Now()
+	return storageStats, nil
+}
+
+func GetOverview() (Overview, error) {
+	overview, err := withCatalogStats(func(a *accumulator) Overview {
+		return Overview{
+			Total:     a.total(),
+			Timeline:  a.timeline(),
+			Equipment: a.equipment(),
+			Exposure:  a.exposure(),
+			Hours:     a.hours,
+		}
+	})
+	if err != nil {
+		return overview, err
+	}
+
+	if overview.Albums, err = GetAlbumSizes(); err != nil {
+		return overview, err
+	}
+	if overview.Storage, err = GetStorage(); err != nil {
+		return overview, err
+	}
+
+	return overview, nil
+}
+
+func sortNumerically(values []string) {
+	slices.SortFunc(values, func(a string, b string) int {
+		aValue, _ := strconv.ParseFloat(a, 64)
+		bValue, _ := strconv.ParseFloat(b, 64)
+		return cmp.Compare(aValue, bValue)
+	})
+}
@@ -0,0 +1,125 @@
+package stats
+
+import (
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/evanespen/vanespen.art_2025/internal/pictures"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// useTestStats starts the test without any aggregate, and restores the ones computed
+// before it.
+func useTestStats(t *testing.T) {
+	t.Helper()
+	previousCatalog, previousStorage, previousComputedAt := catalogStats, storageStats, storageComputedAt
+	catalogStats, storageStats = nil, nil
+	t.Cleanup(func() {
+		catalogStats, storageStats, storageComputedAt = previousCatalog, previousStorage, previousComputedAt
+	})
+}
+
+func TestAccumulatorEvents(t *testing.T) {
+	useTestStats(t)
+
+	ibex := pictures.Picture{UUID: "ibex", Timestamp: 1700000000, Camera: "Canon EOS R6", Lens: "RF 100-500mm", FocalLength: "500.0 mm", Aperture: "f/7.1", Iso: 1600}
+	eagle := pictures.Picture{UUID: "eagle", Timestamp: 1600000000, Camera: "Canon EOS R6", Lens: "RF 100-500mm", FocalLength: "420.0 mm", Aperture: "f/6.3", Iso: 800}
+	chamois := pictures.Picture{UUID: "chamois", Timestamp: 1650000000, Camera: "Canon EOS 7D", Lens: "EF 70-200mm", FocalLength: "200.0 mm", Aperture: "f/2.8", Iso: 100}
+	corrected := ibex
+	corrected.Camera, corrected.Timestamp, corrected.Iso = "Canon EOS R5", 1500000000, 6400
+	renamed := corrected
+	renamed.Title = "ibex"
+
+	catalog := map[string]pictures.Picture{"ibex": ibex, "eagle": eagle}
+	steps := []struct {
+		name  string
+		event pictures.Event
+	}{
+		{name: "created", event: pictures.Event{Type: pictures.PictureCreated, Picture: chamois}},
+		{name: "created twice", event: pictures.Event{Type: pictures.PictureCreated, Picture: chamois}},
+		{name: "EXIF corrected", event: pictures.Event{Type: pictures.PictureUpdated, Picture: corrected, Previous: &ibex}},
+		{name: "other field updated", event: pictures.Event{Type: pictures.PictureUpdated, Picture: renamed, Previous: &corrected}},
+		{name: "deleted", event: pictures.Event{Type: pictures.PictureDeleted, Picture: eagle}},
+		{name: "deleted twice", event: pictures.Event{Type: pictures.PictureDeleted, Picture: eagle}},
+		{name: "last camera deleted", event: pictures.Event{Type: pictures.PictureDeleted, Picture: chamois}},
+		{name: "created again", event: pictures.Event{Type: pictures.PictureCreated, Picture: eagle}},
+	}
+
+	// The events are only counted once the aggregates are computed.
+	handleEvent(pictures.Event{Type: pictures.PictureCreated, Picture: chamois})
+	if catalogStats != nil {
+		t.Fatal("the aggregates are computed by an event")
+	}
+	catalogStats = newAccumulator([]pictures.Picture{ibex, eagle})
+
+	for _, step := range steps {
+		switch step.event.Type {
+		case pictures.PictureCreated, pictures.PictureUpdated:
+			catalog[step.event.Picture.UUID] = step.event.Picture
+		case pictures.PictureDeleted:
+			delete(catalog, step.event.Picture.UUID)
+		}
+		handleEvent(step.event)
+
+		var all []pictures.Picture
+		for _, picture := range catalog {
+			all = append(all, picture)
+		}
+		recomputed := newAccumulator(all)
+		if !reflect.DeepEqual(catalogStats, recomputed) {
+			t.Fatalf("%s: got aggregates %+v, want %+v", step.name, *catalogStats, *recomputed)
+		}
+		if catalogStats.total() != len(catalog) {
+			t.Fatalf("%s: got a total of %d, want %d", step.name, catalogStats.total(), len(catalog))
+		}
+	}
+
+	if _, ok := catalogStats.cameras["Canon EOS 7D"]; ok {
+		t.Fatal("a camera without pictures is still counted")
+	}
+}
+
+func TestGetStorage(t *testing.T) {
+	useTestStats(t)
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(configs.FullResDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name string, size int) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(configs.FullResDir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	full := func() RenditionStorage {
+		t.Helper()
+		storage, err := GetStorage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return storage[0]
+	}
+
+	write("a.jpg", 10)
+	if got := full(); got.Files != 1 || got.Bytes != 10 {
+		t.Fatalf("got %+v, want 1 file of 10 bytes", got)
+	}
+
+	// Files written outside the API are only seen once the result expires.
+	write("b.jpg", 20)
+	if got := full(); got.Files != 1 {
+		t.Fatalf("got %+v, want the cached result", got)
+	}
+	storageComputedAt = storageComputedAt.Add(-storageTTL)
+	if got := full(); got.Files != 2 || got.Bytes != 30 {
+		t.Fatalf("got %+v once expired, want 2 files of 30 bytes", got)
+	}
+
+	// A change to the catalog drops the result.
+	write("c.jpg", 30)
+	handleEvent(pictures.Event{Type: pictures.PictureCreated, Picture: pictures.Picture{UUID: "c"}})
+	if got := full(); got.Files != 3 || got.Bytes != 60 {
+		t.Fatalf("got %+v after a picture is created, want 3 files of 60 bytes", got)
+	}
+}
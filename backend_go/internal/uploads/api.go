@@ -0,0 +1,215 @@
+package uploads
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/evanespen/vanespen.art_2025/internal/ingest"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resumable uploads implementing the tus 1.0.0 protocol with the creation, expiration
+// and termination extensions, see https://tus.io/protocols/resumable-upload.
+
+const tusVersion = "1.0.0"
+
+func tusHeaders(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+}
+
+// requireTus rejects the requests made with another protocol version.
+func requireTus(c *gin.Context) {
+	tusHeaders(c)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.AbortWithStatus(http.StatusPreconditionFailed)
+		return
+	}
+	c.Next()
+}
+
+func parseMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata value for %s", key)
+		}
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
+
+func expires(upload Upload) string {
+	return upload.ExpiresAt.UTC().Format(http.TimeFormat)
+}
+
+func HandleOptions(c *gin.Context) {
+	tusHeaders(c)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", "creation,expiration,termination")
+	c.Header("Tus-Max-Size", strconv.FormatInt(configs.MaxUploadSize, 10))
+	c.Status(http.StatusNoContent)
+}
+
+func CreateUpload(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Upload-Length"})
+		return
+	}
+	if length > configs.MaxUploadSize {
+		c.Status(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if metadata["filename"] == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing filename in Upload-Metadata"})
+		return
+	}
+	metadata["filename"] = filepath.Base(metadata["filename"])
+
+	upload, err := Create(length, metadata)
+	if err != nil {
+		fmt.Println(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("Location", "/admin/uploads/"+upload.ID)
+	c.Header("Upload-Expires", expires(upload))
+	c.Status(http.StatusCreated)
+}
+
+func HeadUpload(c *gin.Context) {
+	upload, offset, err := Get(c.Param("id"))
+	if errors.Is(err, ErrUploadNotFound) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Header("Upload-Expires", expires(upload))
+	if upload.JobID != "" {
+		c.Header("Ingest-Job", upload.JobID)
+	}
+	c.Status(http.StatusOK)
+}
+
+// PatchUpload appends a chunk. Once the last byte is received the file is queued for
+// ingest and the job following it is given in the Ingest-Job header.
+func PatchUpload(c *gin.Context) {
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.Status(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Upload-Offset"})
+		return
+	}
+
+	id := c.Param("id")
+	unlock := lock(id)
+	defer unlock()
+
+	upload, _, err := Get(id)
+	if errors.Is(err, ErrUploadNotFound) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		c.Status(http.StatusGone)
+		return
+	}
+	if upload.JobID != "" {
+		c.Status(http.StatusConflict)
+		return
+	}
+
+	newOffset, err := Append(upload, offset, c.Request.Body)
+	c.Header("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	c.Header("Upload-Expires", expires(upload))
+	if errors.Is(err, ErrOffsetMismatch) {
+		c.Status(http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if newOffset == upload.Length {
+		upload, err = Complete(upload, ingest.StashPath(upload.Filename), func(stashPath string) (string, error) {
+			job, err := ingest.Enqueue([]ingest.StashedFile{{Filename: upload.Filename, StashPath: stashPath}})
+			return job.ID, err
+		})
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Ingest-Job", upload.JobID)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func DeleteUpload(c *gin.Context) {
+	id := c.Param("id")
+	unlock := lock(id)
+	defer unlock()
+
+	err := Terminate(id)
+	if errors.Is(err, ErrUploadNotFound) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func BindRoutes(engine *gin.Engine, adminGroup *gin.RouterGroup) {
+	uploadsRouter := adminGroup.Group("/uploads")
+	uploadsRouter.OPTIONS("", HandleOptions)
+	uploadsRouter.POST("", requireTus, CreateUpload)
+	uploadsRouter.HEAD("/:id", requireTus, HeadUpload)
+	uploadsRouter.PATCH("/:id", requireTus, PatchUpload)
+	uploadsRouter.DELETE("/:id", requireTus, DeleteUpload)
+}
@@ -0,0 +1,175 @@
+package uploads
+
+import (
+	"encoding/base64"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/gin-gonic/gin"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	BindRoutes(engine, engine.Group("/admin"))
+	return engine
+}
+
+func tusRequest(engine *gin.Engine, method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Tus-Resumable", tusVersion)
+	for key, value := range headers {
+		if value == "" {
+			request.Header.Del(key)
+		} else {
+			request.Header.Set(key, value)
+		}
+	}
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestParseMetadata(t *testing.T) {
+	encode := base64.StdEncoding.EncodeToString
+
+	tests := []struct {
+		name    string
+		header  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", header: " ", want: map[string]string{}},
+		{name: "single", header: "filename " + encode([]byte("photo.jpg")), want: map[string]string{"filename": "photo.jpg"}},
+		{name: "several", header: "filename " + encode([]byte("a b.jpg")) + ", filetype " + encode([]byte("image/jpeg")), want: map[string]string{"filename": "a b.jpg", "filetype": "image/jpeg"}},
+		{name: "key without value", header: "is_confidential", want: map[string]string{"is_confidential": ""}},
+		{name: "not base64", header: "filename photo.jpg", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseMetadata(test.header)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("%q is accepted", test.header)
+				}
+				return
+			}
+			if err != nil || !maps.Equal(got, test.want) {
+				t.Fatalf("got %v, %v, want %v", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestCreateUpload(t *testing.T) {
+	filename := "filename " + base64.StdEncoding.EncodeToString([]byte("../photo.jpg"))
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{name: "created", headers: map[string]string{"Upload-Length": "10", "Upload-Metadata": filename}, wantStatus: http.StatusCreated},
+		{name: "other protocol version", headers: map[string]string{"Tus-Resumable": "0.2.2", "Upload-Length": "10", "Upload-Metadata": filename}, wantStatus: http.StatusPreconditionFailed},
+		{name: "without protocol version", headers: map[string]string{"Tus-Resumable": "", "Upload-Length": "10", "Upload-Metadata": filename}, wantStatus: http.StatusPreconditionFailed},
+		{name: "without length", headers: map[string]string{"Upload-Metadata": filename}, wantStatus: http.StatusBadRequest},
+		{name: "empty", headers: map[string]string{"Upload-Length": "0", "Upload-Metadata": filename}, wantStatus: http.StatusBadRequest},
+		{name: "too large", headers: map[string]string{"Upload-Length": strconv.FormatInt(configs.MaxUploadSize+1, 10), "Upload-Metadata": filename}, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "without filename", headers: map[string]string{"Upload-Length": "10"}, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestUploads(t)
+			response := tusRequest(newTestRouter(), "POST", "/admin/uploads", "", test.headers)
+			if response.Code != test.wantStatus {
+				t.Fatalf("got status %d, want %d", response.Code, test.wantStatus)
+			}
+			if response.Code != http.StatusCreated {
+				return
+			}
+
+			id, found := strings.CutPrefix(response.Header().Get("Location"), "/admin/uploads/")
+			if !found {
+				t.Fatalf("got location %q", response.Header().Get("Location"))
+			}
+			upload, offset, err := Get(id)
+			if err != nil || offset != 0 || upload.Length != 10 {
+				t.Fatalf("got upload %+v at offset %d, error %v", upload, offset, err)
+			}
+			if upload.Filename != "photo.jpg" {
+				t.Fatalf("got filename %q, want the directories stripped", upload.Filename)
+			}
+		})
+	}
+}
+
+func TestPatchUpload(t *testing.T) {
+	const contentType = "application/offset+octet-stream"
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		body       string
+		expired    bool
+		wantStatus int
+		wantOffset string
+	}{
+		{name: "appended", headers: map[string]string{"Content-Type": contentType, "Upload-Offset": "4"}, body: "4567", wantStatus: http.StatusNoContent, wantOffset: "8"},
+		{name: "offset behind", headers: map[string]string{"Content-Type": contentType, "Upload-Offset": "0"}, body: "0123", wantStatus: http.StatusConflict, wantOffset: "4"},
+		{name: "offset ahead", headers: map[string]string{"Content-Type": contentType, "Upload-Offset": "8"}, body: "89", wantStatus: http.StatusConflict, wantOffset: "4"},
+		{name: "invalid offset", headers: map[string]string{"Content-Type": contentType, "Upload-Offset": "-1"}, wantStatus: http.StatusBadRequest},
+		{name: "other content type", headers: map[string]string{"Content-Type": "application/octet-stream", "Upload-Offset": "4"}, body: "4567", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "expired", headers: map[string]string{"Content-Type": contentType, "Upload-Offset": "4"}, body: "4567", expired: true, wantStatus: http.StatusGone},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestUploads(t)
+			upload := createTestUpload(t, 10)
+			if _, err := Append(upload, 0, strings.NewReader("0123")); err != nil {
+				t.Fatal(err)
+			}
+			if test.expired {
+				upload.ExpiresAt = time.Now().Add(-time.Minute)
+				if err := save(upload); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			engine := newTestRouter()
+			response := tusRequest(engine, "PATCH", "/admin/uploads/"+upload.ID, test.body, test.headers)
+			if response.Code != test.wantStatus || response.Header().Get("Upload-Offset") != test.wantOffset {
+				t.Fatalf("got status %d at offset %q, want %d at %q", response.Code, response.Header().Get("Upload-Offset"), test.wantStatus, test.wantOffset)
+			}
+
+			// HEAD gives the offset to resume from whatever the outcome of the chunk.
+			wantOffset := test.wantOffset
+			if response.Code != http.StatusNoContent {
+				wantOffset = "4"
+			}
+			head := tusRequest(engine, "HEAD", "/admin/uploads/"+upload.ID, "", nil)
+			if head.Code != http.StatusOK || head.Header().Get("Upload-Offset") != wantOffset || head.Header().Get("Upload-Length") != "10" {
+				t.Fatalf("HEAD got status %d at offset %q of %q", head.Code, head.Header().Get("Upload-Offset"), head.Header().Get("Upload-Length"))
+			}
+		})
+	}
+}
+
+func TestUnknownUpload(t *testing.T) {
+	useTestUploads(t)
+	engine := newTestRouter()
+
+	for _, method := range []string{"HEAD", "PATCH", "DELETE"} {
+		headers := map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": "0"}
+		if response := tusRequest(engine, method, "/admin/uploads/3f1c7f62-46c3-4c59-9c8e-5d6a1a0e2f10", "", headers); response.Code != http.StatusNotFound {
+			t.Errorf("%s got status %d, want %d", method, response.Code, http.StatusNotFound)
+		}
+	}
+}
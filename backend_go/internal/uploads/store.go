@@ -0,0 +1,210 @@
+package uploads
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/google/uuid"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUploadNotFound = errors.New("upload not found")
+var ErrOffsetMismatch = errors.New("upload offset mismatch")
+
+// Upload describes a resumable upload, the received bytes are in the .part file next
+// to it and its offset is the size of that file.
+type Upload struct {
+	ID        string            `json:"id"`
+	Length    int64             `json:"length"`
+	Filename  string            `json:"filename"`
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	JobID     string            `json:"job_id,omitempty"`
+}
+
+var uploadsDir = path.Join(configs.StashDir, "uploads")
+
+// locks serialises the requests made on the same upload.
+var locks sync.Map
+
+func lock(id string) func() {
+	value, _ := locks.LoadOrStore(id, &sync.Mutex{})
+	mutex := value.(*sync.Mutex)
+	mutex.Lock()
+	return mutex.Unlock
+}
+
+func infoPath(id string) string {
+	return path.Join(uploadsDir, id+".info")
+}
+
+func partPath(id string) string {
+	return path.Join(uploadsDir, id+".part")
+}
+
+func Create(length int64, metadata map[string]string) (Upload, error) {
+	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
+		return Upload{}, err
+	}
+
+	now := time.Now()
+	upload := Upload{
+		ID:        uuid.New().String(),
+		Length:    length,
+		Filename:  metadata["filename"],
+		Metadata:  metadata,
+		CreatedAt: now,
+		ExpiresAt: now.Add(configs.UploadExpiry),
+	}
+
+	if err := os.WriteFile(partPath(upload.ID), nil, 0644); err != nil {
+		return Upload{}, err
+	}
+	if err := save(upload); err != nil {
+		_ = os.Remove(partPath(upload.ID))
+		return Upload{}, err
+	}
+
+	return upload, nil
+}
+
+func Get(id string) (Upload, int64, error) {
+	var upload Upload
+
+	if _, err := uuid.Parse(id); err != nil {
+		return upload, 0, ErrUploadNotFound
+	}
+
+	data, err := os.ReadFile(infoPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return upload, 0, ErrUploadNotFound
+	}
+	if err != nil {
+		return upload, 0, err
+	}
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return upload, 0, err
+	}
+
+	if upload.JobID != "" {
+		return upload, upload.Length, nil
+	}
+
+	info, err := os.Stat(partPath(id))
+	if err != nil {
+		return upload, 0, err
+	}
+	return upload, info.Size(), nil
+}
+
+// Append writes the chunk read from body at offset, which must be the current offset of
+// the upload, and returns the new offset.
+func Append(upload Upload, offset int64, body io.Reader) (int64, error) {
+	_, current, err := Get(upload.ID)
+	if err != nil {
+		return 0, err
+	}
+	if offset != current {
+		return current, ErrOffsetMismatch
+	}
+
+	part, err := os.OpenFile(partPath(upload.ID), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return current, err
+	}
+	defer part.Close()
+
+	// A connection dropped in the middle of a chunk still keeps the bytes received so
+	// far, the client resumes from the offset returned by HEAD.
+	written, copyErr := io.Copy(part, io.LimitReader(body, upload.Length-offset))
+	if err := part.Sync(); err != nil {
+		return offset + written, err
+	}
+
+	return offset + written, copyErr
+}
+
+// Complete moves the finished upload into the stash under its original filename and
+// records the ingest job it was handed to.
+func Complete(upload Upload, stashPath string, jobID func(stashPath string) (string, error)) (Upload, error) {
+	if err := os.Rename(partPath(upload.ID), stashPath); err != nil {
+		return upload, fmt.Errorf("cannot stash completed upload: %w", err)
+	}
+
+	id, err := jobID(stashPath)
+	if err != nil {
+		_ = os.Rename(stashPath, partPath(upload.ID))
+		return upload, err
+	}
+
+	upload.JobID = id
+	return upload, save(upload)
+}
+
+func Terminate(id string) error {
+	if err := os.Remove(infoPath(id)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrUploadNotFound
+		}
+		return err
+	}
+	_ = os.Remove(partPath(id))
+	locks.Delete(id)
+	return nil
+}
+
+func save(upload Upload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+
+	tmpFile := infoPath(upload.ID) + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, infoPath(upload.ID))
+}
+
+// RemoveExpired deletes the uploads whose expiry date has passed, finished or not.
+func RemoveExpired() {
+	entries, err := os.ReadDir(uploadsDir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		id, isInfo := strings.CutSuffix(entry.Name(), ".info")
+		if !isInfo {
+			continue
+		}
+
+		unlock := lock(id)
+		upload, _, err := Get(id)
+		if err == nil && time.Now().After(upload.ExpiresAt) {
+			if err := Terminate(id); err != nil {
+				log.Println("cannot remove expired upload:", err)
+			} else {
+				log.Printf("removed expired upload %s (%s)\n", id, upload.Filename)
+			}
+		}
+		unlock()
+	}
+}
+
+func StartJanitor() {
+	go func() {
+		for {
+			RemoveExpired()
+			time.Sleep(configs.UploadJanitorInterval)
+		}
+	}()
+}
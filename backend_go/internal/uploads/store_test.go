@@ -0,0 +1,183 @@
+package uploads
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func useTestUploads(t *testing.T) {
+	t.Helper()
+	previous := uploadsDir
+	uploadsDir = t.TempDir()
+	t.Cleanup(func() { uploadsDir = previous })
+}
+
+func createTestUpload(t *testing.T, length int64) Upload {
+	t.Helper()
+	upload, err := Create(length, map[string]string{"filename": "photo.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return upload
+}
+
+func TestAppend(t *testing.T) {
+	type chunk struct {
+		offset     int64
+		body       io.Reader
+		wantOffset int64
+		wantErr    error
+	}
+
+	tests := []struct {
+		name   string
+		chunks []chunk
+	}{
+		{name: "single chunk", chunks: []chunk{
+			{offset: 0, body: strings.NewReader("0123456789"), wantOffset: 10},
+		}},
+		{name: "several chunks", chunks: []chunk{
+			{offset: 0, body: strings.NewReader("0123"), wantOffset: 4},
+			{offset: 4, body: strings.NewReader("4567"), wantOffset: 8},
+			{offset: 8, body: strings.NewReader("89"), wantOffset: 10},
+		}},
+		{name: "offset behind", chunks: []chunk{
+			{offset: 0, body: strings.NewReader("0123"), wantOffset: 4},
+			{offset: 0, body: strings.NewReader("0123"), wantOffset: 4, wantErr: ErrOffsetMismatch},
+		}},
+		{name: "offset ahead", chunks: []chunk{
+			{offset: 4, body: strings.NewReader("4567"), wantOffset: 0, wantErr: ErrOffsetMismatch},
+		}},
+		{name: "past the length", chunks: []chunk{
+			{offset: 0, body: strings.NewReader("0123456789abcdef"), wantOffset: 10},
+		}},
+		{name: "resumed after a dropped connection", chunks: []chunk{
+			{offset: 0, body: io.MultiReader(strings.NewReader("012345"), iotest.ErrReader(io.ErrUnexpectedEOF)), wantOffset: 6, wantErr: io.ErrUnexpectedEOF},
+			{offset: 6, body: strings.NewReader("6789"), wantOffset: 10},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestUploads(t)
+			upload := createTestUpload(t, 10)
+
+			for i, chunk := range test.chunks {
+				offset, err := Append(upload, chunk.offset, chunk.body)
+				if !errors.Is(err, chunk.wantErr) || offset != chunk.wantOffset {
+					t.Fatalf("chunk %d: got offset %d, error %v, want %d, %v", i, offset, err, chunk.wantOffset, chunk.wantErr)
+				}
+				// The offset given by HEAD is the one the client resumes from.
+				if _, current, err := Get(upload.ID); err != nil || current != chunk.wantOffset {
+					t.Fatalf("chunk %d: upload at offset %d, error %v, want %d", i, current, err, chunk.wantOffset)
+				}
+			}
+
+			data, err := os.ReadFile(partPath(upload.ID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "0123456789"[:len(data)]; string(data) != want {
+				t.Fatalf("received %q, want %q", data, want)
+			}
+		})
+	}
+}
+
+func TestGetUnknownUpload(t *testing.T) {
+	useTestUploads(t)
+
+	for _, id := range []string{"", "../uploads", "not-a-uuid", "3f1c7f62-46c3-4c59-9c8e-5d6a1a0e2f10"} {
+		if _, _, err := Get(id); !errors.Is(err, ErrUploadNotFound) {
+			t.Errorf("Get(%q): got error %v, want %v", id, err, ErrUploadNotFound)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	errEnqueue := errors.New("queue full")
+
+	tests := []struct {
+		name    string
+		jobErr  error
+		wantJob string
+	}{
+		{name: "queued", wantJob: "job"},
+		{name: "not queued", jobErr: errEnqueue},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestUploads(t)
+			upload := createTestUpload(t, 4)
+			if _, err := Append(upload, 0, strings.NewReader("data")); err != nil {
+				t.Fatal(err)
+			}
+
+			stashPath := filepath.Join(uploadsDir, "photo.jpg")
+			upload, err := Complete(upload, stashPath, func(string) (string, error) { return "job", test.jobErr })
+			if !errors.Is(err, test.jobErr) {
+				t.Fatalf("got error %v, want %v", err, test.jobErr)
+			}
+
+			stored, offset, err := Get(upload.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.JobID != test.wantJob || offset != 4 {
+				t.Fatalf("got job %q at offset %d, want %q at 4", stored.JobID, offset, test.wantJob)
+			}
+			// The upload that could not be queued is left as it was, the client can retry.
+			_, stashErr := os.Stat(stashPath)
+			if test.jobErr != nil && !errors.Is(stashErr, os.ErrNotExist) {
+				t.Fatalf("the file is left in the stash: %v", stashErr)
+			}
+			if test.jobErr == nil && stashErr != nil {
+				t.Fatalf("the file is not stashed: %v", stashErr)
+			}
+		})
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	useTestUploads(t)
+	upload := createTestUpload(t, 10)
+
+	if err := Terminate(upload.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Get(upload.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Fatalf("got error %v after terminating, want %v", err, ErrUploadNotFound)
+	}
+	if _, err := os.Stat(partPath(upload.ID)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("the received bytes are left behind: %v", err)
+	}
+	if err := Terminate(upload.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Fatalf("got error %v terminating twice, want %v", err, ErrUploadNotFound)
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	useTestUploads(t)
+	expired := createTestUpload(t, 10)
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	if err := save(expired); err != nil {
+		t.Fatal(err)
+	}
+	active := createTestUpload(t, 10)
+
+	RemoveExpired()
+
+	if _, _, err := Get(expired.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("the expired upload is kept: %v", err)
+	}
+	if _, _, err := Get(active.ID); err != nil {
+		t.Errorf("the active upload is removed: %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+package watch
+
+import (
+	"fmt"
+	"github.com/evanespen/vanespen.art_2025/configs"
+	"github.com/evanespen/vanespen.art_2025/internal/albums"
+	"github.com/evanespen/vanespen.art_2025/internal/pictures"
+	"github.com/fsnotify/fsnotify"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// candidate is a file seen in a drop folder, it is ingested once its size and
+// modification time did not change for configs.WatchStableDuration.
+type candidate struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// Watcher ingests the pictures dropped in root or in one of its subfolders, then moves
+// them to the processed or failed subfolder. The folder is rescanned periodically, inotify
+// events only make new files noticed sooner.
+type Watcher struct {
+	root       string
+	candidates map[string]candidate
+	stuck      map[string]bool
+	events     *fsnotify.Watcher
+}
+
+// stop is closed by Stop, running counts the watchers not returned yet.
+var stop = make(chan struct{})
+var running sync.WaitGroup
+
+func Start(folders []string) error {
+	for _, folder := range folders {
+		watcher, err := NewWatcher(folder)
+		if err != nil {
+			return err
+		}
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			watcher.Run(stop)
+		}()
+	}
+	return nil
+}
+
+// Stop waits for the watchers to finish the file they are ingesting, the files not
+// ingested yet are left in the drop folders for the next start.
+func Stop() {
+	close(stop)
+	running.Wait()
+}
+
+func NewWatcher(root string) (*Watcher, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range []string{root, filepath.Join(root, configs.WatchProcessedDir), filepath.Join(root, configs.WatchFailedDir)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("cannot create drop folder %s: %w", dir, err)
+		}
+	}
+
+	w := &Watcher{root: root, candidates: make(map[string]candidate), stuck: make(map[string]bool)}
+
+	if !configs.WatchPolling {
+		events, err := fsnotify.NewWatcher()
+		if err == nil {
+			w.events = events
+			err = w.watchDirs()
+		}
+		if err != nil {
+			log.Printf("watching %s by polling, inotify is unavailable: %v\n", root, err)
+			if w.events != nil {
+				_ = w.events.Close()
+				w.events = nil
+			}
+		}
+	}
+
+	return w, nil
+}
+
+// dropDirs lists root and its album subfolders.
+func (w *Watcher) dropDirs() []string {
+	dirs := []string{w.root}
+
+	entries, err := os.ReadDir(w.root)
+	if err != nil {
+		log.Println(err)
+		return dirs
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !w.reserved(entry.Name()) {
+			dirs = append(dirs, filepath.Join(w.root, entry.Name()))
+		}
+	}
+	return dirs
+}
+
+func (w *Watcher) reserved(name string) bool {
+	return name == configs.WatchProcessedDir || name == configs.WatchFailedDir || strings.HasPrefix(name, ".")
+}
+
+func (w *Watcher) watchDirs() error {
+	for _, dir := range w.dropDirs() {
+		if err := w.events.Add(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run watches the folder until stop is closed.
+func (w *Watcher) Run(stop <-chan struct{}) {
+	log.Printf("watching drop folder %s\n", w.root)
+	w.scan()
+
+	stability := time.NewTicker(time.Second)
+	defer stability.Stop()
+	poll := time.NewTicker(configs.WatchPollInterval)
+	defer poll.Stop()
+
+	var events <-chan fsnotify.Event
+	var failures <-chan error
+	if w.events != nil {
+		events = w.events.Events
+		failures = w.events.Errors
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case event := <-events:
+			w.handleEvent(event)
+		case err := <-failures:
+			log.Printf("watching %s: %v\n", w.root, err)
+		case <-poll.C:
+			w.scan()
+		case <-stability.C:
+			w.ingestStable(stop)
+		}
+	}
+}
+
+func (w *Watcher) handleEvent(event fsnotify.Event) {
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+		return
+	}
+
+	info, err := os.Stat(event.Name)
+	if err != nil {
+		return
+	}
+	if info.IsDir() {
+		if filepath.Dir(event.Name) == w.root && !w.reserved(info.Name()) {
+			if err := w.events.Add(event.Name); err != nil {
+				log.Println(err)
+			}
+			w.scan()
+		}
+		return
+	}
+
+	w.track(event.Name, info)
+}
+
+func (w *Watcher) scan() {
+	for _, dir := range w.dropDirs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			w.track(filepath.Join(dir, entry.Name()), info)
+		}
+	}
+}
+
+func (w *Watcher) track(file string, info os.FileInfo) {
+	if !pictures.IsSupportedImage(file) || strings.HasPrefix(info.Name(), ".") || w.stuck[file] {
+		return
+	}
+
+	previous, ok := w.candidates[file]
+	if ok && previous.size == info.Size() && previous.modTime.Equal(info.ModTime()) {
+		return
+	}
+	w.candidates[file] = candidate{size: info.Size(), modTime: info.ModTime(), since: time.Now()}
+}
+
+// ingestStable ingests the candidates which are complete, a file still being copied
+// keeps changing and resets its stability timer. It returns early once stop is closed.
+func (w *Watcher) ingestStable(stop <-chan struct{}) {
+	for file, previous := range w.candidates {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			delete(w.candidates, file)
+			continue
+		}
+		if info.Size() != previous.size || !info.ModTime().Equal(previous.modTime) {
+			w.candidates[file] = candidate{size: info.Size(), modTime: info.ModTime(), since: time.Now()}
+			continue
+		}
+		if time.Since(previous.since) < configs.WatchStableDuration {
+			continue
+		}
+
+		delete(w.candidates, file)
+		w.ingest(file)
+	}
+}
+
+func (w *Watcher) ingest(file string) {
+	relative, err := filepath.Rel(w.root, file)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	result := pictures.Ingest(file, relative)
+
+	album := filepath.Dir(relative)
+	if configs.WatchAlbums && album != "." && result.UUID != "" {
+		if err := albums.AddPictureByTitle(album, result.UUID); err != nil {
+			log.Printf("cannot add %s to album %s: %v\n", relative, album, err)
+		}
+	}
+
+	destination := configs.WatchProcessedDir
+	if result.Status != pictures.UploadCreated && result.Status != pictures.UploadDuplicate {
+		destination = configs.WatchFailedDir
+	}
+	moved, err := w.move(file, filepath.Join(w.root, destination, relative))
+	if err != nil {
+		// Left in place the file would be ingested again on every scan.
+		log.Printf("cannot move %s out of the drop folder: %v\n", relative, err)
+		w.stuck[file] = true
+		moved = ""
+	}
+
+	w.record(result, moved)
+}
+
+// move renames file to target, suffixing the name when target already exists.
+func (w *Watcher) move(file string, target string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", err
+	}
+
+	ext := filepath.Ext(target)
+	base := strings.TrimSuffix(target, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(target); os.IsNotExist(err) {
+			break
+		}
+		target = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+
+	return target, os.Rename(file, target)
+}
+
+// record appends the result to the log file of the drop folder.
+func (w *Watcher) record(result pictures.UploadResult, moved string) {
+	detail := result.UUID
+	if result.Reason != "" {
+		detail = strings.TrimSpace(strings.Join([]string{result.UUID, result.Reason}, " "))
+	}
+	if moved != "" {
+		moved, _ = filepath.Rel(w.root, moved)
+	}
+	line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339), result.Status, result.Filename, moved, detail)
+
+	logFile, err := os.OpenFile(filepath.Join(w.root, configs.WatchLogFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer logFile.Close()
+
+	if _, err := logFile.WriteString(line); err != nil {
+		log.Println(err)
+	}
+}
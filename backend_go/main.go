@@ -1,18 +1,158 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"github.com/evanespen/vanespen.art_2025/configs"
 	"github.com/evanespen/vanespen.art_2025/internal/albums"
 	"github.com/evanespen/vanespen.art_2025/internal/api"
+	"github.com/evanespen/vanespen.art_2025/internal/catalog"
 	"github.com/evanespen/vanespen.art_2025/internal/cdn"
+	"github.com/evanespen/vanespen.art_2025/internal/ingest"
 	"github.com/evanespen/vanespen.art_2025/internal/pictures"
 	"github.com/evanespen/vanespen.art_2025/internal/security"
+	"github.com/evanespen/vanespen.art_2025/internal/species"
+	"github.com/evanespen/vanespen.art_2025/internal/stats"
+	"github.com/evanespen/vanespen.art_2025/internal/uploads"
+	"github.com/evanespen/vanespen.art_2025/internal/watch"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
+const usage = `usage: vanespen <command> [arguments]
+
+Commands:
+  serve                             run the HTTP API (default)
+  ingest [-album title] <paths...>  ingest image files or directories
+  reindex [-dry-run]                refresh dimensions, perceptual hashes and placeholders
+                                    from the full renditions
+  renditions [-only names] [-force] [-filter query] [-workers n]
+                                    rebuild the renditions made with an older profile
+  verify [-fix] [-yes]              check the catalog against the storage and the renditions
+                                    for sensitive metadata
+  hash-password                     hash a password for configs.PasswordHash
+  export [file]                     write the catalog as JSON, to stdout by default
+  import [-replace] [-yes] <file>   load a catalog exported as JSON
+  albums list                       list the albums
+  albums create [-description d] <title>
+  albums add <album> <pictures...>  add pictures to an album given by uuid or title
+  migrate [-dry-run]                upgrade the parquet catalog files
+
+With the parquet backend the commands working on the catalog refuse to run while the
+server or another command is using it, each process keeps its own copy of the catalog.
+`
+
 func main() {
+	command := "serve"
+	var args []string
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+		args = os.Args[2:]
+	}
+
+	switch command {
+	case "serve":
+		serve()
+	case "migrate":
+		migrate(args)
+	case "ingest":
+		ingestFiles(args)
+	case "reindex":
+		reindex(args)
+	case "renditions":
+		rebuildRenditions(args)
+	case "verify":
+		verify(args)
+	case "hash-password":
+		hashPassword()
+	case "export":
+		exportCatalog(args)
+	case "import":
+		importCatalog(args)
+	case "albums":
+		manageAlbums(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n%s", command, usage)
+		os.Exit(2)
+	}
+}
+
+// lockCatalog exits when another process uses the parquet catalog, both would append to
+// the same change logs and compact over each other's files. The returned function
+// releases the lock.
+func lockCatalog() func() {
+	if configs.CatalogBackend != string(catalog.ParquetBackend) {
+		return func() {}
+	}
+
+	unlock, err := catalog.Lock(configs.CatalogLockFile)
+	if errors.Is(err, catalog.ErrLocked) {
+		log.Fatalf("the catalog is in use by another process (%s is locked), stop the server or the other command first", configs.CatalogLockFile)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return unlock
+}
+
+// openCatalog opens the pictures, albums and species repositories, the returned function closes them.
+func openCatalog() func() {
+	unlock := lockCatalog()
+
+	picturesRepository, err := pictures.OpenRepository()
+	if err != nil {
+		log.Fatal(err)
+	}
+	pictures.SetRepository(picturesRepository)
+
+	albumsRepository, err := albums.OpenRepository()
+	if err != nil {
+		log.Fatal(err)
+	}
+	albums.SetRepository(albumsRepository)
+
+	speciesRepository, err := species.OpenRepository()
+	if err != nil {
+		log.Fatal(err)
+	}
+	species.SetRepository(speciesRepository)
+
+	return func() {
+		if err := picturesRepository.Close(); err != nil {
+			log.Println(err)
+		}
+		if err := albumsRepository.Close(); err != nil {
+			log.Println(err)
+		}
+		if err := speciesRepository.Close(); err != nil {
+			log.Println(err)
+		}
+		unlock()
+	}
+}
+
+func serve() {
+	closeCatalog := openCatalog()
+	defer closeCatalog()
+
+	if err := ingest.Start(); err != nil {
+		log.Fatal(err)
+	}
+	uploads.StartJanitor()
+	if err := watch.Start(configs.WatchFolders); err != nil {
+		log.Fatal(err)
+	}
+
 	router := api.GetRouter()
 	router.Use(cors.Default()) // All origins allowed by default
 
@@ -28,13 +168,64 @@ func main() {
 
 	pictures.BindRoutes(router, adminRouter)
 	albums.BindRoutes(router, adminRouter)
+	species.BindRoutes(router, adminRouter)
+	ingest.BindRoutes(router, adminRouter)
+	uploads.BindRoutes(router, adminRouter)
 	cdn.BindRoutes(router, adminRouter)
 	security.BindRoutes(router, adminRouter)
+	stats.BindRoutes(router, adminRouter)
 
-	err := router.Run(configs.APIHost)
-	if err != nil {
-		log.Fatal(err)
-		return
+	// The requests in flight, the event streams among them, are cancelled on SIGINT or
+	// SIGTERM, then the drop folders and the ingest queue are drained. The catalog is
+	// closed once they returned so its last changes are compacted.
+	stop, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	server := &http.Server{
+		Addr:        configs.APIHost,
+		Handler:     router,
+		BaseContext: func(net.Listener) context.Context { return stop },
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-stop.Done()
+	log.Println("shutting down")
+	shutdown, cancelShutdown := context.WithTimeout(context.Background(), configs.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdown); err != nil {
+		log.Println(err)
 	}
+	watch.Stop()
+	ingest.Stop()
+}
+
+func migrate(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "show the pending migrations without rewriting the catalog files")
+	_ = flags.Parse(args)
+
+	if configs.CatalogBackend != string(catalog.ParquetBackend) {
+		log.Fatalf("migrations only apply to the parquet backend, current backend is %s", configs.CatalogBackend)
+	}
+	unlock := lockCatalog()
+	defer unlock()
+
+	for _, run := range []func(bool) (catalog.MigrationReport, error){pictures.Migrate, albums.Migrate, species.Migrate} {
+		report, err := run(*dryRun)
+		if err != nil {
+			log.Fatal(err)
+		}
 
+		fmt.Printf("%s (%s): %d rows, schema version %d -> %d\n", report.Catalog, report.File, report.Rows, report.FromVersion, report.ToVersion)
+		for _, migration := range report.Applied {
+			fmt.Printf("  %d: %s\n", migration.Version, migration.Description)
+		}
+		if *dryRun && len(report.Applied) > 0 {
+			fmt.Println("  dry run, file left untouched")
+		}
+	}
 }